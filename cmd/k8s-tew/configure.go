@@ -50,6 +50,7 @@ var configureCmd = &cobra.Command{
 type stringSetter func(value string)
 type uint16Setter func(value uint16)
 type uintSetter func(value uint)
+type boolSetter func(value bool)
 
 var setterHandlers map[string]stringSetter
 
@@ -87,6 +88,16 @@ func addUintOption(name string, value uint, description string, handler uintSett
 	}
 }
 
+func addBoolOption(name string, value bool, description string, handler boolSetter) {
+	configureCmd.Flags().Bool(name, value, description)
+
+	setterHandlers[name] = func(value string) {
+		_value, _ := strconv.ParseBool(value)
+
+		handler(_value)
+	}
+}
+
 func init() {
 	setterHandlers = map[string]stringSetter{}
 
@@ -110,6 +121,10 @@ func init() {
 		_config.Config.DrainGracePeriodSeconds = value
 	})
 
+	addUint16Option("generation-retention", utils.GenerationRetention, "The number of deployed generations kept on each node for rollbacks", func(value uint16) {
+		_config.Config.GenerationRetention = value
+	})
+
 	addUint16Option("ca-certificate-validity-period", utils.CaValidityPeriod, "CA Certificate Validity Period", func(value uint16) {
 		_config.Config.CAValidityPeriod = uint(value)
 	})
@@ -138,6 +153,10 @@ func init() {
 		_config.Config.KubernetesDashboardPort = value
 	})
 
+	addUint16Option("metrics-port", utils.PortMetrics, "Port of the metrics exposed by 'k8s-tew run'", func(value uint16) {
+		_config.Config.MetricsPort = value
+	})
+
 	addUint16Option("grafana-size", utils.GrafanaSize, "Size of Grafana Persistent Volume", func(value uint16) {
 		_config.Config.GrafanaSize = uint16(value)
 	})
@@ -246,6 +265,50 @@ func init() {
 		_config.Config.DeploymentDirectory = value
 	})
 
+	addStringOption("oidc-issuer-url", "", "OIDC issuer URL used by the API Server to authenticate users", func(value string) {
+		_config.Config.OIDC.IssuerURL = value
+	})
+
+	addStringOption("oidc-client-id", "", "OIDC client ID", func(value string) {
+		_config.Config.OIDC.ClientID = value
+	})
+
+	addStringOption("oidc-username-claim", utils.OIDCUsernameClaim, "OIDC claim used as the user name", func(value string) {
+		_config.Config.OIDC.UsernameClaim = value
+	})
+
+	addStringOption("oidc-groups-claim", utils.OIDCGroupsClaim, "OIDC claim used as the user's groups", func(value string) {
+		_config.Config.OIDC.GroupsClaim = value
+	})
+
+	addStringOption("oidc-ca-file", "", "CA file used to verify the OIDC issuer's certificate", func(value string) {
+		_config.Config.OIDC.CAFile = value
+	})
+
+	addStringOption("ssh-user", utils.DeploymentUser, "Default SSH user used to deploy the nodes", func(value string) {
+		_config.Config.SSH.User = value
+	})
+
+	addUint16Option("ssh-port", utils.PortSSH, "Default SSH port of the nodes", func(value uint16) {
+		_config.Config.SSH.Port = value
+	})
+
+	addStringOption("ssh-identity-file", "", "Default SSH identity file (overrides the identity file passed to deploy)", func(value string) {
+		_config.Config.SSH.IdentityFile = value
+	})
+
+	addBoolOption("ssh-agent", false, "Authenticate using the SSH agent referenced by SSH_AUTH_SOCK", func(value bool) {
+		_config.Config.SSH.Agent = value
+	})
+
+	addBoolOption("ssh-sudo", false, "Escalate the remote commands using sudo if the SSH user is not root", func(value bool) {
+		_config.Config.SSH.Sudo = value
+	})
+
+	addStringOption("ssh-jump-hosts", "", "Default SSH jump hosts in the form [user@]host[:port] (comma separated)", func(value string) {
+		_config.Config.SSH.JumpHosts = utils.SplitList(value)
+	})
+
 	addStringOption("version-etcd", utils.VersionEtcd, "Etcd version", func(value string) {
 		_config.Config.Versions.Etcd = value
 	})
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/darxkies/k8s-tew/pkg/delta"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var deltaBlockSize int
+
+var deltaCmd = &cobra.Command{
+	Use:    "delta",
+	Short:  "Delta transfer helpers executed on the nodes during deployment",
+	Long:   "Delta transfer helpers executed on the nodes during deployment",
+	Hidden: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("Missing sub-command")
+	},
+}
+
+var deltaSignatureCmd = &cobra.Command{
+	Use:   "signature <basis-file>",
+	Short: "Write the block signature of the basis file to stdout",
+	Long:  "Write the block signature of the basis file to stdout",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, _error := os.Open(args[0])
+		if _error != nil {
+			return _error
+		}
+
+		defer file.Close()
+
+		signature, _error := delta.NewSignature(file, deltaBlockSize)
+		if _error != nil {
+			return _error
+		}
+
+		return signature.Write(os.Stdout)
+	},
+}
+
+var deltaPatchCmd = &cobra.Command{
+	Use:   "patch <basis-file>",
+	Short: "Apply the delta read from stdin to the basis file and write the result to stdout",
+	Long:  "Apply the delta read from stdin to the basis file and write the result to stdout",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, _error := os.Open(args[0])
+		if _error != nil {
+			return _error
+		}
+
+		defer file.Close()
+
+		return delta.Patch(file, os.Stdin, os.Stdout)
+	},
+}
+
+func init() {
+	deltaSignatureCmd.Flags().IntVar(&deltaBlockSize, "block-size", utils.DeltaBlockSize, "The size of the blocks in bytes")
+	deltaCmd.AddCommand(deltaSignatureCmd)
+	deltaCmd.AddCommand(deltaPatchCmd)
+	RootCmd.AddCommand(deltaCmd)
+}
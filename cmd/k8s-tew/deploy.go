@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path"
 
@@ -25,6 +26,36 @@ var skipIngressSetup bool
 var forceUpload bool
 var importImages bool
 var wait uint
+var knownHostsFile string
+var acceptNewHostKeys bool
+var rolling bool
+var rollingBatchSize uint
+var rollingTimeout uint
+var plan bool
+var resume bool
+var parallelNodes uint
+var skipPreflight bool
+var compressUploads bool
+var deltaUploads bool
+var planOutput string
+var reportStream string
+
+func showPlan(_deployment *deployment.Deployment) error {
+	if planOutput != utils.OutputText && planOutput != utils.OutputJSON {
+		return fmt.Errorf("unknown output format '%s'", planOutput)
+	}
+
+	_plan, error := _deployment.Plan()
+	if error != nil {
+		return error
+	}
+
+	if planOutput == utils.OutputJSON {
+		return _plan.WriteJSON(os.Stdout)
+	}
+
+	return _plan.WriteText(os.Stdout)
+}
 
 var deployCmd = &cobra.Command{
 	Use:   "deploy",
@@ -37,13 +68,91 @@ var deployCmd = &cobra.Command{
 			os.Exit(-1)
 		}
 
-		_deployment := deployment.NewDeployment(_config, identityFile, importImages, forceUpload, parallel, commandRetries, skipSetup, skipUpload, skipRestart, skipStorageSetup, skipMonitoringSetup, skipLoggingSetup, skipBackupSetup, skipShowcaseSetup, skipIngressSetup, wait)
+		_deployment := deployment.NewDeployment(_config, deployment.DeploymentOptions{
+			IdentityFile:        identityFile,
+			KnownHostsFile:      knownHostsFile,
+			AcceptNewHostKeys:   acceptNewHostKeys,
+			CommandRetries:      commandRetries,
+			Parallel:            parallel,
+			ParallelNodes:       parallelNodes,
+			ImportImages:        importImages,
+			ForceUpload:         forceUpload,
+			CompressUploads:     compressUploads,
+			DeltaUploads:        deltaUploads,
+			SkipPreflight:       skipPreflight,
+			SkipSetup:           skipSetup,
+			SkipUpload:          skipUpload,
+			SkipRestart:         skipRestart,
+			SkipStorageSetup:    skipStorageSetup,
+			SkipMonitoringSetup: skipMonitoringSetup,
+			SkipLoggingSetup:    skipLoggingSetup,
+			SkipBackupSetup:     skipBackupSetup,
+			SkipShowcaseSetup:   skipShowcaseSetup,
+			SkipIngressSetup:    skipIngressSetup,
+			Wait:                wait,
+			Rolling:             rolling,
+			RollingBatchSize:    rollingBatchSize,
+			RollingTimeout:      rollingTimeout,
+			Resume:              resume,
+		})
+
+		if plan {
+			if error := showPlan(_deployment); error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed planning")
+
+				os.Exit(-2)
+			}
+
+			return
+		}
+
+		var reportFile *os.File
+
+		if len(reportStream) > 0 {
+			if reportStream == "-" {
+				// The progress would end up between the JSON lines
+				utils.SupressProgress(true)
+
+				_deployment.SetReportStream(os.Stdout)
+
+			} else {
+				file, error := os.Create(reportStream)
+				if error != nil {
+					log.WithFields(log.Fields{"error": error, "filename": reportStream}).Error("Failed creating report stream")
+
+					os.Exit(-2)
+				}
+
+				reportFile = file
+
+				_deployment.SetReportStream(file)
+			}
+		}
+
+		// os.Exit skips deferred calls, so the stream is closed explicitly on both paths
+		closeReportStream := func() {
+			if reportFile == nil {
+				return
+			}
+
+			if error := reportFile.Sync(); error != nil {
+				log.WithFields(log.Fields{"error": error, "filename": reportStream}).Error("Failed writing report stream")
+			}
+
+			if error := reportFile.Close(); error != nil {
+				log.WithFields(log.Fields{"error": error, "filename": reportStream}).Error("Failed closing report stream")
+			}
+		}
 
 		utils.SetProgressSteps(_deployment.Steps() + 1)
 
 		utils.ShowProgress()
 
 		if error := _deployment.Deploy(); error != nil {
+			utils.HideProgress()
+
+			closeReportStream()
+
 			log.WithFields(log.Fields{"error": error}).Error("Failed deploying")
 
 			os.Exit(-2)
@@ -51,6 +160,8 @@ var deployCmd = &cobra.Command{
 
 		utils.HideProgress()
 
+		closeReportStream()
+
 		log.Info("Done")
 	},
 }
@@ -58,6 +169,7 @@ var deployCmd = &cobra.Command{
 func init() {
 	deployCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
 	deployCmd.Flags().UintVarP(&commandRetries, "command-retries", "r", 1200, "The number of command retries during the setup")
+	deployCmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "Skip the preflight checks of the nodes")
 	deployCmd.Flags().BoolVar(&skipSetup, "skip-setup", false, "Skip setup steps")
 	deployCmd.Flags().BoolVar(&skipUpload, "skip-upload", false, "Skip upload steps")
 	deployCmd.Flags().BoolVar(&skipRestart, "skip-restart", false, "Skip restart steps")
@@ -71,5 +183,17 @@ func init() {
 	deployCmd.Flags().BoolVar(&parallel, "parallel", false, "Run steps in parallel")
 	deployCmd.Flags().BoolVar(&forceUpload, "force-upload", false, "Files are uploaded without checking if they are already installed")
 	deployCmd.Flags().UintVar(&wait, "wait", 0, "Wait for all cluster relevant pods to be ready and jobs to be completed. The parameter reflects the number of seconds in which the pods have to run stable.")
+	deployCmd.Flags().StringVar(&knownHostsFile, "known-hosts", path.Join(os.Getenv("HOME"), ".ssh/known_hosts"), "SSH known hosts file. Hosts not listed in it are verified against the host keys recorded by k8s-tew on first use")
+	deployCmd.Flags().BoolVar(&acceptNewHostKeys, "accept-new-host-keys", false, "Accept and record host keys that changed since they were recorded by k8s-tew")
+	deployCmd.Flags().BoolVar(&rolling, "rolling", false, "Update a running cluster node by node: controllers one at a time, then the other nodes in batches. Each node is drained, updated and has to become healthy again before the next one is updated")
+	deployCmd.Flags().UintVar(&rollingBatchSize, "rolling-batch-size", utils.RollingBatchSize, "The number of non-controller nodes updated at the same time in rolling mode")
+	deployCmd.Flags().UintVar(&rollingTimeout, "rolling-timeout", utils.RollingTimeout, "The number of seconds a node has to become healthy after being updated in rolling mode")
+	deployCmd.Flags().BoolVar(&compressUploads, "compress-uploads", false, "Compress the uploaded files on the wire")
+	deployCmd.Flags().BoolVar(&deltaUploads, "delta-uploads", false, "Upload only the changed blocks of large files that already exist on the nodes")
+	deployCmd.Flags().UintVar(&parallelNodes, "parallel-nodes", utils.ParallelNodes, "The number of nodes the files are deployed to at the same time. Controllers are always deployed before the other nodes")
+	deployCmd.Flags().BoolVar(&plan, "plan", false, "Show the files, restarts, images and commands the deployment would apply per node and exit without changing anything")
+	deployCmd.Flags().StringVar(&planOutput, "plan-output", utils.OutputText, "Output format of the plan (text or json)")
+	deployCmd.Flags().StringVar(&reportStream, "report-stream", "", "Stream the steps of the deployment report as JSON lines to this file ('-' for stdout)")
+	deployCmd.Flags().BoolVar(&resume, "resume", false, "Continue a failed deployment from the first incomplete step, unless the config or the generated files changed since then")
 	RootCmd.AddCommand(deployCmd)
 }
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/darxkies/k8s-tew/pkg/config"
 	"github.com/darxkies/k8s-tew/pkg/utils"
 
 	log "github.com/sirupsen/logrus"
@@ -18,6 +19,13 @@ var nodeIndex uint
 var nodeStorageIndex uint
 var nodeLabels string
 var nodeSelf bool
+var nodeSSHUser string
+var nodeSSHPort uint16
+var nodeSSHIdentityFile string
+var nodeSSHAgent bool
+var nodeSSHSudo bool
+var nodeSSHJumpHosts string
+var nodeTransport string
 
 func addNode() error {
 	// Load config and check the rights
@@ -74,11 +82,32 @@ func addNode() error {
 		_config.Config.DeploymentDirectory = _config.BaseDirectory
 	}
 
+	if nodeTransport != utils.TransportSSH && nodeTransport != utils.TransportLocal {
+		return fmt.Errorf("unknown transport '%s' (expected %s or %s)", nodeTransport, utils.TransportSSH, utils.TransportLocal)
+	}
+
 	node, nodeName, error := _config.AddNode(nodeName, nodeIP, nodeIndex, nodeStorageIndex, labels)
 	if error != nil {
 		return error
 	}
 
+	// Override the SSH defaults of the cluster
+	if len(nodeSSHUser) > 0 || nodeSSHPort > 0 || len(nodeSSHIdentityFile) > 0 || nodeSSHAgent || nodeSSHSudo || len(nodeSSHJumpHosts) > 0 {
+		node.SSH = &config.SSHConfig{
+			User:         nodeSSHUser,
+			Port:         nodeSSHPort,
+			IdentityFile: nodeSSHIdentityFile,
+			Agent:        nodeSSHAgent,
+			Sudo:         nodeSSHSudo,
+			JumpHosts:    utils.SplitList(nodeSSHJumpHosts),
+		}
+	}
+
+	// SSH is the default and is therefore not stored
+	if nodeTransport != utils.TransportSSH {
+		node.Transport = nodeTransport
+	}
+
 	log.WithFields(log.Fields{"name": nodeName, "ip": node.IP, "index": node.Index, "storage-index": node.StorageIndex, "labels": node.Labels}).Info("Node added")
 
 	if error := _config.Save(); error != nil {
@@ -108,5 +137,12 @@ func init() {
 	nodeAddCmd.Flags().UintVarP(&nodeStorageIndex, "storage-index", "r", 0, "The unique index of the storage node which should never be reused; if it is already in use a new one is assigned")
 	nodeAddCmd.Flags().StringVarP(&nodeLabels, "labels", "l", fmt.Sprintf("%s,%s", utils.NodeController, utils.NodeWorker), "The labels of the node which define the attributes of the node")
 	nodeAddCmd.Flags().BoolVarP(&nodeSelf, "self", "s", false, "Add this machine by inferring the host's name & IP and by setting the labels controller,worker,bootstrapper - The public-network and the deployment-directory are also updated")
+	nodeAddCmd.Flags().StringVar(&nodeSSHUser, "ssh-user", "", "SSH user of the node (overrides the cluster default)")
+	nodeAddCmd.Flags().Uint16Var(&nodeSSHPort, "ssh-port", 0, "SSH port of the node (overrides the cluster default)")
+	nodeAddCmd.Flags().StringVar(&nodeSSHIdentityFile, "ssh-identity-file", "", "SSH identity file of the node (overrides the cluster default)")
+	nodeAddCmd.Flags().BoolVar(&nodeSSHAgent, "ssh-agent", false, "Authenticate against the node using the SSH agent")
+	nodeAddCmd.Flags().BoolVar(&nodeSSHSudo, "ssh-sudo", false, "Escalate the remote commands on the node using sudo")
+	nodeAddCmd.Flags().StringVar(&nodeTransport, "transport", utils.TransportSSH, "How the node is reached during deployment: ssh or local (the machine k8s-tew runs on)")
+	nodeAddCmd.Flags().StringVar(&nodeSSHJumpHosts, "ssh-jump-hosts", "", "SSH jump hosts of the node in the form [user@]host[:port] (comma separated)")
 	RootCmd.AddCommand(nodeAddCmd)
 }
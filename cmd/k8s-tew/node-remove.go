@@ -2,13 +2,17 @@ package main
 
 import (
 	"os"
+	"path"
 
+	"github.com/darxkies/k8s-tew/pkg/deployment"
+	"github.com/darxkies/k8s-tew/pkg/generate"
 	"github.com/darxkies/k8s-tew/pkg/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var removeNodeName string
+var decommission bool
 
 func removeNode() error {
 	// Load config and check the rights
@@ -16,7 +20,27 @@ func removeNode() error {
 		return error
 	}
 
-	utils.SetProgressSteps(1)
+	if !decommission {
+		utils.SetProgressSteps(1)
+
+		if error := _config.RemoveNode(removeNodeName); error != nil {
+			return error
+		}
+
+		log.WithFields(log.Fields{"name": removeNodeName}).Info("Node removed")
+
+		return _config.Save()
+	}
+
+	_deployment := deployment.NewDeployment(_config, deployment.DeploymentOptions{IdentityFile: identityFile, KnownHostsFile: knownHostsFile, AcceptNewHostKeys: acceptNewHostKeys, SkipSetup: true, SkipUpload: true, SkipPreflight: true})
+
+	utils.SetProgressSteps(deployment.DecommissionSteps())
+
+	utils.ShowProgress()
+
+	if error := _deployment.Decommission(removeNodeName); error != nil {
+		return error
+	}
 
 	if error := _config.RemoveNode(removeNodeName); error != nil {
 		return error
@@ -24,17 +48,34 @@ func removeNode() error {
 
 	log.WithFields(log.Fields{"name": removeNodeName}).Info("Node removed")
 
+	// Regenerate the certificates, the load balancer config and the manifests without the node
+	generator := generate.NewGenerator(_config)
+
+	utils.SetProgressSteps(1 + generator.Steps())
+
+	_config.Generate()
+
 	if error := _config.Save(); error != nil {
 		return error
 	}
 
+	utils.IncreaseProgressStep()
+
+	if error := generator.GenerateFiles(); error != nil {
+		return error
+	}
+
+	utils.HideProgress()
+
+	log.Info("Node decommissioned, run deploy to update the remaining nodes")
+
 	return nil
 }
 
 var nodeRemoveCmd = &cobra.Command{
 	Use:   "node-remove",
 	Short: "Remove a node",
-	Long:  "Remove a node",
+	Long:  "Remove a node from the config. With --decommission the node is also drained and removed from Kubernetes, etcd and Ceph, the service is removed from the node and the assets are regenerated.",
 	Run: func(cmd *cobra.Command, args []string) {
 		if error := removeNode(); error != nil {
 			log.WithFields(log.Fields{"error": error}).Error("Failed to remove node")
@@ -46,5 +87,9 @@ var nodeRemoveCmd = &cobra.Command{
 
 func init() {
 	nodeRemoveCmd.Flags().StringVarP(&removeNodeName, "name", "n", "", "Unique name of the node")
+	nodeRemoveCmd.Flags().BoolVar(&decommission, "decommission", false, "Drain the node, remove it from Kubernetes, etcd and Ceph, remove the service from the node and regenerate the assets")
+	nodeRemoveCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	nodeRemoveCmd.Flags().StringVar(&knownHostsFile, "known-hosts", path.Join(os.Getenv("HOME"), ".ssh/known_hosts"), "SSH known hosts file. Hosts not listed in it are verified against the host keys recorded by k8s-tew on first use")
+	nodeRemoveCmd.Flags().BoolVar(&acceptNewHostKeys, "accept-new-host-keys", false, "Accept and record host keys that changed since they were recorded by k8s-tew")
 	RootCmd.AddCommand(nodeRemoveCmd)
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/darxkies/k8s-tew/pkg/deployment"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var preflightOutput string
+
+var preflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Check if the nodes are ready to be deployed",
+	Long:  "Check the operating system, kernel modules, swap, ports, disk space, clock skew, cgroup version and hostname of all nodes over SSH. Failed checks block a deployment, warnings do not.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		if preflightOutput != utils.OutputText && preflightOutput != utils.OutputJSON {
+			log.WithFields(log.Fields{"error": fmt.Errorf("unknown output format '%s'", preflightOutput)}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		_deployment := deployment.NewDeployment(_config, deployment.DeploymentOptions{IdentityFile: identityFile, KnownHostsFile: knownHostsFile, AcceptNewHostKeys: acceptNewHostKeys, ImportImages: importImages, ForceUpload: forceUpload})
+
+		results := _deployment.Preflight()
+
+		_deployment.Close()
+
+		var error error
+
+		if preflightOutput == utils.OutputJSON {
+			error = results.WriteJSON(os.Stdout)
+		} else {
+			error = results.WriteTable(os.Stdout)
+		}
+
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed writing results")
+
+			os.Exit(-2)
+		}
+
+		if results.HasFailures() {
+			os.Exit(-3)
+		}
+	},
+}
+
+func init() {
+	preflightCmd.Flags().StringVar(&preflightOutput, "output", utils.OutputText, "Output format of the results (text or json)")
+	preflightCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	preflightCmd.Flags().StringVar(&knownHostsFile, "known-hosts", path.Join(os.Getenv("HOME"), ".ssh/known_hosts"), "SSH known hosts file. Hosts not listed in it are verified against the host keys recorded by k8s-tew on first use")
+	preflightCmd.Flags().BoolVar(&acceptNewHostKeys, "accept-new-host-keys", false, "Accept and record host keys that changed since they were recorded by k8s-tew")
+	preflightCmd.Flags().BoolVar(&forceUpload, "force-upload", false, "Calculate the required disk space as if all files were uploaded")
+	RootCmd.AddCommand(preflightCmd)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path"
+
+	"github.com/darxkies/k8s-tew/pkg/deployment"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var rollbackGeneration uint
+var rollbackNodes string
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore a previously deployed generation",
+	Long:  "Restore a previously deployed generation of the files on all or on the selected nodes and restart the service. By default the generation before the current one is restored.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		nodeNames := utils.SplitList(rollbackNodes)
+
+		_deployment := deployment.NewDeployment(_config, deployment.DeploymentOptions{IdentityFile: identityFile, KnownHostsFile: knownHostsFile, AcceptNewHostKeys: acceptNewHostKeys, SkipSetup: true, SkipUpload: true, SkipPreflight: true})
+
+		steps := len(nodeNames)
+
+		if steps == 0 {
+			steps = len(_config.Config.Nodes)
+		}
+
+		utils.SetProgressSteps(steps + 1)
+
+		utils.ShowProgress()
+
+		if error := _deployment.Rollback(nodeNames, rollbackGeneration); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed rolling back")
+
+			os.Exit(-2)
+		}
+
+		utils.HideProgress()
+
+		log.Info("Done")
+	},
+}
+
+func init() {
+	rollbackCmd.Flags().UintVar(&rollbackGeneration, "to", 0, "The generation to restore (default is the generation before the current one)")
+	rollbackCmd.Flags().StringVarP(&rollbackNodes, "nodes", "n", "", "The nodes to roll back (comma separated, default are all nodes)")
+	rollbackCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	rollbackCmd.Flags().StringVar(&knownHostsFile, "known-hosts", path.Join(os.Getenv("HOME"), ".ssh/known_hosts"), "SSH known hosts file. Hosts not listed in it are verified against the host keys recorded by k8s-tew on first use")
+	rollbackCmd.Flags().BoolVar(&acceptNewHostKeys, "accept-new-host-keys", false, "Accept and record host keys that changed since they were recorded by k8s-tew")
+	RootCmd.AddCommand(rollbackCmd)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/darxkies/k8s-tew/pkg/container"
 	"github.com/darxkies/k8s-tew/pkg/servers"
@@ -12,6 +13,8 @@ import (
 )
 
 var killContainers bool
+var apiTLS bool
+var shutdownTimeout uint
 
 var runCmd = &cobra.Command{
 	Use:   "run",
@@ -36,13 +39,13 @@ var runCmd = &cobra.Command{
 			os.Exit(-1)
 		}
 
-		serversContainer := servers.NewServers(_config)
+		serversContainer := servers.NewServers(_config, apiTLS)
 
 		utils.SetProgressSteps(serversContainer.Steps())
 
 		utils.ShowProgress()
 
-		if error := serversContainer.Run(commandRetries, func() {
+		if error := serversContainer.Run(commandRetries, time.Duration(shutdownTimeout)*time.Second, func() {
 			if killContainers {
 				pods := container.NewPods(_config)
 
@@ -61,5 +64,7 @@ var runCmd = &cobra.Command{
 func init() {
 	runCmd.Flags().UintVarP(&commandRetries, "command-retries", "r", 300, "The count of command retries")
 	runCmd.Flags().BoolVarP(&killContainers, "kill-containers", "k", true, "Kill containers when shutting down")
+	runCmd.Flags().BoolVar(&apiTLS, "api-tls", false, "Require TLS with client certificates signed by the cluster CA on the API socket")
+	runCmd.Flags().UintVar(&shutdownTimeout, "shutdown-timeout", utils.ShutdownTimeout, "The seconds after which the shutdown, including cordoning, draining and stopping the servers, is forced")
 	RootCmd.AddCommand(runCmd)
 }
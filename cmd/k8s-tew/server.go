@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+
+	"github.com/darxkies/k8s-tew/pkg/servers"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func controlServer(name string, action func(client *servers.APIClient, name string) (*servers.ServerStatus, error)) {
+	if error := bootstrap(true); error != nil {
+		log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+		os.Exit(-1)
+	}
+
+	client, error := servers.NewAPIClient(_config, statusTLS)
+	if error != nil {
+		log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+		os.Exit(-1)
+	}
+
+	status, error := action(client, name)
+	if error != nil {
+		log.WithFields(log.Fields{"name": name, "error": error}).Error("Failed controlling server")
+
+		os.Exit(-2)
+	}
+
+	log.WithFields(log.Fields{"name": status.Name, "state": status.State, "pid": status.PID}).Info("Server")
+}
+
+var serverCmd = &cobra.Command{
+	Use:   "server",
+	Short: "Control the local servers",
+	Long:  "Start, stop or restart individual servers supervised by 'k8s-tew run' on this host",
+}
+
+var serverStartCmd = &cobra.Command{
+	Use:   "start <name>",
+	Short: "Start a stopped server",
+	Long:  "Start a server that was stopped using 'k8s-tew server stop'",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		controlServer(args[0], (*servers.APIClient).StartServer)
+	},
+}
+
+var serverStopCmd = &cobra.Command{
+	Use:   "stop <name>",
+	Short: "Stop a server",
+	Long:  "Stop a server until it is started again or 'k8s-tew run' is restarted",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		controlServer(args[0], (*servers.APIClient).StopServer)
+	},
+}
+
+var serverRestartCmd = &cobra.Command{
+	Use:   "restart <name>",
+	Short: "Restart a server",
+	Long:  "Stop and start a server",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		controlServer(args[0], (*servers.APIClient).RestartServer)
+	},
+}
+
+func init() {
+	serverCmd.PersistentFlags().BoolVar(&statusTLS, "tls", false, "Connect using TLS, required if 'k8s-tew run' was started with --api-tls")
+	serverCmd.AddCommand(serverStartCmd)
+	serverCmd.AddCommand(serverStopCmd)
+	serverCmd.AddCommand(serverRestartCmd)
+	RootCmd.AddCommand(serverCmd)
+}
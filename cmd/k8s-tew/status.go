@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/darxkies/k8s-tew/pkg/servers"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var statusOutput string
+var statusTLS bool
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of the local servers",
+	Long:  "Show the state, PID, uptime, restarts, last exit and log file of each server supervised by 'k8s-tew run' on this host, as well as the progress of the setup commands",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(true); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		if statusOutput != utils.OutputText && statusOutput != utils.OutputJSON {
+			log.WithFields(log.Fields{"error": fmt.Errorf("unknown output format '%s'", statusOutput)}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		client, error := servers.NewAPIClient(_config, statusTLS)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		status, error := client.GetStatus()
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed getting status")
+
+			os.Exit(-2)
+		}
+
+		if statusOutput == utils.OutputJSON {
+			error = status.WriteJSON(os.Stdout)
+		} else {
+			error = status.WriteTable(os.Stdout)
+		}
+
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed writing status")
+
+			os.Exit(-2)
+		}
+	},
+}
+
+func init() {
+	statusCmd.Flags().StringVar(&statusOutput, "output", utils.OutputText, "Output format of the status (text or json)")
+	statusCmd.Flags().BoolVar(&statusTLS, "tls", false, "Connect using TLS, required if 'k8s-tew run' was started with --api-tls")
+	RootCmd.AddCommand(statusCmd)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/pkg/generate"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var userName string
+var userGroup string
+var userOIDC bool
+var userOIDCClientSecret string
+var userOIDCExtraScopes string
+var userKubeconfig string
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage cluster users",
+	Long:  "Manage cluster users",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("Missing sub-command")
+	},
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Generate a kubeconfig for a user",
+	Long:  "Generate a kubeconfig for a user. By default a client certificate signed by the cluster CA is used. With --oidc the kubeconfig authenticates against the configured OIDC issuer using the kubectl oidc-login exec plugin instead.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Load config and check the rights
+		if error := bootstrap(false); error != nil {
+			return error
+		}
+
+		userName = strings.Trim(userName, " \n")
+
+		if error := generate.ValidateUserName(userName); error != nil {
+			return error
+		}
+
+		kubeconfig := userKubeconfig
+
+		if len(kubeconfig) == 0 {
+			kubeconfig = path.Join(_config.GetFullLocalAssetDirectory(utils.DirectoryK8sKubeConfig), fmt.Sprintf(utils.KubeconfigUser, userName))
+		}
+
+		generator := generate.NewGenerator(_config)
+
+		if userOIDC {
+			if error := generator.GenerateUserOIDCKubeConfig(userName, userOIDCClientSecret, utils.SplitList(userOIDCExtraScopes), kubeconfig); error != nil {
+				return error
+			}
+
+		} else {
+			if error := generator.GenerateUserKubeConfig(userName, userGroup, kubeconfig); error != nil {
+				return error
+			}
+		}
+
+		log.WithFields(log.Fields{"name": userName, "oidc": userOIDC, "kubeconfig": kubeconfig}).Info("User added")
+
+		return nil
+	},
+}
+
+func init() {
+	userAddCmd.Flags().StringVarP(&userName, "name", "n", "", "Name of the user")
+	userAddCmd.Flags().StringVarP(&userGroup, "group", "g", "", "Group of the user, used as the organization of the client certificate")
+	userAddCmd.Flags().BoolVar(&userOIDC, "oidc", false, "Generate an exec-plugin kubeconfig that authenticates against the configured OIDC issuer instead of a client certificate")
+	userAddCmd.Flags().StringVar(&userOIDCClientSecret, "oidc-client-secret", "", "OIDC client secret, if the identity provider requires one")
+	userAddCmd.Flags().StringVar(&userOIDCExtraScopes, "oidc-extra-scopes", "email,groups", "Additional OIDC scopes to request (comma separated)")
+	userAddCmd.Flags().StringVarP(&userKubeconfig, "kubeconfig", "k", "", "Filename of the generated kubeconfig (default is the kubeconfig directory)")
+
+	userCmd.AddCommand(userAddCmd)
+
+	RootCmd.AddCommand(userCmd)
+}
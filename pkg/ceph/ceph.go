@@ -489,6 +489,11 @@ func (ceph *Ceph) RunSetup(dashboardUsername, dashboardPassword, radosgwUsername
 	return nil
 }
 
+// GetCommand returns the ceph command line with the admin credentials for the arguments
+func (ceph *Ceph) GetCommand(arguments string) string {
+	return fmt.Sprintf("%s %s", ceph.getCephBinary(), arguments)
+}
+
 func (ceph *Ceph) getPublicAddressBinary(binary, publicAddress string) string {
 	if len(publicAddress) > 0 {
 		binary = fmt.Sprintf("%s --public-addr %s", binary, publicAddress)
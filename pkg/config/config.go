@@ -16,6 +16,7 @@ type Config struct {
 	VIPRaftWorkerPort            uint16      `yaml:"vip-raft-worker-port"`
 	KubernetesDashboardPort      uint16      `yaml:"kubernetes-dashboard-port"`
 	APIServerPort                uint16      `yaml:"apiserver-port,omitempty"`
+	MetricsPort                  uint16      `yaml:"metrics-port,omitempty"`
 	PublicNetwork                string      `yaml:"public-network"`
 	ControllerVirtualIP          string      `yaml:"controller-virtual-ip,omitempty"`
 	ControllerVirtualIPInterface string      `yaml:"controller-virtual-ip-interface,omitempty"`
@@ -47,6 +48,11 @@ type Config struct {
 	AlertManagerSize             uint16      `yaml:"alert-manager-size"`
 	KubeStateMetricsCount        uint16      `yaml:"kube-state-metrics-count"`
 	DrainGracePeriodSeconds      uint16      `yaml:"drain-grace-period-seconds"`
+	GenerationRetention          uint16      `yaml:"generation-retention"`
+	EtcdClusterState             string      `yaml:"etcd-cluster-state"`
+	EtcdMembers                  []string    `yaml:"etcd-members,omitempty"`
+	OIDC                         OIDCConfig  `yaml:"oidc,omitempty"`
+	SSH                          SSHConfig   `yaml:"ssh,omitempty"`
 	Versions                     Versions    `yaml:"versions"`
 	Assets                       AssetConfig `yaml:"assets,omitempty"`
 	Nodes                        Nodes       `yaml:"nodes"`
@@ -66,6 +72,7 @@ func NewConfig() *Config {
 	config.LoadBalancerPort = utils.PortLoadBalancer
 	config.KubernetesDashboardPort = utils.PortKubernetesDashboard
 	config.APIServerPort = utils.PortApiServer
+	config.MetricsPort = utils.PortMetrics
 	config.PublicNetwork = utils.PublicNetwork
 	config.ClusterDomain = utils.ClusterDomain
 	config.ClusterIPRange = utils.ClusterIpRange
@@ -91,6 +98,9 @@ func NewConfig() *Config {
 	config.AlertManagerSize = utils.AlertManagerSize
 	config.KubeStateMetricsCount = utils.KubeStateMetricsCount
 	config.DrainGracePeriodSeconds = utils.DrainGracePeriodSeconds
+	config.GenerationRetention = utils.GenerationRetention
+	config.EtcdClusterState = utils.EtcdClusterStateNew
+	config.OIDC = OIDCConfig{UsernameClaim: utils.OIDCUsernameClaim, GroupsClaim: utils.OIDCGroupsClaim}
 	config.Versions = NewVersions()
 	config.Assets = AssetConfig{Directories: map[string]*AssetDirectory{}, Files: map[string]*AssetFile{}}
 	config.Nodes = Nodes{}
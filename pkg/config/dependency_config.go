@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+type DependencyConfig struct {
+	Name      string `yaml:"name"`
+	Condition string `yaml:"condition,omitempty"`
+}
+
+// GetCondition returns what the dependency has to reach before the server is started
+func (config DependencyConfig) GetCondition() string {
+	if len(config.Condition) == 0 {
+		return utils.DependencyConditionReady
+	}
+
+	return config.Condition
+}
+
+func (config DependencyConfig) Validate() error {
+	if len(config.Name) == 0 {
+		return fmt.Errorf("Missing name of dependency")
+	}
+
+	switch config.GetCondition() {
+	case utils.DependencyConditionStarted, utils.DependencyConditionReady:
+	default:
+		return fmt.Errorf("Unknown condition '%s' of dependency '%s'", config.Condition, config.Name)
+	}
+
+	return nil
+}
@@ -238,6 +238,7 @@ func (config *InternalConfig) registerAssetFiles() {
 	config.addAssetFile(utils.PemPrometheusKey, Labels{}, "", utils.DirectoryCertificates)
 	config.addAssetFile(utils.PemKubernetesDashboard, Labels{}, "", utils.DirectoryCertificates)
 	config.addAssetFile(utils.PemKubernetesDashboardKey, Labels{}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemOIDCCa, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
 
 	// Kubeconfig
 	config.addAssetFile(utils.KubeconfigAdmin, Labels{utils.NodeController, utils.NodeWorker, utils.NodeStorage}, "", utils.DirectoryK8sKubeConfig)
@@ -252,6 +253,7 @@ func (config *InternalConfig) registerAssetFiles() {
 	// CRI
 	config.addAssetFile(utils.ContainerdConfig, Labels{utils.NodeController, utils.NodeWorker, utils.NodeStorage}, "", utils.DirectoryCriConfig)
 	config.addAssetFile(utils.ContainerdSock, Labels{}, "", utils.DirectoryAbsoluteContainerdState)
+	config.addAssetFile(utils.ControlSocket, Labels{}, "", utils.DirectoryVarRun)
 
 	// Service
 	config.addAssetFile(utils.ServiceConfig, Labels{utils.NodeController, utils.NodeWorker, utils.NodeStorage}, "", utils.DirectoryService)
@@ -334,14 +336,14 @@ func (config *InternalConfig) registerServers() {
 	// Servers
 	config.addServer(utils.ContainerdServerName, Labels{utils.NodeController, utils.NodeWorker, utils.NodeStorage}, config.GetTemplateAssetFilename(utils.BinaryContainerd), map[string]string{
 		"config": config.GetTemplateAssetFilename(utils.ContainerdConfig),
-	})
+	}, nil, &ProbeConfig{Type: utils.ProbeTypeGRPC, Target: "unix://" + config.GetTemplateAssetFilename(utils.ContainerdSock), Period: 1}, nil)
 
 	config.addServer("kubelet", Labels{utils.NodeController, utils.NodeWorker, utils.NodeStorage}, config.GetTemplateAssetFilename(utils.BinaryKubelet), map[string]string{
 		"config":     config.GetTemplateAssetFilename(utils.K8sKubeletConfig),
 		"kubeconfig": config.GetTemplateAssetFilename(utils.KubeconfigKubelet),
 		"root-dir":   config.GetTemplateAssetDirectory(utils.DirectoryKubeletData),
 		"v":          "0",
-	})
+	}, &ProbeConfig{Type: utils.ProbeTypeHTTP, Target: utils.KubeletHealthzURL, InitialDelay: 60}, nil, []DependencyConfig{{Name: utils.ContainerdServerName}})
 }
 
 func (config *InternalConfig) registerCommands() {
@@ -402,15 +404,25 @@ func (config *InternalConfig) Generate() {
 	config.registerServers()
 }
 
-func (config *InternalConfig) addServer(name string, labels []string, command string, arguments map[string]string) {
+func (config *InternalConfig) addServer(name string, labels []string, command string, arguments map[string]string, liveness, readiness *ProbeConfig, dependsOn []DependencyConfig) {
 	// Do not add if already in the list
-	for _, server := range config.Config.Servers {
-		if server.Name == name {
-			return
+	for index := range config.Config.Servers {
+		server := &config.Config.Servers[index]
+
+		if server.Name != name {
+			continue
+		}
+
+		// Configurations created before the probes were introduced get the default ones
+		if server.Liveness == nil && server.Readiness == nil {
+			server.Liveness = liveness
+			server.Readiness = readiness
 		}
+
+		return
 	}
 
-	config.Config.Servers = append(config.Config.Servers, ServerConfig{Name: name, Enabled: true, Labels: labels, Command: command, Arguments: arguments, Logger: LoggerConfig{Enabled: true, Filename: path.Join(config.GetTemplateAssetDirectory(utils.DirectoryLogging), name+".log")}})
+	config.Config.Servers = append(config.Config.Servers, ServerConfig{Name: name, Enabled: true, Labels: labels, Command: command, Arguments: arguments, Logger: LoggerConfig{Enabled: true, Filename: path.Join(config.GetTemplateAssetDirectory(utils.DirectoryLogging), name+".log"), Compress: true}, Liveness: liveness, Readiness: readiness, DependsOn: dependsOn})
 }
 
 func (config *InternalConfig) addCommand(name string, labels Labels, features Features, os OS, command string) {
@@ -604,7 +616,18 @@ func (config *InternalConfig) AddNode(name string, ip string, index uint, storag
 		storageIndex++
 	}
 
-	config.Config.Nodes[name] = NewNode(ip, index, storageIndex, labels)
+	node := NewNode(ip, index, storageIndex, labels)
+
+	// Keep the SSH settings and the recorded host key if the node is only updated
+	if oldNode, ok := config.Config.Nodes[name]; ok {
+		node.SSH = oldNode.SSH
+
+		if oldNode.IP == ip {
+			node.HostKey = oldNode.HostKey
+		}
+	}
+
+	config.Config.Nodes[name] = node
 
 	return config.Config.Nodes[name], name, nil
 }
@@ -621,6 +644,7 @@ func (config *InternalConfig) GetETCDClientEndpoints() []string {
 	return result
 }
 
+// GetEtcdCluster returns the initial cluster of etcd. Once the cluster exists, a joining controller only lists the current members and itself.
 func (config *InternalConfig) GetEtcdCluster() string {
 	list := []string{}
 
@@ -629,6 +653,10 @@ func (config *InternalConfig) GetEtcdCluster() string {
 			continue
 		}
 
+		if config.Config.EtcdClusterState == utils.EtcdClusterStateExisting && name != config.Name && !config.IsEtcdMember(name) {
+			continue
+		}
+
 		list = append(list, fmt.Sprintf("%s=https://%s:2380", name, node.IP))
 	}
 
@@ -637,6 +665,25 @@ func (config *InternalConfig) GetEtcdCluster() string {
 	return strings.Join(list, ",")
 }
 
+// IsEtcdMember returns true if the controller joined the etcd cluster
+func (config *InternalConfig) IsEtcdMember(name string) bool {
+	for _, member := range config.Config.EtcdMembers {
+		if member == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetEtcdMembers records the members of the existing etcd cluster
+func (config *InternalConfig) SetEtcdMembers(names []string) {
+	sort.Strings(names)
+
+	config.Config.EtcdClusterState = utils.EtcdClusterStateExisting
+	config.Config.EtcdMembers = names
+}
+
 func (config *InternalConfig) GetEtcdServers() string {
 	list := config.GetETCDClientEndpoints()
 
@@ -704,6 +751,16 @@ func (config *InternalConfig) GetAPIServerIP() (string, error) {
 	return "", errors.New("No API Server IP found")
 }
 
+// GetMetricsPort returns the port of the metrics exposed by 'k8s-tew run'. Configurations created before the port was
+// introduced fall back to the default.
+func (config *InternalConfig) GetMetricsPort() uint16 {
+	if config.Config.MetricsPort == 0 {
+		return utils.PortMetrics
+	}
+
+	return config.Config.MetricsPort
+}
+
 func (config *InternalConfig) GetWorkerIP() (string, error) {
 	if len(config.Config.WorkerVirtualIP) > 0 {
 		return config.Config.WorkerVirtualIP, nil
@@ -1,6 +1,50 @@
 package config
 
+import "github.com/darxkies/k8s-tew/pkg/utils"
+
 type LoggerConfig struct {
-	Enabled  bool   `yaml:"enabled"`
-	Filename string `yaml:"filename"`
+	Enabled        bool   `yaml:"enabled"`
+	Filename       string `yaml:"filename"`
+	MaximumSize    uint   `yaml:"maximum-size,omitempty"`
+	MaximumAge     uint   `yaml:"maximum-age,omitempty"`
+	MaximumBackups uint   `yaml:"maximum-backups,omitempty"`
+	Retention      uint   `yaml:"retention,omitempty"`
+	Compress       bool   `yaml:"compress,omitempty"`
+	Journald       bool   `yaml:"journald,omitempty"`
+}
+
+// GetMaximumSize returns the size in MiB after which the log file is rotated
+func (config LoggerConfig) GetMaximumSize() uint {
+	if config.MaximumSize == 0 {
+		return utils.LogMaximumSize
+	}
+
+	return config.MaximumSize
+}
+
+// GetMaximumAge returns the hours after which the log file is rotated
+func (config LoggerConfig) GetMaximumAge() uint {
+	if config.MaximumAge == 0 {
+		return utils.LogMaximumAge
+	}
+
+	return config.MaximumAge
+}
+
+// GetMaximumBackups returns the number of rotated log files that are kept
+func (config LoggerConfig) GetMaximumBackups() uint {
+	if config.MaximumBackups == 0 {
+		return utils.LogMaximumBackups
+	}
+
+	return config.MaximumBackups
+}
+
+// GetRetention returns the days after which rotated log files are removed
+func (config LoggerConfig) GetRetention() uint {
+	if config.Retention == 0 {
+		return utils.LogRetention
+	}
+
+	return config.Retention
 }
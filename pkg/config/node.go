@@ -3,10 +3,13 @@ package config
 import "github.com/darxkies/k8s-tew/pkg/utils"
 
 type Node struct {
-	IP           string `yaml:"ip"`
-	Index        uint   `yaml:"index"`
-	StorageIndex uint   `yaml:"storage-index,omitempty"`
-	Labels       Labels `yaml:"labels"`
+	IP           string     `yaml:"ip"`
+	Index        uint       `yaml:"index"`
+	StorageIndex uint       `yaml:"storage-index,omitempty"`
+	Labels       Labels     `yaml:"labels"`
+	HostKey      string     `yaml:"host-key,omitempty"`
+	SSH          *SSHConfig `yaml:"ssh,omitempty"`
+	Transport    string     `yaml:"transport,omitempty"`
 }
 
 type Nodes map[string]*Node
@@ -0,0 +1,17 @@
+package config
+
+type OIDCConfig struct {
+	IssuerURL     string `yaml:"issuer-url,omitempty"`
+	ClientID      string `yaml:"client-id,omitempty"`
+	UsernameClaim string `yaml:"username-claim,omitempty"`
+	GroupsClaim   string `yaml:"groups-claim,omitempty"`
+	CAFile        string `yaml:"ca-file,omitempty"`
+}
+
+func (config OIDCConfig) IsEnabled() bool {
+	return len(config.IssuerURL) > 0 && len(config.ClientID) > 0
+}
+
+func (config OIDCConfig) HasCA() bool {
+	return config.IsEnabled() && len(config.CAFile) > 0
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+type ProbeConfig struct {
+	Type             string `yaml:"type"`
+	Target           string `yaml:"target"`
+	InitialDelay     uint   `yaml:"initial-delay,omitempty"`
+	Period           uint   `yaml:"period,omitempty"`
+	Timeout          uint   `yaml:"timeout,omitempty"`
+	FailureThreshold uint   `yaml:"failure-threshold,omitempty"`
+	SuccessThreshold uint   `yaml:"success-threshold,omitempty"`
+}
+
+// GetPeriod returns the seconds between two probes
+func (config *ProbeConfig) GetPeriod() uint {
+	if config.Period == 0 {
+		return utils.ProbePeriod
+	}
+
+	return config.Period
+}
+
+// GetTimeout returns the seconds after which a probe fails
+func (config *ProbeConfig) GetTimeout() uint {
+	if config.Timeout == 0 {
+		return utils.ProbeTimeout
+	}
+
+	return config.Timeout
+}
+
+// GetFailureThreshold returns the number of consecutive failures after which the probe is considered failed
+func (config *ProbeConfig) GetFailureThreshold() uint {
+	if config.FailureThreshold == 0 {
+		return utils.ProbeFailureThreshold
+	}
+
+	return config.FailureThreshold
+}
+
+// GetSuccessThreshold returns the number of consecutive successes after which the probe is considered successful
+func (config *ProbeConfig) GetSuccessThreshold() uint {
+	if config.SuccessThreshold == 0 {
+		return utils.ProbeSuccessThreshold
+	}
+
+	return config.SuccessThreshold
+}
+
+func (config *ProbeConfig) Validate() error {
+	switch config.Type {
+	case utils.ProbeTypeHTTP, utils.ProbeTypeHTTPS, utils.ProbeTypeGRPC, utils.ProbeTypeUnix, utils.ProbeTypeExec:
+	default:
+		return fmt.Errorf("Unknown probe type '%s'", config.Type)
+	}
+
+	if len(config.Target) == 0 {
+		return fmt.Errorf("Missing target of %s probe", config.Type)
+	}
+
+	return nil
+}
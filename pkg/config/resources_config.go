@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// IOLimitConfig limits the bandwidth and the operations per second on a block device
+type IOLimitConfig struct {
+	Device    string `yaml:"device"`
+	ReadBPS   uint64 `yaml:"read-bps,omitempty"`
+	WriteBPS  uint64 `yaml:"write-bps,omitempty"`
+	ReadIOPS  uint64 `yaml:"read-iops,omitempty"`
+	WriteIOPS uint64 `yaml:"write-iops,omitempty"`
+}
+
+// ResourcesConfig limits the resources of a server. CPU and memory use the Kubernetes quantity notation (e.g. 500m, 2Gi).
+type ResourcesConfig struct {
+	CPU            string          `yaml:"cpu,omitempty"`
+	CPUWeight      uint            `yaml:"cpu-weight,omitempty"`
+	Memory         string          `yaml:"memory,omitempty"`
+	MemoryHigh     string          `yaml:"memory-high,omitempty"`
+	IOWeight       uint            `yaml:"io-weight,omitempty"`
+	IO             []IOLimitConfig `yaml:"io,omitempty"`
+	OOMScoreAdjust *int            `yaml:"oom-score-adjust,omitempty"`
+}
+
+// HasLimits returns true if the server has to be placed in its own cgroup
+func (config *ResourcesConfig) HasLimits() bool {
+	if config == nil {
+		return false
+	}
+
+	return len(config.CPU) > 0 || config.CPUWeight > 0 || len(config.Memory) > 0 || len(config.MemoryHigh) > 0 || config.IOWeight > 0 || len(config.IO) > 0
+}
+
+// GetCPU returns the CPU limit in millicores or 0 if not set
+func (config *ResourcesConfig) GetCPU() (int64, error) {
+	if config == nil || len(config.CPU) == 0 {
+		return 0, nil
+	}
+
+	quantity, _error := resource.ParseQuantity(config.CPU)
+	if _error != nil {
+		return 0, fmt.Errorf("Invalid CPU limit '%s' (%s)", config.CPU, _error)
+	}
+
+	return quantity.MilliValue(), nil
+}
+
+// GetMemory returns the hard memory limit in bytes or 0 if not set
+func (config *ResourcesConfig) GetMemory() (int64, error) {
+	if config == nil {
+		return 0, nil
+	}
+
+	return parseMemory("memory limit", config.Memory)
+}
+
+// GetMemoryHigh returns the memory in bytes above which the server is throttled or 0 if not set
+func (config *ResourcesConfig) GetMemoryHigh() (int64, error) {
+	if config == nil {
+		return 0, nil
+	}
+
+	return parseMemory("memory high", config.MemoryHigh)
+}
+
+func parseMemory(label, value string) (int64, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	quantity, _error := resource.ParseQuantity(value)
+	if _error != nil {
+		return 0, fmt.Errorf("Invalid %s '%s' (%s)", label, value, _error)
+	}
+
+	return quantity.Value(), nil
+}
+
+func (config *ResourcesConfig) Validate() error {
+	if config == nil {
+		return nil
+	}
+
+	if cpu, _error := config.GetCPU(); _error != nil {
+		return _error
+
+	} else if len(config.CPU) > 0 && cpu <= 0 {
+		return fmt.Errorf("CPU limit '%s' has to be positive", config.CPU)
+	}
+
+	if memory, _error := config.GetMemory(); _error != nil {
+		return _error
+
+	} else if len(config.Memory) > 0 && memory <= 0 {
+		return fmt.Errorf("Memory limit '%s' has to be positive", config.Memory)
+	}
+
+	if memoryHigh, _error := config.GetMemoryHigh(); _error != nil {
+		return _error
+
+	} else if len(config.MemoryHigh) > 0 && memoryHigh <= 0 {
+		return fmt.Errorf("Memory high '%s' has to be positive", config.MemoryHigh)
+	}
+
+	if config.CPUWeight > 10000 {
+		return fmt.Errorf("CPU weight %d is not between 1 and 10000", config.CPUWeight)
+	}
+
+	if config.IOWeight > 10000 {
+		return fmt.Errorf("IO weight %d is not between 1 and 10000", config.IOWeight)
+	}
+
+	for _, limit := range config.IO {
+		if len(limit.Device) == 0 {
+			return fmt.Errorf("Missing device of IO limit")
+		}
+	}
+
+	if config.OOMScoreAdjust != nil && (*config.OOMScoreAdjust < -1000 || *config.OOMScoreAdjust > 1000) {
+		return fmt.Errorf("OOM score adjustment %d is not between -1000 and 1000", *config.OOMScoreAdjust)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+type RestartConfig struct {
+	Policy          string `yaml:"policy,omitempty"`
+	InitialBackoff  uint   `yaml:"initial-backoff,omitempty"`
+	MaximumBackoff  uint   `yaml:"maximum-backoff,omitempty"`
+	MaximumRestarts uint   `yaml:"maximum-restarts,omitempty"`
+	Window          uint   `yaml:"window,omitempty"`
+}
+
+func (config *RestartConfig) GetPolicy() string {
+	if config == nil || len(config.Policy) == 0 {
+		return utils.RestartPolicyAlways
+	}
+
+	return config.Policy
+}
+
+// GetInitialBackoff returns the seconds to wait before the first restart
+func (config *RestartConfig) GetInitialBackoff() uint {
+	if config == nil || config.InitialBackoff == 0 {
+		return utils.RestartInitialBackoff
+	}
+
+	return config.InitialBackoff
+}
+
+// GetMaximumBackoff returns the seconds the doubled backoff is capped at
+func (config *RestartConfig) GetMaximumBackoff() uint {
+	if config == nil || config.MaximumBackoff == 0 {
+		return utils.RestartMaximumBackoff
+	}
+
+	return config.MaximumBackoff
+}
+
+// GetMaximumRestarts returns the number of restarts within the window after which the server is considered crash looping
+func (config *RestartConfig) GetMaximumRestarts() uint {
+	if config == nil || config.MaximumRestarts == 0 {
+		return utils.RestartMaximumRestarts
+	}
+
+	return config.MaximumRestarts
+}
+
+// GetWindow returns the seconds in which the restarts are counted
+func (config *RestartConfig) GetWindow() uint {
+	if config == nil || config.Window == 0 {
+		return utils.RestartWindow
+	}
+
+	return config.Window
+}
+
+func (config *RestartConfig) Validate() error {
+	switch config.GetPolicy() {
+	case utils.RestartPolicyAlways, utils.RestartPolicyOnFailure, utils.RestartPolicyNever:
+	default:
+		return fmt.Errorf("Unknown restart policy '%s'", config.GetPolicy())
+	}
+
+	if config.GetInitialBackoff() > config.GetMaximumBackoff() {
+		return fmt.Errorf("Initial backoff %d is greater than maximum backoff %d", config.GetInitialBackoff(), config.GetMaximumBackoff())
+	}
+
+	return nil
+}
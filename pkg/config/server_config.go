@@ -5,13 +5,19 @@ import (
 )
 
 type ServerConfig struct {
-	Name        string            `yaml:"name"`
-	Enabled     bool              `yaml:"enabled"`
-	Labels      Labels            `yaml:"labels"`
-	Logger      LoggerConfig      `yaml:"logger"`
-	Command     string            `yaml:"command"`
-	Arguments   map[string]string `yaml:"arguments"`
-	Environment map[string]string `yaml:"environment"`
+	Name        string             `yaml:"name"`
+	Enabled     bool               `yaml:"enabled"`
+	Labels      Labels             `yaml:"labels"`
+	Logger      LoggerConfig       `yaml:"logger"`
+	Command     string             `yaml:"command"`
+	Arguments   map[string]string  `yaml:"arguments"`
+	Environment map[string]string  `yaml:"environment"`
+	DependsOn   []DependencyConfig `yaml:"depends-on,omitempty"`
+	Restart     *RestartConfig     `yaml:"restart,omitempty"`
+	Stop        *StopConfig        `yaml:"stop,omitempty"`
+	Liveness    *ProbeConfig       `yaml:"liveness,omitempty"`
+	Readiness   *ProbeConfig       `yaml:"readiness,omitempty"`
+	Resources   *ResourcesConfig   `yaml:"resources,omitempty"`
 }
 
 type Servers []ServerConfig
@@ -19,6 +25,26 @@ type Servers []ServerConfig
 func (config ServerConfig) Dump() {
 	log.WithFields(log.Fields{"name": config.Name, "labels": config.Labels, "command": config.Command}).Info("Config server")
 
+	for _, dependency := range config.DependsOn {
+		log.WithFields(log.Fields{"name": config.Name, "dependency": dependency.Name, "condition": dependency.GetCondition()}).Info("Config server dependency")
+	}
+
+	log.WithFields(log.Fields{"name": config.Name, "policy": config.Restart.GetPolicy(), "initial-backoff": config.Restart.GetInitialBackoff(), "maximum-backoff": config.Restart.GetMaximumBackoff(), "maximum-restarts": config.Restart.GetMaximumRestarts(), "window": config.Restart.GetWindow()}).Info("Config server restart")
+
+	log.WithFields(log.Fields{"name": config.Name, "signal": config.Stop.GetSignal(), "grace-period": config.Stop.GetGracePeriod()}).Info("Config server stop")
+
+	if config.Liveness != nil {
+		log.WithFields(log.Fields{"name": config.Name, "type": config.Liveness.Type, "target": config.Liveness.Target}).Info("Config server liveness probe")
+	}
+
+	if config.Readiness != nil {
+		log.WithFields(log.Fields{"name": config.Name, "type": config.Readiness.Type, "target": config.Readiness.Target}).Info("Config server readiness probe")
+	}
+
+	if config.Resources != nil {
+		log.WithFields(log.Fields{"name": config.Name, "cpu": config.Resources.CPU, "cpu-weight": config.Resources.CPUWeight, "memory": config.Resources.Memory, "memory-high": config.Resources.MemoryHigh, "io-weight": config.Resources.IOWeight, "io": len(config.Resources.IO)}).Info("Config server resources")
+	}
+
 	for key, value := range config.Arguments {
 		log.WithFields(log.Fields{"name": config.Name, "argument": key, "value": value}).Info("Config server argument")
 	}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+type SSHConfig struct {
+	User         string            `yaml:"user,omitempty"`
+	Port         uint16            `yaml:"port,omitempty"`
+	IdentityFile string            `yaml:"identity-file,omitempty"`
+	Agent        bool              `yaml:"agent,omitempty"`
+	Sudo         bool              `yaml:"sudo,omitempty"`
+	JumpHosts    []string          `yaml:"jump-hosts,omitempty"`
+	HostKeys     map[string]string `yaml:"host-keys,omitempty"`
+}
+
+// Merge returns a copy of the settings overridden by the non-empty values of other
+func (config SSHConfig) Merge(other *SSHConfig) SSHConfig {
+	result := config
+
+	if other == nil {
+		return result
+	}
+
+	if len(other.User) > 0 {
+		result.User = other.User
+	}
+
+	if other.Port > 0 {
+		result.Port = other.Port
+	}
+
+	if len(other.IdentityFile) > 0 {
+		result.IdentityFile = other.IdentityFile
+	}
+
+	if other.Agent {
+		result.Agent = true
+	}
+
+	if other.Sudo {
+		result.Sudo = true
+	}
+
+	if len(other.JumpHosts) > 0 {
+		result.JumpHosts = other.JumpHosts
+	}
+
+	return result
+}
+
+func (config SSHConfig) GetUser() string {
+	if len(config.User) == 0 {
+		return utils.DeploymentUser
+	}
+
+	return config.User
+}
+
+func (config SSHConfig) GetPort() uint16 {
+	if config.Port == 0 {
+		return utils.PortSSH
+	}
+
+	return config.Port
+}
+
+// UseSudo returns true if commands have to be escalated because the user is not root
+func (config SSHConfig) UseSudo() bool {
+	return config.Sudo && config.GetUser() != utils.DeploymentUser
+}
+
+func (config SSHConfig) GetAddress(ip string) string {
+	return net.JoinHostPort(ip, strconv.Itoa(int(config.GetPort())))
+}
+
+type JumpHost struct {
+	User    string
+	Address string
+}
+
+// GetJumpHosts parses the jump hosts, which are in the form [user@]host[:port] like OpenSSH's ProxyJump
+func (config SSHConfig) GetJumpHosts() ([]JumpHost, error) {
+	result := []JumpHost{}
+
+	for _, entry := range config.JumpHosts {
+		entry = strings.TrimSpace(entry)
+
+		if len(entry) == 0 {
+			continue
+		}
+
+		jumpHost := JumpHost{User: config.GetUser()}
+
+		if index := strings.LastIndex(entry, "@"); index >= 0 {
+			jumpHost.User = entry[:index]
+			entry = entry[index+1:]
+		}
+
+		host, port, error := net.SplitHostPort(entry)
+		if error != nil {
+			host = entry
+			port = strconv.Itoa(int(utils.PortSSH))
+		}
+
+		if len(host) == 0 || len(jumpHost.User) == 0 {
+			return nil, fmt.Errorf("invalid jump host '%s'", entry)
+		}
+
+		jumpHost.Address = net.JoinHostPort(host, port)
+
+		result = append(result, jumpHost)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"golang.org/x/sys/unix"
+)
+
+type StopConfig struct {
+	Signal      string `yaml:"signal,omitempty"`
+	GracePeriod uint   `yaml:"grace-period,omitempty"`
+}
+
+// GetSignal returns the name of the signal sent to the server to stop it
+func (config *StopConfig) GetSignal() string {
+	if config == nil || len(config.Signal) == 0 {
+		return utils.StopSignal
+	}
+
+	signal := strings.ToUpper(config.Signal)
+
+	if !strings.HasPrefix(signal, "SIG") {
+		signal = "SIG" + signal
+	}
+
+	return signal
+}
+
+// GetSignalNumber returns the signal sent to the server to stop it or 0 if the signal is unknown
+func (config *StopConfig) GetSignalNumber() syscall.Signal {
+	return unix.SignalNum(config.GetSignal())
+}
+
+// GetGracePeriod returns the seconds to wait for the server to exit before it is killed
+func (config *StopConfig) GetGracePeriod() uint {
+	if config == nil || config.GracePeriod == 0 {
+		return utils.StopGracePeriod
+	}
+
+	return config.GracePeriod
+}
+
+func (config *StopConfig) Validate() error {
+	if config.GetSignalNumber() == 0 {
+		return fmt.Errorf("Unknown stop signal '%s'", config.GetSignal())
+	}
+
+	return nil
+}
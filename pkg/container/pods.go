@@ -148,7 +148,26 @@ func (pods *Pods) getDirectoryEntries(directory string) ([]string, error) {
 	return result, nil
 }
 
-func (pods *Pods) Restore() {
+// RestoreResult counts the restored and the failed pods and containers
+type RestoreResult struct {
+	PodsRestored       int
+	PodsFailed         int
+	ContainersRestored int
+	ContainersFailed   int
+}
+
+func (pods *Pods) Restore() RestoreResult {
+	result := RestoreResult{}
+
+	var mutex sync.Mutex
+
+	count := func(update func(result *RestoreResult)) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		update(&result)
+	}
+
 	for {
 		runtimeClient, _error := pods.getCRIClient()
 		if _error != nil {
@@ -172,7 +191,7 @@ func (pods *Pods) Restore() {
 			waitGroup.Add(1)
 
 			go func(podID string) {
-				restore := func() {
+				restore := func() bool {
 					logMessage := log.WithFields(log.Fields{"pod-id": podID})
 
 					logMessage.Debug("Restoring pod")
@@ -183,7 +202,7 @@ func (pods *Pods) Restore() {
 					if _error != nil {
 						logMessage.WithFields(log.Fields{"error": _error, "filename": podFilename}).Debug("Could not read pod content")
 
-						return
+						return false
 					}
 
 					var podConfig cri.PodSandboxConfig
@@ -191,21 +210,21 @@ func (pods *Pods) Restore() {
 					if _error = json.Unmarshal(podContent, &podConfig); _error != nil {
 						logMessage.WithFields(log.Fields{"error": _error, "filename": podFilename}).Debug("Could not deserialize pod content")
 
-						return
+						return false
 					}
 
 					podResponse, _error := runtimeClient.RunPodSandbox(context.Background(), &cri.RunPodSandboxRequest{Config: &podConfig})
 					if _error != nil {
 						logMessage.WithFields(log.Fields{"error": _error}).Debug("Could not start sandbox")
 
-						return
+						return false
 					}
 
 					containerIDs, _error := pods.getDirectoryEntries(pods.containersDirectory(podID))
 					if _error != nil {
 						logMessage.WithFields(log.Fields{"error": _error}).Debug("Could not retrieve pod ids")
 
-						return
+						return false
 					}
 
 					for _, containerID := range containerIDs {
@@ -217,6 +236,10 @@ func (pods *Pods) Restore() {
 						if _error != nil {
 							containerMessage.WithFields(log.Fields{"error": _error, "filename": containerFilename}).Debug("Could not read container content")
 
+							count(func(result *RestoreResult) {
+								result.ContainersFailed++
+							})
+
 							continue
 						}
 
@@ -225,6 +248,10 @@ func (pods *Pods) Restore() {
 						if _error = json.Unmarshal(containerContent, &containerConfig); _error != nil {
 							containerMessage.WithFields(log.Fields{"error": _error, "filename": containerFilename}).Debug("Could not deserialize container content")
 
+							count(func(result *RestoreResult) {
+								result.ContainersFailed++
+							})
+
 							continue
 						}
 
@@ -232,6 +259,10 @@ func (pods *Pods) Restore() {
 						if _error != nil {
 							containerMessage.WithFields(log.Fields{"error": _error}).Debug("Could not create container")
 
+							count(func(result *RestoreResult) {
+								result.ContainersFailed++
+							})
+
 							continue
 						}
 
@@ -239,16 +270,35 @@ func (pods *Pods) Restore() {
 						if _error != nil {
 							containerMessage.WithFields(log.Fields{"error": _error}).Debug("Could not start  container")
 
+							count(func(result *RestoreResult) {
+								result.ContainersFailed++
+							})
+
 							continue
 						}
 
+						count(func(result *RestoreResult) {
+							result.ContainersRestored++
+						})
+
 						logMessage.Debug("Restored container")
 					}
 
 					logMessage.Debug("Restored pod")
+
+					return true
 				}
 
-				restore()
+				if restore() {
+					count(func(result *RestoreResult) {
+						result.PodsRestored++
+					})
+
+				} else {
+					count(func(result *RestoreResult) {
+						result.PodsFailed++
+					})
+				}
 
 				waitGroup.Done()
 			}(_podID)
@@ -258,6 +308,8 @@ func (pods *Pods) Restore() {
 
 		break
 	}
+
+	return result
 }
 
 func (pods *Pods) getCRIClient() (cri.RuntimeServiceClient, error) {
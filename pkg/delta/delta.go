@@ -0,0 +1,474 @@
+package delta
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The delta is a stream of operations. A copy operation references a run of blocks of the basis file,
+// a data operation carries literal bytes that are not found in the basis file.
+const (
+	operationEnd  byte = 0
+	operationCopy byte = 1
+	operationData byte = 2
+)
+
+const magic = "K8STEWD1"
+
+// Literal bytes are flushed in chunks of this size at most
+const maximumDataSize = 1024 * 1024
+
+// Block is the signature of one block of the basis file
+type Block struct {
+	Weak   uint32
+	Strong string
+}
+
+// Signature describes the basis file by the weak rolling and the strong checksums of its blocks
+type Signature struct {
+	BlockSize int
+	Blocks    []Block
+}
+
+// weakChecksum is the rolling checksum used by rsync
+type weakChecksum struct {
+	a      uint32
+	b      uint32
+	length uint32
+}
+
+func newWeakChecksum(data []byte) *weakChecksum {
+	checksum := &weakChecksum{length: uint32(len(data))}
+
+	for i, value := range data {
+		checksum.a += uint32(value)
+		checksum.b += uint32(len(data)-i) * uint32(value)
+	}
+
+	return checksum
+}
+
+func (checksum *weakChecksum) value() uint32 {
+	return (checksum.a & 0xffff) | (checksum.b&0xffff)<<16
+}
+
+// roll removes the first byte of the window and appends a new one
+func (checksum *weakChecksum) roll(out, in byte) {
+	checksum.a = checksum.a - uint32(out) + uint32(in)
+	checksum.b = checksum.b - checksum.length*uint32(out) + checksum.a
+}
+
+// shrink removes the first byte of the window at the end of the file
+func (checksum *weakChecksum) shrink(out byte) {
+	checksum.a -= uint32(out)
+	checksum.b -= checksum.length * uint32(out)
+	checksum.length--
+}
+
+func strongChecksum(data []byte) string {
+	hash := sha256.Sum256(data)
+
+	return hex.EncodeToString(hash[:16])
+}
+
+// NewSignature computes the signature of the basis file
+func NewSignature(reader io.Reader, blockSize int) (*Signature, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size %d", blockSize)
+	}
+
+	signature := &Signature{BlockSize: blockSize, Blocks: []Block{}}
+	buffer := make([]byte, blockSize)
+
+	for {
+		count, _error := io.ReadFull(reader, buffer)
+
+		if count > 0 {
+			signature.Blocks = append(signature.Blocks, Block{Weak: newWeakChecksum(buffer[:count]).value(), Strong: strongChecksum(buffer[:count])})
+		}
+
+		if _error == io.EOF || _error == io.ErrUnexpectedEOF {
+			return signature, nil
+		}
+
+		if _error != nil {
+			return nil, errors.Wrap(_error, "Could not read basis file")
+		}
+	}
+}
+
+// Write writes the signature in its text form: the block size followed by one line per block
+func (signature *Signature) Write(writer io.Writer) error {
+	bufferedWriter := bufio.NewWriter(writer)
+
+	if _, _error := fmt.Fprintf(bufferedWriter, "%d\n", signature.BlockSize); _error != nil {
+		return _error
+	}
+
+	for _, block := range signature.Blocks {
+		if _, _error := fmt.Fprintf(bufferedWriter, "%08x %s\n", block.Weak, block.Strong); _error != nil {
+			return _error
+		}
+	}
+
+	return bufferedWriter.Flush()
+}
+
+// ReadSignature parses the text form of a signature
+func ReadSignature(reader io.Reader) (*Signature, error) {
+	scanner := bufio.NewScanner(reader)
+
+	if !scanner.Scan() {
+		return nil, errors.New("empty signature")
+	}
+
+	blockSize, _error := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+	if _error != nil || blockSize <= 0 {
+		return nil, fmt.Errorf("invalid signature block size '%s'", scanner.Text())
+	}
+
+	signature := &Signature{BlockSize: blockSize, Blocks: []Block{}}
+
+	for scanner.Scan() {
+		tokens := strings.Fields(scanner.Text())
+
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("invalid signature line '%s'", scanner.Text())
+		}
+
+		weak, _error := strconv.ParseUint(tokens[0], 16, 32)
+		if _error != nil {
+			return nil, fmt.Errorf("invalid signature line '%s'", scanner.Text())
+		}
+
+		signature.Blocks = append(signature.Blocks, Block{Weak: uint32(weak), Strong: tokens[1]})
+	}
+
+	return signature, scanner.Err()
+}
+
+type deltaWriter struct {
+	writer     *bufio.Writer
+	data       []byte
+	copyStart  int
+	copyLength int
+}
+
+func (writer *deltaWriter) writeUint32(value int) error {
+	var buffer [4]byte
+
+	binary.BigEndian.PutUint32(buffer[:], uint32(value))
+
+	_, _error := writer.writer.Write(buffer[:])
+
+	return _error
+}
+
+func (writer *deltaWriter) flushCopy() error {
+	if writer.copyLength == 0 {
+		return nil
+	}
+
+	if _error := writer.writer.WriteByte(operationCopy); _error != nil {
+		return _error
+	}
+
+	if _error := writer.writeUint32(writer.copyStart); _error != nil {
+		return _error
+	}
+
+	if _error := writer.writeUint32(writer.copyLength); _error != nil {
+		return _error
+	}
+
+	writer.copyLength = 0
+
+	return nil
+}
+
+func (writer *deltaWriter) flushData() error {
+	if len(writer.data) == 0 {
+		return nil
+	}
+
+	if _error := writer.writer.WriteByte(operationData); _error != nil {
+		return _error
+	}
+
+	if _error := writer.writeUint32(len(writer.data)); _error != nil {
+		return _error
+	}
+
+	if _, _error := writer.writer.Write(writer.data); _error != nil {
+		return _error
+	}
+
+	writer.data = writer.data[:0]
+
+	return nil
+}
+
+func (writer *deltaWriter) addCopy(block int) error {
+	if writer.copyLength > 0 && writer.copyStart+writer.copyLength == block {
+		writer.copyLength++
+
+		return nil
+	}
+
+	if _error := writer.flushData(); _error != nil {
+		return _error
+	}
+
+	if _error := writer.flushCopy(); _error != nil {
+		return _error
+	}
+
+	writer.copyStart = block
+	writer.copyLength = 1
+
+	return nil
+}
+
+func (writer *deltaWriter) addData(value byte) error {
+	if _error := writer.flushCopy(); _error != nil {
+		return _error
+	}
+
+	writer.data = append(writer.data, value)
+
+	if len(writer.data) >= maximumDataSize {
+		return writer.flushData()
+	}
+
+	return nil
+}
+
+// Diff writes the delta that turns the basis file described by the signature into the content of reader
+func Diff(signature *Signature, reader io.Reader, writer io.Writer) error {
+	blockSize := signature.BlockSize
+
+	// Index the blocks by their weak checksum
+	blocks := map[uint32][]int{}
+
+	for index, block := range signature.Blocks {
+		blocks[block.Weak] = append(blocks[block.Weak], index)
+	}
+
+	bufferedReader := bufio.NewReaderSize(reader, 1024*1024)
+	output := &deltaWriter{writer: bufio.NewWriter(writer), data: make([]byte, 0, maximumDataSize)}
+
+	if _, _error := output.writer.WriteString(magic); _error != nil {
+		return _error
+	}
+
+	if _error := output.writeUint32(blockSize); _error != nil {
+		return _error
+	}
+
+	// The window is a ring buffer holding the bytes that are currently compared
+	window := make([]byte, blockSize)
+	contiguous := make([]byte, blockSize)
+	start := 0
+	length := 0
+	eof := false
+
+	fill := func() error {
+		start = 0
+		length = 0
+
+		for length < blockSize && !eof {
+			count, _error := io.ReadFull(bufferedReader, window[length:])
+
+			length += count
+
+			if _error == io.EOF || _error == io.ErrUnexpectedEOF {
+				eof = true
+			} else if _error != nil {
+				return errors.Wrap(_error, "Could not read file")
+			}
+		}
+
+		return nil
+	}
+
+	getWindow := func() []byte {
+		for i := 0; i < length; i++ {
+			contiguous[i] = window[(start+i)%blockSize]
+		}
+
+		return contiguous[:length]
+	}
+
+	if _error := fill(); _error != nil {
+		return _error
+	}
+
+	weak := newWeakChecksum(window[:length])
+
+	for length > 0 {
+		matched := false
+
+		if candidates, ok := blocks[weak.value()]; ok {
+			strong := strongChecksum(getWindow())
+
+			for _, index := range candidates {
+				if signature.Blocks[index].Strong != strong {
+					continue
+				}
+
+				if _error := output.addCopy(index); _error != nil {
+					return _error
+				}
+
+				matched = true
+
+				break
+			}
+		}
+
+		if matched {
+			if _error := fill(); _error != nil {
+				return _error
+			}
+
+			weak = newWeakChecksum(window[:length])
+
+			continue
+		}
+
+		out := window[start]
+
+		if _error := output.addData(out); _error != nil {
+			return _error
+		}
+
+		if eof {
+			weak.shrink(out)
+
+			start = (start + 1) % blockSize
+			length--
+
+			continue
+		}
+
+		in, _error := bufferedReader.ReadByte()
+
+		if _error == io.EOF {
+			eof = true
+
+			weak.shrink(out)
+
+			start = (start + 1) % blockSize
+			length--
+
+			continue
+		}
+
+		if _error != nil {
+			return errors.Wrap(_error, "Could not read file")
+		}
+
+		weak.roll(out, in)
+
+		window[start] = in
+		start = (start + 1) % blockSize
+	}
+
+	if _error := output.flushData(); _error != nil {
+		return _error
+	}
+
+	if _error := output.flushCopy(); _error != nil {
+		return _error
+	}
+
+	if _error := output.writer.WriteByte(operationEnd); _error != nil {
+		return _error
+	}
+
+	return output.writer.Flush()
+}
+
+// Patch applies the delta to the basis file and writes the result
+func Patch(basis io.ReaderAt, reader io.Reader, writer io.Writer) error {
+	bufferedReader := bufio.NewReaderSize(reader, 1024*1024)
+	bufferedWriter := bufio.NewWriter(writer)
+
+	header := make([]byte, len(magic)+4)
+
+	if _, _error := io.ReadFull(bufferedReader, header); _error != nil {
+		return errors.Wrap(_error, "Could not read delta header")
+	}
+
+	if string(header[:len(magic)]) != magic {
+		return errors.New("invalid delta header")
+	}
+
+	blockSize := int64(binary.BigEndian.Uint32(header[len(magic):]))
+
+	readUint32 := func() (int64, error) {
+		var buffer [4]byte
+
+		if _, _error := io.ReadFull(bufferedReader, buffer[:]); _error != nil {
+			return 0, errors.Wrap(_error, "Could not read delta")
+		}
+
+		return int64(binary.BigEndian.Uint32(buffer[:])), nil
+	}
+
+	for {
+		operation, _error := bufferedReader.ReadByte()
+		if _error != nil {
+			return errors.Wrap(_error, "Could not read delta")
+		}
+
+		switch operation {
+		case operationEnd:
+			return bufferedWriter.Flush()
+
+		case operationCopy:
+			block, _error := readUint32()
+			if _error != nil {
+				return _error
+			}
+
+			count, _error := readUint32()
+			if _error != nil {
+				return _error
+			}
+
+			// The last block of the basis file might be shorter
+			section := io.NewSectionReader(basis, block*blockSize, count*blockSize)
+
+			copied, _error := io.Copy(bufferedWriter, section)
+			if _error != nil {
+				return errors.Wrap(_error, "Could not copy from basis file")
+			}
+
+			if count == 0 || copied <= (count-1)*blockSize {
+				return fmt.Errorf("invalid delta copy of %d blocks from block %d", count, block)
+			}
+
+		case operationData:
+			size, _error := readUint32()
+			if _error != nil {
+				return _error
+			}
+
+			if _, _error := io.CopyN(bufferedWriter, bufferedReader, size); _error != nil {
+				return errors.Wrap(_error, "Could not read delta")
+			}
+
+		default:
+			return fmt.Errorf("invalid delta operation %d", operation)
+		}
+	}
+}
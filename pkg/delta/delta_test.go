@@ -0,0 +1,213 @@
+package delta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func randomBytes(seed int64, size int) []byte {
+	result := make([]byte, size)
+
+	rand.New(rand.NewSource(seed)).Read(result)
+
+	return result
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// roundTrip computes the delta from basis to target and applies it to basis
+func roundTrip(t *testing.T, basis, target []byte, blockSize int) ([]byte, []byte) {
+	signature, _error := NewSignature(bytes.NewReader(basis), blockSize)
+	if _error != nil {
+		t.Fatal(_error)
+	}
+
+	// The signature is transferred in its text form
+	var signatureBuffer bytes.Buffer
+
+	if _error := signature.Write(&signatureBuffer); _error != nil {
+		t.Fatal(_error)
+	}
+
+	signature, _error = ReadSignature(&signatureBuffer)
+	if _error != nil {
+		t.Fatal(_error)
+	}
+
+	var delta bytes.Buffer
+
+	if _error := Diff(signature, bytes.NewReader(target), &delta); _error != nil {
+		t.Fatal(_error)
+	}
+
+	var result bytes.Buffer
+
+	if _error := Patch(bytes.NewReader(basis), bytes.NewReader(delta.Bytes()), &result); _error != nil {
+		t.Fatal(_error)
+	}
+
+	return result.Bytes(), delta.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	const blockSize = 16
+
+	basis := randomBytes(1, 10*blockSize+5)
+	large := randomBytes(2, 1000*blockSize)
+
+	tests := []struct {
+		name      string
+		basis     []byte
+		target    []byte
+		blockSize int
+		// maximumDelta limits the size of the delta to make sure that blocks were copied, zero means no limit
+		maximumDelta int
+	}{
+		{name: "empty files", basis: []byte{}, target: []byte{}},
+		{name: "empty basis", basis: []byte{}, target: basis},
+		{name: "empty target", basis: basis, target: []byte{}},
+		{name: "identical", basis: basis, target: basis, maximumDelta: 64},
+		{name: "identical with full blocks only", basis: basis[:4*blockSize], target: basis[:4*blockSize], maximumDelta: 64},
+		{name: "smaller than a block", basis: []byte("abc"), target: []byte("abd")},
+		{name: "last block shorter", basis: basis, target: join(basis[:8*blockSize], []byte("changed"), basis[8*blockSize+7:])},
+		{name: "truncated in the last block", basis: basis, target: basis[:len(basis)-2]},
+		{name: "appended", basis: basis, target: join(basis, []byte("appended"))},
+		{name: "prepended", basis: basis, target: join([]byte("prepended"), basis)},
+		{name: "insert mid-block", basis: basis, target: join(basis[:3*blockSize+5], []byte("inserted"), basis[3*blockSize+5:])},
+		{name: "delete mid-block", basis: basis, target: join(basis[:3*blockSize+5], basis[5*blockSize+2:])},
+		{name: "replace mid-block", basis: basis, target: join(basis[:2*blockSize+3], []byte("xxxxx"), basis[2*blockSize+8:])},
+		{name: "reordered blocks", basis: basis, target: join(basis[6*blockSize:], basis[:6*blockSize])},
+		{name: "repeated blocks", basis: basis[:blockSize], target: join(basis[:blockSize], basis[:blockSize], basis[:blockSize])},
+		{name: "unrelated", basis: basis, target: randomBytes(3, len(basis))},
+		{name: "large with insert", basis: large, target: join(large[:500*blockSize+1], []byte("inserted"), large[500*blockSize+1:]), maximumDelta: len(large) / 10},
+		{name: "large with delete", basis: large, target: join(large[:100*blockSize+7], large[101*blockSize:]), maximumDelta: len(large) / 10},
+		{name: "literal data larger than a chunk", basis: []byte{}, target: randomBytes(4, maximumDataSize+100), blockSize: 4096},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			size := test.blockSize
+
+			if size == 0 {
+				size = blockSize
+			}
+
+			result, delta := roundTrip(t, test.basis, test.target, size)
+
+			if !bytes.Equal(result, test.target) {
+				t.Fatalf("patched file differs from the target (got %d bytes, expected %d)", len(result), len(test.target))
+			}
+
+			if test.maximumDelta > 0 && len(delta) > test.maximumDelta {
+				t.Errorf("delta has %d bytes, expected at most %d", len(delta), test.maximumDelta)
+			}
+		})
+	}
+}
+
+func TestSignature(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		blockSize int
+		blocks    int
+	}{
+		{name: "empty", size: 0, blockSize: 4, blocks: 0},
+		{name: "full blocks", size: 12, blockSize: 4, blocks: 3},
+		{name: "short last block", size: 13, blockSize: 4, blocks: 4},
+		{name: "smaller than a block", size: 3, blockSize: 4, blocks: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signature, _error := NewSignature(bytes.NewReader(randomBytes(5, test.size)), test.blockSize)
+			if _error != nil {
+				t.Fatal(_error)
+			}
+
+			if len(signature.Blocks) != test.blocks {
+				t.Errorf("got %d blocks, expected %d", len(signature.Blocks), test.blocks)
+			}
+		})
+	}
+
+	if _, _error := NewSignature(bytes.NewReader(nil), 0); _error == nil {
+		t.Error("expected an error for block size 0")
+	}
+}
+
+func TestReadSignatureErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{name: "empty", signature: ""},
+		{name: "invalid block size", signature: "abc\n"},
+		{name: "zero block size", signature: "0\n"},
+		{name: "missing strong checksum", signature: "4\n0000abcd\n"},
+		{name: "invalid weak checksum", signature: "4\nxyz 00112233445566778899aabbccddeeff\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _error := ReadSignature(strings.NewReader(test.signature)); _error == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestPatchCorruptDelta(t *testing.T) {
+	const blockSize = 16
+
+	basis := randomBytes(6, 4*blockSize)
+
+	header := func() []byte {
+		result := []byte(magic)
+
+		return binary.BigEndian.AppendUint32(result, blockSize)
+	}
+
+	operation := func(code byte, values ...uint32) []byte {
+		result := []byte{code}
+
+		for _, value := range values {
+			result = binary.BigEndian.AppendUint32(result, value)
+		}
+
+		return result
+	}
+
+	_, valid := roundTrip(t, basis, join(basis[:blockSize], []byte("data"), basis[2*blockSize:]), blockSize)
+
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{name: "empty", delta: []byte{}},
+		{name: "invalid magic", delta: join([]byte("K8STEWD0"), valid[len(magic):])},
+		{name: "truncated header", delta: valid[:len(magic)+2]},
+		{name: "missing end", delta: valid[:len(valid)-1]},
+		{name: "truncated", delta: valid[:len(valid)/2]},
+		{name: "invalid operation", delta: join(header(), []byte{7})},
+		{name: "copy beyond the basis", delta: join(header(), operation(operationCopy, 10, 1), []byte{operationEnd})},
+		{name: "copy past the end of the basis", delta: join(header(), operation(operationCopy, 2, 4), []byte{operationEnd})},
+		{name: "copy of no blocks", delta: join(header(), operation(operationCopy, 0, 0), []byte{operationEnd})},
+		{name: "data longer than the delta", delta: join(header(), operation(operationData, 100), []byte("short"))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result bytes.Buffer
+
+			if _error := Patch(bytes.NewReader(basis), bytes.NewReader(test.delta), &result); _error == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
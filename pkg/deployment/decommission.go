@@ -0,0 +1,235 @@
+package deployment
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/pkg/ceph"
+	"github.com/darxkies/k8s-tew/pkg/etcd"
+	"github.com/darxkies/k8s-tew/pkg/k8s"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DecommissionSteps returns the count of progress steps of Decommission
+func DecommissionSteps() int {
+	return 5
+}
+
+// Decommission removes a node from the cluster. The node is drained and deleted from Kubernetes, its etcd member
+// and its Ceph daemons are removed and the service is stopped and removed from the node. The node is neither
+// removed from the config nor are the assets regenerated.
+func (deployment *Deployment) Decommission(nodeName string) error {
+	defer deployment.Close()
+
+	nodeDeployment, ok := deployment.nodes[nodeName]
+	if !ok {
+		return fmt.Errorf("Node '%s' not found", nodeName)
+	}
+
+	node := nodeDeployment.node
+
+	if node.IsController() && deployment.getControllersCount() < 2 {
+		return fmt.Errorf("Node '%s' is the last controller", nodeName)
+	}
+
+	kubernetesClient := k8s.NewK8S(deployment.config)
+
+	// Drain and delete the Kubernetes node
+	{
+		log.WithFields(log.Fields{"node": nodeName}).Info("Draining node")
+
+		if _error := kubernetesClient.Cordon(nodeName); _error != nil {
+			log.WithFields(log.Fields{"node": nodeName, "error": _error}).Warn("Could not cordon node")
+		} else if _error := kubernetesClient.Drain(nodeName); _error != nil {
+			return errors.Wrapf(_error, "Could not drain node '%s'", nodeName)
+		}
+
+		if _error := kubernetesClient.DeleteNode(nodeName); _error != nil {
+			return _error
+		}
+
+		log.WithFields(log.Fields{"node": nodeName}).Info("Kubernetes node deleted")
+
+		utils.IncreaseProgressStep()
+	}
+
+	// Remove the etcd member
+	if node.IsController() {
+		if _error := deployment.removeEtcdMember(nodeName); _error != nil {
+			return _error
+		}
+	}
+
+	utils.IncreaseProgressStep()
+
+	// Remove the Ceph daemons
+	if _error := deployment.removeCephDaemons(kubernetesClient, nodeName); _error != nil {
+		return _error
+	}
+
+	utils.IncreaseProgressStep()
+
+	// The node might be gone already, therefore failures on the node itself do not stop the decommission
+	if _error := nodeDeployment.cleanup(); _error != nil {
+		log.WithFields(log.Fields{"node": nodeName, "error": _error}).Warn("Could not clean up node")
+	}
+
+	utils.IncreaseProgressStep()
+
+	return nil
+}
+
+func (deployment *Deployment) getControllersCount() int {
+	result := 0
+
+	for _, node := range deployment.config.Config.Nodes {
+		if node.IsController() {
+			result++
+		}
+	}
+
+	return result
+}
+
+func (deployment *Deployment) removeEtcdMember(nodeName string) error {
+	log.WithFields(log.Fields{"node": nodeName}).Info("Removing etcd member")
+
+	if _error := etcd.NewEtcd(deployment.config).RemoveMember(nodeName); _error != nil {
+		return _error
+	}
+
+	if deployment.config.Config.EtcdClusterState != utils.EtcdClusterStateExisting {
+		return nil
+	}
+
+	members := []string{}
+
+	for _, member := range deployment.config.Config.EtcdMembers {
+		if member != nodeName {
+			members = append(members, member)
+		}
+	}
+
+	deployment.config.SetEtcdMembers(members)
+
+	return nil
+}
+
+// removeCephDaemons marks out and purges the OSD of the node, removes its monitor and deletes all its Ceph deployments.
+// The Ceph commands are executed in a monitor pod running on another node.
+func (deployment *Deployment) removeCephDaemons(kubernetesClient *k8s.K8S, nodeName string) error {
+	var monitor string
+
+	isOsd := false
+	isMonitor := false
+
+	for _, storageNode := range deployment.config.GetStorageNodes() {
+		if storageNode.Name == nodeName {
+			isOsd = true
+		}
+	}
+
+	for _, storageController := range deployment.config.GetStorageControllers() {
+		if storageController.Name == nodeName {
+			isMonitor = true
+		} else if len(monitor) == 0 {
+			monitor = fmt.Sprintf("instance=ceph-mon-%s", storageController.Name)
+		}
+	}
+
+	if !isOsd && !isMonitor {
+		return nil
+	}
+
+	if len(monitor) == 0 {
+		return fmt.Errorf("Node '%s' is the last Ceph monitor", nodeName)
+	}
+
+	cephClient := ceph.NewCeph(deployment.config, ceph.CephBinariesPath, ceph.CephConfigPath, ceph.CephDataPath)
+
+	runCephCommand := func(arguments string) error {
+		output, _error := kubernetesClient.ExecInRunningPod(utils.NamespaceStorage, monitor, "ceph-mon", cephClient.GetCommand(arguments))
+		if _error != nil {
+			return errors.Wrapf(_error, "Ceph command '%s' failed (Output: %s)", arguments, output)
+		}
+
+		log.WithFields(log.Fields{"arguments": arguments, "output": output}).Debug("Ceph command executed")
+
+		return nil
+	}
+
+	if isOsd {
+		id := fmt.Sprintf("%d", deployment.config.Config.Nodes[nodeName].StorageIndex)
+
+		log.WithFields(log.Fields{"node": nodeName, "id": id}).Info("Removing Ceph OSD")
+
+		if _error := runCephCommand(fmt.Sprintf("osd out %s", id)); _error != nil {
+			return _error
+		}
+
+		if _error := kubernetesClient.DeleteDeployment(utils.NamespaceStorage, fmt.Sprintf("ceph-osd-%s", nodeName)); _error != nil {
+			return _error
+		}
+
+		if _error := runCephCommand(fmt.Sprintf("osd purge %s --yes-i-really-mean-it", id)); _error != nil {
+			return _error
+		}
+	}
+
+	if isMonitor {
+		log.WithFields(log.Fields{"node": nodeName}).Info("Removing Ceph monitor and daemons")
+
+		for _, daemon := range []string{"mon", "mgr", "mds", "rgw"} {
+			if _error := kubernetesClient.DeleteDeployment(utils.NamespaceStorage, fmt.Sprintf("ceph-%s-%s", daemon, nodeName)); _error != nil {
+				return _error
+			}
+		}
+
+		if _error := runCephCommand(fmt.Sprintf("mon remove %s", nodeName)); _error != nil {
+			return _error
+		}
+	}
+
+	return nil
+}
+
+// cleanup stops and disables the service and removes the files deployed by k8s-tew from the node
+func (deployment *NodeDeployment) cleanup() error {
+	if _error := deployment.verifyHostKey(); _error != nil {
+		return _error
+	}
+
+	log.WithFields(log.Fields{"node": deployment.name}).Info("Stopping service")
+
+	if _, _error := deployment.Execute("stop-service", fmt.Sprintf("systemctl disable --now %s", utils.ServiceName)); _error != nil {
+		return _error
+	}
+
+	files := []string{
+		deployment.config.GetFullTargetAssetFilename(utils.ServiceConfig),
+		deployment.config.GetFullTargetAssetFilename(utils.K8sTewProfile),
+	}
+
+	for _, directory := range []string{utils.DirectoryConfig, utils.DirectoryBinaries, utils.DirectoryDynamicData, utils.DirectoryLogging, utils.DirectoryImages, utils.DirectoryRun, utils.DirectoryVarRun, utils.DirectoryContainerdState} {
+		files = append(files, deployment.config.GetFullTargetAssetDirectory(directory))
+	}
+
+	quotedFiles := []string{}
+
+	for _, file := range files {
+		quotedFiles = append(quotedFiles, quote(file))
+	}
+
+	log.WithFields(log.Fields{"node": deployment.name}).Info("Removing files")
+
+	// Mounts left behind by the kubelet must not be followed
+	command := fmt.Sprintf("for mount in $(grep -o ' %s[^ ]*' /proc/mounts | sort -r); do umount $mount; done; rm -rf --one-file-system %s && systemctl daemon-reload", deployment.config.GetFullTargetAssetDirectory(utils.DirectoryDynamicData), strings.Join(quotedFiles, " "))
+
+	if _, _error := deployment.Execute("remove-files", command); _error != nil {
+		return _error
+	}
+
+	return nil
+}
@@ -1,70 +1,80 @@
 package deployment
 
 import (
-	"errors"
+	"fmt"
+	"io"
 	"path"
 	"time"
 
 	"github.com/darxkies/k8s-tew/pkg/config"
 	"github.com/darxkies/k8s-tew/pkg/k8s"
 	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type Deployment struct {
 	config            *config.InternalConfig
-	identityFile      string
-	skipSetup         bool
-	skipUpload        bool
-	skipRestart       bool
+	options           DeploymentOptions
 	skipSetupFeatures config.Features
-	forceUpload       bool
-	commandRetries    uint
 	nodes             map[string]*NodeDeployment
 	images            config.Images
-	parallel          bool
-	importImages      bool
-	wait              uint
 	localChecksums    *utils.Checksums
+	hostKeyVerifier   *HostKeyVerifier
+	journal           *Journal
+	report            *Report
 }
 
-func NewDeployment(_config *config.InternalConfig, identityFile string, importImages, forceUpload bool, parallel bool, commandRetries uint, skipSetup, skipUpload, skipRestart, skipStorageSetup, skipMonitoringSetup, skipLoggingSetup, skipBackupSetup, skipShowcaseSetup, skipIngressSetup bool, wait uint) *Deployment {
+func NewDeployment(_config *config.InternalConfig, options DeploymentOptions) *Deployment {
 	nodes := map[string]*NodeDeployment{}
 
-	localChecksums := utils.NewChecksums(path.Join(_config.GetFullLocalAssetDirectory(utils.DirectoryDynamicData), "checksums"), _config.BaseDirectory)
+	localChecksums := utils.NewChecksums(path.Join(_config.GetFullLocalAssetDirectory(utils.DirectoryDynamicData), utils.ChecksumsFilename), _config.BaseDirectory)
+	hostKeyVerifier := NewHostKeyVerifier(_config, options.KnownHostsFile, options.AcceptNewHostKeys)
+	report := NewReport()
+	generation := newGenerationID()
+
+	newTransport := options.NewTransport
+
+	if newTransport == nil {
+		newTransport = func(name string, node *config.Node) Transport {
+			return NewTransport(options.IdentityFile, name, node, _config, hostKeyVerifier)
+		}
+	}
 
 	for nodeName, node := range _config.Config.Nodes {
-		nodes[nodeName] = NewNodeDeployment(identityFile, nodeName, node, _config, parallel, localChecksums)
+		nodes[nodeName] = NewNodeDeployment(nodeName, node, _config, options.Parallel, localChecksums, newTransport(nodeName, node), options.CompressUploads, options.DeltaUploads)
+		nodes[nodeName].report = report
+		nodes[nodeName].generation = generation
 	}
 
 	skipSetupFeatures := config.Features{}
 
-	if skipStorageSetup {
+	if options.SkipStorageSetup {
 		skipSetupFeatures = append(skipSetupFeatures, utils.FeatureStorage)
 	}
 
-	if skipMonitoringSetup {
+	if options.SkipMonitoringSetup {
 		skipSetupFeatures = append(skipSetupFeatures, utils.FeatureMonitoring)
 	}
 
-	if skipLoggingSetup {
+	if options.SkipLoggingSetup {
 		skipSetupFeatures = append(skipSetupFeatures, utils.FeatureLogging)
 	}
 
-	if skipBackupSetup {
+	if options.SkipBackupSetup {
 		skipSetupFeatures = append(skipSetupFeatures, utils.FeatureBackup)
 	}
 
-	if skipShowcaseSetup {
+	if options.SkipShowcaseSetup {
 		skipSetupFeatures = append(skipSetupFeatures, utils.FeatureShowcase)
 	}
 
-	if skipIngressSetup {
+	if options.SkipIngressSetup {
 		skipSetupFeatures = append(skipSetupFeatures, utils.FeatureIngress)
 	}
 
-	deployment := &Deployment{config: _config, identityFile: identityFile, importImages: importImages, forceUpload: forceUpload, parallel: parallel, commandRetries: commandRetries, nodes: nodes, skipSetup: skipSetup, skipUpload: skipUpload, skipRestart: skipRestart, skipSetupFeatures: skipSetupFeatures, wait: wait, localChecksums: localChecksums}
+	deployment := &Deployment{config: _config, options: options, nodes: nodes, skipSetupFeatures: skipSetupFeatures, localChecksums: localChecksums, hostKeyVerifier: hostKeyVerifier, report: report, journal: NewJournal(path.Join(_config.GetFullLocalAssetDirectory(utils.DirectoryDynamicData), utils.DeploymentJournalFilename))}
 
 	deployment.images = deployment.config.Config.Versions.GetImages()
 
@@ -74,22 +84,22 @@ func NewDeployment(_config *config.InternalConfig, identityFile string, importIm
 func (deployment *Deployment) Steps() int {
 	result := 0
 
-	if deployment.wait > 0 {
+	if deployment.options.Wait > 0 {
 		result++
 	}
 
 	// Files deployment
-	if !deployment.skipUpload {
+	if !deployment.options.SkipUpload {
 		for _, node := range deployment.nodes {
-			result += node.Steps(deployment.skipRestart)
+			result += node.Steps(deployment.options.SkipRestart)
 		}
 	}
 
-	if !deployment.skipSetup {
+	if !deployment.options.SkipSetup {
 		// Taint commands
 		result += len(deployment.config.Config.Nodes)
 
-		if deployment.importImages {
+		if deployment.options.ImportImages {
 			// Import images
 			result += len(deployment.config.Config.Nodes) * len(deployment.images)
 		}
@@ -102,24 +112,87 @@ func (deployment *Deployment) Steps() int {
 	return result
 }
 
-// Deploy all files to the nodes over SSH
+// Close releases the SSH connections of all nodes
+func (deployment *Deployment) Close() {
+	for _, nodeDeployment := range deployment.nodes {
+		nodeDeployment.Close()
+	}
+}
+
+// SetReportStream streams the steps of the deployment report as JSON lines
+func (deployment *Deployment) SetReportStream(writer io.Writer) {
+	deployment.report.SetStream(writer)
+}
+
+// Deploy all files to the nodes over SSH and write the report to the base directory, even if the deployment failed
 func (deployment *Deployment) Deploy() error {
+	_error := deployment.deploy()
+
+	deployment.report.Finish(_error)
+
+	if _error := deployment.report.Save(deployment.config.BaseDirectory); _error != nil {
+		log.WithFields(log.Fields{"error": _error}).Error("Report save failed")
+	}
+
+	return _error
+}
+
+func (deployment *Deployment) deploy() error {
 	if !deployment.config.Config.Nodes.HasStorageNode() && !deployment.skipSetupFeatures.HasFeatures(config.Features{utils.FeatureStorage}) {
 		return errors.New("At least one storage node is required. After adding the storage node, run sub-command generate again.")
 	}
 
+	// Release the SSH connections of all nodes once done
+	defer deployment.Close()
+
 	sortedNodeKeys := deployment.config.GetSortedNodeKeys()
 
-	if !deployment.skipUpload {
-		_ = deployment.localChecksums.Load()
+	// Verify host keys before anything is uploaded
+	for _, nodeName := range sortedNodeKeys {
+		if _error := deployment.nodes[nodeName].verifyHostKey(); _error != nil {
+			return _error
+		}
+	}
 
-		for _, nodeName := range sortedNodeKeys {
-			nodeDeployment := deployment.nodes[nodeName]
+	if !deployment.options.SkipPreflight {
+		results := deployment.Preflight()
 
-			deployment.config.SetNode(nodeName, nodeDeployment.node)
+		results.Log()
 
-			if error := nodeDeployment.UploadFiles(deployment.forceUpload, deployment.skipRestart); error != nil {
-				return error
+		if results.HasFailures() {
+			return errors.New("Preflight checks failed, run 'k8s-tew preflight' for details")
+		}
+	}
+
+	_ = deployment.localChecksums.Load()
+
+	fingerprint, _error := GetFingerprint(deployment.config, deployment.localChecksums)
+	if _error != nil {
+		return _error
+	}
+
+	if deployment.options.Resume {
+		if _error := deployment.journal.Resume(fingerprint); _error != nil {
+			return _error
+		}
+
+	} else {
+		deployment.journal.Reset(fingerprint)
+	}
+
+	if !deployment.options.SkipUpload {
+		if _error := deployment.updateEtcdMembers(); _error != nil {
+			return _error
+		}
+
+		if deployment.options.Rolling && !deployment.options.SkipRestart {
+			if _error := deployment.rollingUpload(); _error != nil {
+				return _error
+			}
+
+		} else {
+			if _error := deployment.uploadNodes(); _error != nil {
+				return _error
 			}
 		}
 
@@ -132,20 +205,107 @@ func (deployment *Deployment) Deploy() error {
 		return _error
 	}
 
-	if deployment.wait > 0 {
+	if _error := deployment.recordEtcdMembers(); _error != nil {
+		log.WithFields(log.Fields{"error": _error}).Warn("Could not record etcd members")
+	}
+
+	deployment.journal.Remove()
+
+	if deployment.options.Wait > 0 {
 		kubernetesClient := k8s.NewK8S(deployment.config)
-		_ = kubernetesClient.WaitForCluster(deployment.wait)
+		_ = kubernetesClient.WaitForCluster(deployment.options.Wait)
+	}
+
+	return nil
+}
+
+// uploadNodes deploys the files to the controllers first and then to the other nodes. Within each group at most parallelNodes
+// nodes are deployed at the same time and the errors of all nodes are collected.
+func (deployment *Deployment) uploadNodes() error {
+	controllers := []string{}
+	others := []string{}
+
+	for _, nodeName := range deployment.config.GetSortedNodeKeys() {
+		if deployment.nodes[nodeName].node.IsController() {
+			controllers = append(controllers, nodeName)
+		} else {
+			others = append(others, nodeName)
+		}
+	}
+
+	parallelNodes := deployment.options.ParallelNodes
+
+	if parallelNodes == 0 {
+		parallelNodes = 1
+	}
+
+	limiter := utils.NewLimiter(int(parallelNodes))
+
+	for _, group := range [][]string{controllers, others} {
+		tasks := utils.Tasks{}
+
+		for _, nodeName := range group {
+			nodeName := nodeName
+
+			tasks = append(tasks, func() error {
+				limiter.Lock()
+				defer limiter.Unlock()
+
+				return deployment.uploadNode(nodeName)
+			})
+		}
+
+		if errors := utils.RunParallelTasks(tasks, parallelNodes > 1); len(errors) > 0 {
+			return fmt.Errorf("Deployment failed on %d node(s): %s", len(errors), errors.Error())
+		}
 	}
 
 	return nil
 }
 
+func (deployment *Deployment) uploadNode(nodeName string) error {
+	nodeDeployment := deployment.nodes[nodeName]
+
+	if deployment.journal.IsDone(uploadStep(nodeName)) {
+		deployment.report.Skip(nodeName, ReportStepUpload, nodeName)
+
+		increaseProgressSteps(nodeDeployment.Steps(deployment.options.SkipRestart))
+
+		return nil
+	}
+
+	log.WithFields(log.Fields{"node": nodeName}).Info("Deploying node")
+
+	start := time.Now()
+
+	if _error := nodeDeployment.UploadFiles(deployment.options.ForceUpload, deployment.options.SkipRestart); _error != nil {
+		return errors.Wrapf(_error, "Could not deploy node '%s'", nodeName)
+	}
+
+	log.WithFields(log.Fields{"node": nodeName, "duration": time.Since(start).Round(time.Second)}).Info("Node deployed")
+
+	return deployment.journal.Done(uploadStep(nodeName))
+}
+
+func increaseProgressSteps(steps int) {
+	for i := 0; i < steps; i++ {
+		utils.IncreaseProgressStep()
+	}
+}
+
 func (deployment *Deployment) runCommand(name, command string) error {
 	var error error
 
 	log.WithFields(log.Fields{"name": name, "_command": command}).Info("Executing command")
 
-	for retries := uint(0); retries < deployment.commandRetries; retries++ {
+	start := time.Now()
+	retries := uint(0)
+
+	defer func() {
+		deployment.report.Record("", ReportStepCommand, name, start, retries, error)
+	}()
+
+	for ; retries < deployment.options.CommandRetries; retries++ {
 		// Run command
 		if error = utils.RunCommand(command); error == nil {
 			break
@@ -173,11 +333,22 @@ func (deployment *Deployment) runConfigureTaints() error {
 	for _, nodeName := range sortedNodeKeys {
 		nodeDeployment := deployment.nodes[nodeName]
 
+		if deployment.journal.IsDone(taintStep(nodeName)) {
+			deployment.report.Skip(nodeName, ReportStepTaint, nodeName)
+
+			utils.IncreaseProgressStep()
+
+			continue
+		}
+
 		deployment.config.SetNode(nodeName, nodeDeployment.node)
 
 		log.WithFields(log.Fields{"node": nodeName}).Info("Configuring taint")
 
-		for retries := uint(0); retries < deployment.commandRetries; retries++ {
+		start := time.Now()
+		retries := uint(0)
+
+		for ; retries < deployment.options.CommandRetries; retries++ {
 			if _error = nodeDeployment.configureTaint(); _error == nil {
 				break
 			}
@@ -185,6 +356,8 @@ func (deployment *Deployment) runConfigureTaints() error {
 			time.Sleep(time.Second)
 		}
 
+		deployment.report.Record(nodeName, ReportStepTaint, nodeName, start, retries, _error)
+
 		utils.IncreaseProgressStep()
 
 		if _error != nil {
@@ -193,13 +366,16 @@ func (deployment *Deployment) runConfigureTaints() error {
 			return _error
 		}
 
+		if _error := deployment.journal.Done(taintStep(nodeName)); _error != nil {
+			return _error
+		}
 	}
 
 	return nil
 }
 
 func (deployment *Deployment) runImportImages() error {
-	if !deployment.importImages {
+	if !deployment.options.ImportImages {
 		return nil
 	}
 
@@ -222,13 +398,27 @@ func (deployment *Deployment) runImportImages() error {
 					return nil
 				}
 
-				_ = nodeDeployment.importImage(image.Name, deployment.config.GetFullTargetAssetFilename(image.GetImageFilename()))
+				if deployment.journal.IsDone(importImageStep(nodeName, image.Name)) {
+					deployment.report.Skip(nodeName, ReportStepImportImage, image.Name)
 
-				return nil
+					return nil
+				}
+
+				start := time.Now()
+
+				_error := nodeDeployment.importImage(image.Name, deployment.config.GetFullTargetAssetFilename(image.GetImageFilename()))
+
+				deployment.report.Record(nodeName, ReportStepImportImage, image.Name, start, 0, _error)
+
+				if _error != nil {
+					return nil
+				}
+
+				return deployment.journal.Done(importImageStep(nodeName, image.Name))
 			})
 		}
 
-		if errors := utils.RunParallelTasks(tasks, deployment.parallel); len(errors) > 0 {
+		if errors := utils.RunParallelTasks(tasks, deployment.options.Parallel); len(errors) > 0 {
 			return errors[0]
 		}
 	}
@@ -251,8 +441,26 @@ func (deployment *Deployment) runBoostrapperCommands() error {
 			continue
 		}
 
+		if deployment.journal.IsDone(commandStep(command.Name)) {
+			if len(command.Manifest) > 0 {
+				deployment.report.Skip("", ReportStepManifest, command.Name)
+			} else {
+				deployment.report.Skip("", ReportStepCommand, command.Name)
+			}
+
+			utils.IncreaseProgressStep()
+
+			continue
+		}
+
 		if len(command.Manifest) > 0 {
-			if error := k8s.ApplyManifest(deployment.config, command.Name, command.Manifest, int(deployment.commandRetries)); error != nil {
+			start := time.Now()
+
+			error := k8s.ApplyManifest(deployment.config, command.Name, command.Manifest, int(deployment.options.CommandRetries))
+
+			deployment.report.Record("", ReportStepManifest, command.Name, start, 0, error)
+
+			if error != nil {
 				return error
 			}
 
@@ -267,6 +475,10 @@ func (deployment *Deployment) runBoostrapperCommands() error {
 			}
 		}
 
+		if error := deployment.journal.Done(commandStep(command.Name)); error != nil {
+			return error
+		}
+
 		utils.IncreaseProgressStep()
 	}
 
@@ -275,7 +487,7 @@ func (deployment *Deployment) runBoostrapperCommands() error {
 
 // Setup nodes
 func (deployment *Deployment) setup() error {
-	if deployment.skipSetup {
+	if deployment.options.SkipSetup {
 		return nil
 	}
 
@@ -0,0 +1,330 @@
+package deployment
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/delta"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+const testNode = "node"
+
+type testCluster struct {
+	config    *config.InternalConfig
+	transport *FakeTransport
+	files     map[string]string
+}
+
+// newTestCluster creates a config with one node, which is reached through a fake transport that emulates the shell
+// commands the deployment relies on
+func newTestCluster(t *testing.T) *testCluster {
+	_config := config.NewInternalConfig(t.TempDir())
+	_config.Config.DeploymentDirectory = "/target"
+	_config.Generate()
+
+	if _, _, _error := _config.AddNode(testNode, "192.168.100.10", 0, 0, []string{utils.NodeController, utils.NodeWorker}); _error != nil {
+		t.Fatal(_error)
+	}
+
+	cluster := &testCluster{config: _config, transport: NewFakeTransport(), files: map[string]string{}}
+
+	for _, name := range []string{utils.ConfigFilename, utils.BinaryKubelet, utils.PemCa} {
+		cluster.writeFile(t, name, []byte(name))
+	}
+
+	cluster.transport.Handler = func(command string) (string, error) {
+		switch {
+		case strings.Contains(command, "sha256sum"):
+			return cluster.transport.SHA256Sums(), nil
+
+		case strings.Contains(command, "; then cat "):
+			content, _ := cluster.transport.File(path.Join(_config.GetFullTargetAssetDirectory(utils.DirectoryDynamicData), utils.ChecksumsFilename))
+
+			return string(content), nil
+
+		case strings.Contains(command, " delta signature "):
+			tokens := strings.Fields(command)
+			filename := strings.Trim(tokens[len(tokens)-1], "'")
+
+			content, ok := cluster.transport.File(filename)
+			if !ok {
+				return "", fmt.Errorf("file '%s' not found", filename)
+			}
+
+			signature, _error := delta.NewSignature(bytes.NewReader(content), utils.DeltaBlockSize)
+			if _error != nil {
+				return "", _error
+			}
+
+			var buffer bytes.Buffer
+
+			if _error := signature.Write(&buffer); _error != nil {
+				return "", _error
+			}
+
+			return buffer.String(), nil
+		}
+
+		return "", nil
+	}
+
+	return cluster
+}
+
+func (cluster *testCluster) writeFile(t *testing.T, name string, content []byte) {
+	filename := cluster.config.GetFullLocalAssetFilename(name)
+
+	if _error := os.MkdirAll(path.Dir(filename), 0755); _error != nil {
+		t.Fatal(_error)
+	}
+
+	if _error := os.WriteFile(filename, content, 0644); _error != nil {
+		t.Fatal(_error)
+	}
+
+	cluster.files[name] = string(content)
+}
+
+func (cluster *testCluster) newDeployment(options DeploymentOptions) *Deployment {
+	options.NewTransport = func(name string, node *config.Node) Transport {
+		return cluster.transport
+	}
+
+	return NewDeployment(cluster.config, options)
+}
+
+// upload deploys the files like a deployment does and returns the number of uploads of each file
+func (cluster *testCluster) upload(t *testing.T, options DeploymentOptions) map[string]int {
+	before := map[string]int{}
+
+	for name := range cluster.files {
+		before[name] = cluster.transport.Uploads(cluster.config.GetFullTargetAssetFilename(name))
+	}
+
+	deployment := cluster.newDeployment(options)
+
+	if _error := deployment.nodes[testNode].UploadFiles(options.ForceUpload, options.SkipRestart); _error != nil {
+		t.Fatal(_error)
+	}
+
+	result := map[string]int{}
+
+	for name := range cluster.files {
+		if uploads := cluster.transport.Uploads(cluster.config.GetFullTargetAssetFilename(name)) - before[name]; uploads > 0 {
+			result[name] = uploads
+		}
+
+		content, ok := cluster.transport.File(cluster.config.GetFullTargetAssetFilename(name))
+		if !ok || string(content) != cluster.files[name] {
+			t.Errorf("file '%s' not deployed correctly", name)
+		}
+	}
+
+	return result
+}
+
+func (cluster *testCluster) restarts() int {
+	return len(cluster.transport.ExecutedCommands("systemctl start " + utils.ServiceName))
+}
+
+func (cluster *testCluster) reloads() int {
+	return len(cluster.transport.ExecutedCommands("systemctl reload-or-restart " + utils.ServiceName))
+}
+
+func TestUploadFiles(t *testing.T) {
+	cluster := newTestCluster(t)
+
+	tests := []struct {
+		name     string
+		change   string
+		options  DeploymentOptions
+		uploaded []string
+		restart  bool
+		reload   bool
+	}{
+		{name: "first deployment", uploaded: []string{utils.ConfigFilename, utils.BinaryKubelet, utils.PemCa}, restart: true},
+		{name: "nothing changed"},
+		{name: "changed file", change: utils.BinaryKubelet, uploaded: []string{utils.BinaryKubelet}, restart: true},
+		{name: "changed file without restart", change: utils.PemCa, options: DeploymentOptions{SkipRestart: true}, uploaded: []string{utils.PemCa}},
+		{name: "forced upload", options: DeploymentOptions{ForceUpload: true}, uploaded: []string{utils.ConfigFilename, utils.BinaryKubelet, utils.PemCa}, restart: true},
+		{name: "compressed upload", change: utils.PemCa, options: DeploymentOptions{CompressUploads: true}, uploaded: []string{utils.PemCa}, restart: true},
+		{name: "changed config", change: utils.ConfigFilename, uploaded: []string{utils.ConfigFilename}, reload: true},
+		{name: "changed config and file", change: utils.ConfigFilename, options: DeploymentOptions{ForceUpload: true}, uploaded: []string{utils.ConfigFilename, utils.BinaryKubelet, utils.PemCa}, restart: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if len(test.change) > 0 {
+				cluster.writeFile(t, test.change, []byte(test.name))
+			}
+
+			restarts := cluster.restarts()
+			reloads := cluster.reloads()
+
+			uploaded := cluster.upload(t, test.options)
+
+			if len(uploaded) != len(test.uploaded) {
+				t.Errorf("uploaded %v, expected %v", uploaded, test.uploaded)
+			}
+
+			for _, name := range test.uploaded {
+				if uploaded[name] != 1 {
+					t.Errorf("'%s' uploaded %d times, expected once", name, uploaded[name])
+				}
+			}
+
+			if restarted := cluster.restarts() > restarts; restarted != test.restart {
+				t.Errorf("restarted %v, expected %v", restarted, test.restart)
+			}
+
+			if reloaded := cluster.reloads() > reloads; reloaded != test.reload {
+				t.Errorf("reloaded %v, expected %v", reloaded, test.reload)
+			}
+		})
+	}
+}
+
+func TestUploadFilesServiceFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+	}{
+		{name: "stop", command: "systemctl stop " + utils.ServiceName},
+		{name: "start", command: "systemctl start " + utils.ServiceName},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cluster := newTestCluster(t)
+
+			handler := cluster.transport.Handler
+
+			cluster.transport.Handler = func(command string) (string, error) {
+				if strings.Contains(command, test.command) {
+					return "", fmt.Errorf("%s failed", test.name)
+				}
+
+				return handler(command)
+			}
+
+			deployment := cluster.newDeployment(DeploymentOptions{})
+
+			if _error := deployment.nodes[testNode].UploadFiles(false, false); _error == nil {
+				t.Fatal("expected an error")
+			}
+
+			// The node must not be recorded as deployed
+			if _, ok := cluster.transport.File(path.Join(cluster.config.GetFullTargetAssetDirectory(utils.DirectoryDynamicData), utils.ChecksumsFilename)); ok {
+				t.Error("checksums recorded")
+			}
+
+			if generations := cluster.transport.ExecutedCommands("cp -a"); len(generations) > 0 {
+				t.Errorf("generation created: %v", generations)
+			}
+		})
+	}
+}
+
+func TestDeltaUpload(t *testing.T) {
+	cluster := newTestCluster(t)
+
+	content := make([]byte, 3*utils.DeltaMinimumSize/2)
+
+	rand.New(rand.NewSource(1)).Read(content)
+
+	cluster.writeFile(t, utils.BinaryKubelet, content)
+	cluster.writeFile(t, utils.BinaryK8sTew, []byte("k8s-tew"))
+
+	filename := cluster.config.GetFullTargetAssetFilename(utils.BinaryKubelet)
+
+	// The file does not exist on the node yet, so it is uploaded as a whole
+	cluster.upload(t, DeploymentOptions{DeltaUploads: true})
+
+	if encoding := cluster.transport.Encoding(filename); len(encoding.Basis) > 0 {
+		t.Errorf("new file uploaded as delta against '%s'", encoding.Basis)
+	}
+
+	// Change a few bytes in the middle of a block
+	changed := append([]byte{}, content...)
+	copy(changed[utils.DeltaBlockSize+100:], "changed")
+
+	cluster.writeFile(t, utils.BinaryKubelet, changed)
+
+	uploaded := cluster.upload(t, DeploymentOptions{DeltaUploads: true})
+
+	if uploaded[utils.BinaryKubelet] != 1 {
+		t.Errorf("'%s' uploaded %d times, expected once", utils.BinaryKubelet, uploaded[utils.BinaryKubelet])
+	}
+
+	if encoding := cluster.transport.Encoding(filename); encoding.Basis != filename {
+		t.Errorf("changed file uploaded against basis '%s', expected '%s'", encoding.Basis, filename)
+	}
+
+	// An older k8s-tew binary on the node might not support deltas
+	cluster.transport.Files[cluster.config.GetFullTargetAssetFilename(utils.BinaryK8sTew)] = FakeFile{Content: []byte("old k8s-tew"), Mode: 0755}
+
+	copy(changed[utils.DeltaBlockSize+100:], "again")
+
+	cluster.writeFile(t, utils.BinaryKubelet, changed)
+
+	signatures := len(cluster.transport.ExecutedCommands(" delta signature "))
+
+	cluster.upload(t, DeploymentOptions{DeltaUploads: true})
+
+	if encoding := cluster.transport.Encoding(filename); len(encoding.Basis) > 0 {
+		t.Errorf("file uploaded as delta against '%s' using an older k8s-tew binary", encoding.Basis)
+	}
+
+	if len(cluster.transport.ExecutedCommands(" delta signature ")) != signatures {
+		t.Error("signature requested from an older k8s-tew binary")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	cluster := newTestCluster(t)
+
+	planUploads := func() []string {
+		plan, _error := cluster.newDeployment(DeploymentOptions{}).Plan()
+		if _error != nil {
+			t.Fatal(_error)
+		}
+
+		if len(plan.Nodes) != 1 {
+			t.Fatalf("planned %d nodes, expected one", len(plan.Nodes))
+		}
+
+		if restart := len(plan.Nodes[0].Upload) > 0; plan.Nodes[0].Restart != restart {
+			t.Errorf("planned restart %v, expected %v", plan.Nodes[0].Restart, restart)
+		}
+
+		return plan.Nodes[0].Upload
+	}
+
+	if uploads := planUploads(); len(uploads) != len(cluster.files) {
+		t.Errorf("planned uploads %v, expected %d files", uploads, len(cluster.files))
+	}
+
+	cluster.upload(t, DeploymentOptions{})
+
+	if uploads := planUploads(); len(uploads) != 0 {
+		t.Errorf("planned uploads %v after deployment, expected none", uploads)
+	}
+
+	cluster.writeFile(t, utils.PemCa, []byte("changed"))
+
+	if uploads := planUploads(); len(uploads) != 1 || uploads[0] != cluster.config.GetFullTargetAssetFilename(utils.PemCa) {
+		t.Errorf("planned uploads %v, expected only '%s'", uploads, utils.PemCa)
+	}
+
+	// Planning must not change anything on the node
+	if uploads := cluster.transport.Uploads(cluster.config.GetFullTargetAssetFilename(utils.PemCa)); uploads != 1 {
+		t.Errorf("'%s' uploaded %d times, expected once", utils.PemCa, uploads)
+	}
+}
@@ -0,0 +1,184 @@
+package deployment
+
+import (
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/etcd"
+	"github.com/darxkies/k8s-tew/pkg/generate"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// updateEtcdMembers adapts the members of an existing etcd cluster to the controllers in the config. Members of removed
+// controllers are removed. New controllers are deployed one by one, joining as learners and being promoted once they
+// caught up with the leader.
+func (deployment *Deployment) updateEtcdMembers() error {
+	if deployment.config.Config.EtcdClusterState != utils.EtcdClusterStateExisting {
+		return nil
+	}
+
+	etcdClient := etcd.NewEtcd(deployment.config)
+
+	removed, _error := etcdClient.RemoveStaleMembers()
+
+	if len(removed) > 0 {
+		members := []string{}
+
+		for _, member := range deployment.config.Config.EtcdMembers {
+			if node, ok := deployment.config.Config.Nodes[member]; ok && node.IsController() {
+				members = append(members, member)
+			}
+		}
+
+		if _error := deployment.saveEtcdMembers(members); _error != nil {
+			return _error
+		}
+	}
+
+	if _error != nil {
+		return _error
+	}
+
+	for _, nodeName := range deployment.config.GetSortedNodeKeys() {
+		nodeDeployment := deployment.nodes[nodeName]
+
+		if !nodeDeployment.node.IsController() || deployment.config.IsEtcdMember(nodeName) {
+			continue
+		}
+
+		log.WithFields(log.Fields{"node": nodeName}).Info("Joining etcd cluster")
+
+		if _error := etcdClient.AddLearner(nodeName); _error != nil {
+			return _error
+		}
+
+		// The initial cluster of the new member lists the current members and itself
+		if _error := deployment.regenerateEtcdManifests(); _error != nil {
+			return _error
+		}
+
+		if _error := nodeDeployment.UploadFiles(deployment.options.ForceUpload, false); _error != nil {
+			return errors.Wrapf(_error, "Could not deploy node '%s'", nodeName)
+		}
+
+		if _error := etcdClient.PromoteLearner(nodeName, utils.EtcdLearnerTimeout); _error != nil {
+			return _error
+		}
+
+		if _error := deployment.saveEtcdMembers(append(deployment.config.Config.EtcdMembers, nodeName)); _error != nil {
+			return _error
+		}
+	}
+
+	return nil
+}
+
+// recordEtcdMembers switches a newly created etcd cluster to the existing state, so that controllers added later join it
+func (deployment *Deployment) recordEtcdMembers() error {
+	if deployment.config.Config.EtcdClusterState == utils.EtcdClusterStateExisting {
+		return nil
+	}
+
+	members, _error := etcd.NewEtcd(deployment.config).GetMembers()
+	if _error != nil {
+		return _error
+	}
+
+	log.WithFields(log.Fields{"members": members}).Info("Recorded etcd members")
+
+	return deployment.saveEtcdMembers(members)
+}
+
+func (deployment *Deployment) saveEtcdMembers(members []string) error {
+	deployment.config.SetEtcdMembers(members)
+
+	if _error := deployment.config.Save(); _error != nil {
+		return _error
+	}
+
+	deployment.localChecksums.Forget(deployment.config.GetFullLocalAssetFilename(utils.ConfigFilename))
+
+	if _error := deployment.regenerateEtcdManifests(); _error != nil {
+		return _error
+	}
+
+	return deployment.deployEtcdMembers()
+}
+
+// deployEtcdMembers deploys the config and the etcd manifests with the recorded members without restarting the
+// service, as running etcd members ignore the cluster state. Otherwise, the next deployment would restart all
+// controllers at once. kubelet recreates the etcd pod when its manifest changed, hence the controllers are updated one
+// at a time and etcd has to be healthy again before the next one is updated.
+func (deployment *Deployment) deployEtcdMembers() error {
+	targets := map[string]bool{deployment.config.GetFullTargetAssetFilename(utils.ConfigFilename): true}
+	manifest := deployment.config.GetFullTargetAssetFilename(utils.ManifestEtcd)
+
+	targets[manifest] = true
+
+	for _, nodeName := range deployment.config.GetSortedNodeKeys() {
+		nodeDeployment := deployment.nodes[nodeName]
+
+		changedFiles, _error := nodeDeployment.prepareUpload(false)
+		if _error != nil {
+			return _error
+		}
+
+		// Other changes are left to the deployment, which restarts the service
+		files := map[string]string{}
+		manifestChanged := false
+
+		for fromFile, toFile := range changedFiles {
+			if !targets[toFile] {
+				continue
+			}
+
+			files[fromFile] = toFile
+
+			if toFile == manifest {
+				manifestChanged = true
+			}
+		}
+
+		if len(files) == 0 {
+			continue
+		}
+
+		log.WithFields(log.Fields{"node": nodeName, "files": len(files)}).Info("Deploying etcd members")
+
+		if _error := nodeDeployment.uploadFiles(files, true); _error != nil {
+			return errors.Wrapf(_error, "Could not deploy etcd members to '%s'", nodeName)
+		}
+
+		if !manifestChanged {
+			continue
+		}
+
+		// Give kubelet the time to notice the changed manifest
+		time.Sleep(utils.KubeletFileCheckFrequency * time.Second)
+
+		if _error := deployment.waitForEtcd(); _error != nil {
+			return _error
+		}
+	}
+
+	return nil
+}
+
+func (deployment *Deployment) regenerateEtcdManifests() error {
+	if _error := generate.NewGenerator(deployment.config).GenerateManifestEtcd(); _error != nil {
+		return _error
+	}
+
+	for nodeName, node := range deployment.config.Config.Nodes {
+		if !node.IsController() {
+			continue
+		}
+
+		deployment.config.SetNode(nodeName, node)
+
+		deployment.localChecksums.Forget(deployment.config.GetFullLocalAssetFilename(utils.ManifestEtcd))
+	}
+
+	return nil
+}
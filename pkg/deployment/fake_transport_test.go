@@ -0,0 +1,181 @@
+package deployment
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+// FakeFile is a file stored by the fake transport
+type FakeFile struct {
+	Content []byte
+	Mode    os.FileMode
+}
+
+// FakeTransport keeps the uploaded files in memory and records the executed commands. It is meant for unit tests.
+type FakeTransport struct {
+	// Files contains the uploaded files by their name
+	Files map[string]FakeFile
+	// Commands contains the executed commands in order
+	Commands []string
+	// Handler, if set, returns the output of a command or an error
+	Handler func(command string) (string, error)
+	// Connected is true after Connect was called and false after Close
+	Connected bool
+	uploads   map[string]int
+	encodings map[string]UploadEncoding
+	mutex     sync.Mutex
+}
+
+func NewFakeTransport() *FakeTransport {
+	return &FakeTransport{Files: map[string]FakeFile{}, Commands: []string{}, uploads: map[string]int{}, encodings: map[string]UploadEncoding{}}
+}
+
+func (transport *FakeTransport) Connect() error {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	transport.Connected = true
+
+	return nil
+}
+
+func (transport *FakeTransport) Execute(command string, stdin io.Reader, stdout io.Writer) error {
+	transport.mutex.Lock()
+
+	transport.Commands = append(transport.Commands, command)
+
+	handler := transport.Handler
+
+	transport.mutex.Unlock()
+
+	if stdin != nil {
+		if _, error := io.Copy(io.Discard, stdin); error != nil {
+			return error
+		}
+	}
+
+	if handler == nil {
+		return nil
+	}
+
+	output, error := handler(command)
+
+	if stdout != nil && len(output) > 0 {
+		if _, _error := io.WriteString(stdout, output); _error != nil {
+			return _error
+		}
+	}
+
+	return error
+}
+
+func (transport *FakeTransport) Upload(reader io.Reader, to string, mode os.FileMode, checksum string, encoding UploadEncoding) error {
+	var buffer bytes.Buffer
+
+	transport.mutex.Lock()
+	basis := transport.Files[encoding.Basis]
+	transport.mutex.Unlock()
+
+	if error := decode(reader, encoding, bytes.NewReader(basis.Content), &buffer); error != nil {
+		return error
+	}
+
+	if uploadedChecksum := fakeChecksum(buffer.Bytes()); uploadedChecksum != checksum {
+		return fmt.Errorf("checksum mismatch of '%s' (expected %s, got %s)", to, checksum, uploadedChecksum)
+	}
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	transport.Files[to] = FakeFile{Content: buffer.Bytes(), Mode: mode}
+	transport.uploads[to]++
+	transport.encodings[to] = encoding
+
+	return nil
+}
+
+func (transport *FakeTransport) Checksum(filename string) (string, error) {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	file, ok := transport.Files[filename]
+	if !ok {
+		return "", fmt.Errorf("file '%s' not found", filename)
+	}
+
+	return fakeChecksum(file.Content), nil
+}
+
+func (transport *FakeTransport) Close() {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	transport.Connected = false
+}
+
+// ExecutedCommands returns the recorded commands that contain the substring
+func (transport *FakeTransport) ExecutedCommands(substring string) []string {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	result := []string{}
+
+	for _, command := range transport.Commands {
+		if strings.Contains(command, substring) {
+			result = append(result, command)
+		}
+	}
+
+	return result
+}
+
+// File returns the content of an uploaded file
+func (transport *FakeTransport) File(filename string) ([]byte, bool) {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	file, ok := transport.Files[filename]
+
+	return file.Content, ok
+}
+
+// Uploads returns the number of times files were uploaded with the name
+func (transport *FakeTransport) Uploads(filename string) int {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	return transport.uploads[filename]
+}
+
+// Encoding returns the encoding of the last upload of the file
+func (transport *FakeTransport) Encoding(filename string) UploadEncoding {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	return transport.encodings[filename]
+}
+
+// SHA256Sums returns the checksums of all files in the format of sha256sum
+func (transport *FakeTransport) SHA256Sums() string {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	checksums := map[string]string{}
+
+	for filename, file := range transport.Files {
+		checksums[filename] = fakeChecksum(file.Content)
+	}
+
+	return utils.FormatChecksums(checksums)
+}
+
+func fakeChecksum(content []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
@@ -0,0 +1,298 @@
+package deployment
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// newGenerationID returns the ID of the generations created by a deployment. It is derived from the time the deployment
+// started, so that all nodes share the same ID for the same deployment.
+func newGenerationID() uint {
+	generation, _ := strconv.ParseUint(time.Now().UTC().Format(utils.GenerationIDFormat), 10, 64)
+
+	return uint(generation)
+}
+
+func (deployment *NodeDeployment) getGenerationsDirectory() string {
+	return path.Join(deployment.config.GetFullTargetAssetDirectory(utils.DirectoryDynamicData), utils.SubdirectoryGenerations)
+}
+
+func (deployment *NodeDeployment) getGenerationDirectory(generation uint) string {
+	return path.Join(deployment.getGenerationsDirectory(), strconv.FormatUint(uint64(generation), 10))
+}
+
+// getGenerations returns the generations stored on the node in ascending order
+func (deployment *NodeDeployment) getGenerations() ([]uint, error) {
+	directory := deployment.getGenerationsDirectory()
+
+	output, _error := deployment.Execute("list-generations", fmt.Sprintf("if [ -d %s ]; then ls -1 %s; fi", quote(directory), quote(directory)))
+	if _error != nil {
+		return nil, _error
+	}
+
+	generations := []uint{}
+
+	for _, line := range strings.Split(output, "\n") {
+		generation, _error := strconv.ParseUint(strings.TrimSpace(line), 10, 64)
+		if _error != nil {
+			continue
+		}
+
+		generations = append(generations, uint(generation))
+	}
+
+	sort.Slice(generations, func(i, j int) bool {
+		return generations[i] < generations[j]
+	})
+
+	return generations, nil
+}
+
+// createGeneration snapshots all files recorded in the checksum database. The files are hard linked, so only the
+// content of changed files takes up space, as uploads replace files instead of modifying them.
+func (deployment *NodeDeployment) createGeneration(action string) error {
+	generations, _error := deployment.getGenerations()
+	if _error != nil {
+		return _error
+	}
+
+	generation := deployment.generation
+
+	// Keep the generations in order, even if the same deployment creates more than one or the clock went backwards
+	if len(generations) > 0 && generation <= generations[len(generations)-1] {
+		generation = generations[len(generations)-1] + 1
+	}
+
+	directory := deployment.getGenerationDirectory(generation)
+	database := deployment.targetChecksumsFilename
+
+	command := fmt.Sprintf("mkdir -p %s && while read -r checksum file; do if [ -f \"$file\" ]; then mkdir -p \"%s$(dirname \"$file\")\" && (ln -f \"$file\" \"%s$file\" 2>/dev/null || cp -a \"$file\" \"%s$file\") || exit 1; fi; done < %s && cp %s %s", quote(directory), directory, directory, directory, quote(database), quote(database), quote(path.Join(directory, utils.ChecksumsFilename)))
+
+	if _, _error := deployment.Execute("create-generation", command); _error != nil {
+		return errors.Wrapf(_error, "Could not create generation %d on '%s'", generation, deployment.name)
+	}
+
+	if _error := deployment.recordGeneration(generation, action); _error != nil {
+		return _error
+	}
+
+	log.WithFields(log.Fields{"node": deployment.name, "generation": generation, "action": action}).Info("Generation created")
+
+	return deployment.pruneGenerations(append(generations, generation))
+}
+
+// recordGeneration appends an entry to the history of the node
+func (deployment *NodeDeployment) recordGeneration(generation uint, action string) error {
+	history := path.Join(deployment.getGenerationsDirectory(), utils.GenerationsHistoryFilename)
+
+	_, _error := deployment.Execute("record-generation", fmt.Sprintf("echo \"$(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ) %d %s\" >> %s", generation, action, quote(history)))
+
+	return _error
+}
+
+// getHistory returns the action that created each generation
+func (deployment *NodeDeployment) getHistory() (map[uint]string, error) {
+	history := path.Join(deployment.getGenerationsDirectory(), utils.GenerationsHistoryFilename)
+
+	output, _error := deployment.Execute("read-history", fmt.Sprintf("if [ -f %s ]; then cat %s; fi", quote(history), quote(history)))
+	if _error != nil {
+		return nil, _error
+	}
+
+	actions := map[uint]string{}
+
+	for _, line := range strings.Split(output, "\n") {
+		// Each line consists of the time, the generation and the action
+		tokens := strings.Fields(line)
+		if len(tokens) != 3 {
+			continue
+		}
+
+		generation, _error := strconv.ParseUint(tokens[1], 10, 64)
+		if _error != nil {
+			continue
+		}
+
+		actions[uint(generation)] = tokens[2]
+	}
+
+	return actions, nil
+}
+
+// getRestoredGeneration returns the generation restored by a rollback
+func getRestoredGeneration(action string) (uint, bool) {
+	if !strings.HasPrefix(action, utils.GenerationRollbackPrefix) {
+		return 0, false
+	}
+
+	generation, _error := strconv.ParseUint(strings.TrimPrefix(action, utils.GenerationRollbackPrefix), 10, 64)
+	if _error != nil {
+		return 0, false
+	}
+
+	return uint(generation), true
+}
+
+// getPreviousGeneration returns the deployed generation before the one that is currently active. A rollback activates
+// the generation it restored, so that consecutive rollbacks go further back instead of undoing each other.
+func getPreviousGeneration(generations []uint, history map[uint]string) (uint, bool) {
+	if len(generations) == 0 {
+		return 0, false
+	}
+
+	current := generations[len(generations)-1]
+
+	for i := 0; i < len(generations); i++ {
+		restored, ok := getRestoredGeneration(history[current])
+		if !ok {
+			break
+		}
+
+		current = restored
+	}
+
+	for index := len(generations) - 1; index >= 0; index-- {
+		generation := generations[index]
+
+		if generation >= current {
+			continue
+		}
+
+		if _, ok := getRestoredGeneration(history[generation]); ok {
+			continue
+		}
+
+		return generation, true
+	}
+
+	return 0, false
+}
+
+// pruneGenerations removes the oldest generations exceeding the retention count
+func (deployment *NodeDeployment) pruneGenerations(generations []uint) error {
+	retention := int(deployment.config.Config.GenerationRetention)
+
+	if retention == 0 {
+		retention = utils.GenerationRetention
+	}
+
+	if len(generations) <= retention {
+		return nil
+	}
+
+	directories := []string{}
+
+	for _, generation := range generations[:len(generations)-retention] {
+		directories = append(directories, quote(deployment.getGenerationDirectory(generation)))
+	}
+
+	_, _error := deployment.Execute("prune-generations", fmt.Sprintf("rm -Rf %s", strings.Join(directories, " ")))
+
+	return _error
+}
+
+// Rollback restores the files of a generation, restarts the service and records the rollback as a new generation.
+// If generation is zero, the generation before the current one is restored.
+func (deployment *NodeDeployment) Rollback(generation uint) error {
+	generations, _error := deployment.getGenerations()
+	if _error != nil {
+		return _error
+	}
+
+	if len(generations) == 0 {
+		return fmt.Errorf("No generations found on '%s'", deployment.name)
+	}
+
+	if generation == 0 {
+		history, _error := deployment.getHistory()
+		if _error != nil {
+			return _error
+		}
+
+		previous, ok := getPreviousGeneration(generations, history)
+		if !ok {
+			return fmt.Errorf("No previous generation found on '%s'", deployment.name)
+		}
+
+		generation = previous
+	}
+
+	found := false
+
+	for _, _generation := range generations {
+		if _generation == generation {
+			found = true
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("Generation %d not found on '%s' (available %v)", generation, deployment.name, generations)
+	}
+
+	log.WithFields(log.Fields{"node": deployment.name, "generation": generation}).Info("Rolling back")
+
+	directory := deployment.getGenerationDirectory(generation)
+	database := path.Join(directory, utils.ChecksumsFilename)
+
+	if _, _error := deployment.Execute("stop-service", fmt.Sprintf("systemctl stop %s", utils.ServiceName)); _error != nil {
+		return errors.Wrapf(_error, "Could not stop service on '%s'", deployment.name)
+	}
+
+	// The files deployed after the generation are removed. The file names start after the checksum and two spaces.
+	command := fmt.Sprintf("if [ -f %s ]; then awk 'NR == FNR { files[substr($0, 67)] = 1; next } !(substr($0, 67) in files) { print substr($0, 67) }' %s %s | while IFS= read -r file; do rm -f \"$file\" || exit 1; done; fi", quote(deployment.targetChecksumsFilename), quote(database), quote(deployment.targetChecksumsFilename))
+
+	if _, _error := deployment.Execute("remove-newer-files", command); _error != nil {
+		return errors.Wrapf(_error, "Could not remove files deployed after generation %d on '%s'", generation, deployment.name)
+	}
+
+	// Each file is restored using a rename, just like the uploads. Unchanged files are still linked to the generation.
+	command = fmt.Sprintf("while read -r checksum file; do if [ -f \"%s$file\" ] && [ ! \"%s$file\" -ef \"$file\" ]; then ln -f \"%s$file\" \"$file%s\" && mv -f \"$file%s\" \"$file\" || exit 1; fi; done < %s && cp %s %s.tmp && mv -f %s.tmp %s", directory, directory, directory, utils.UploadTemporarySuffix, utils.UploadTemporarySuffix, quote(database), quote(database), quote(deployment.targetChecksumsFilename), quote(deployment.targetChecksumsFilename), quote(deployment.targetChecksumsFilename))
+
+	if _, _error := deployment.Execute("restore-generation", command); _error != nil {
+		return errors.Wrapf(_error, "Could not restore generation %d on '%s'", generation, deployment.name)
+	}
+
+	if _, _error := deployment.Execute("start-service", fmt.Sprintf("systemctl daemon-reload && systemctl enable %s && systemctl start %s", utils.ServiceName, utils.ServiceName)); _error != nil {
+		return _error
+	}
+
+	return deployment.createGeneration(fmt.Sprintf("%s%d", utils.GenerationRollbackPrefix, generation))
+}
+
+// Rollback restores a generation on the given nodes, or on all nodes if none are given
+func (deployment *Deployment) Rollback(nodeNames []string, generation uint) error {
+	defer deployment.Close()
+
+	if len(nodeNames) == 0 {
+		nodeNames = deployment.config.GetSortedNodeKeys()
+	}
+
+	for _, nodeName := range nodeNames {
+		nodeDeployment, ok := deployment.nodes[nodeName]
+		if !ok {
+			return fmt.Errorf("Node '%s' not found", nodeName)
+		}
+
+		if _error := nodeDeployment.verifyHostKey(); _error != nil {
+			return _error
+		}
+	}
+
+	for _, nodeName := range nodeNames {
+		if _error := deployment.nodes[nodeName].Rollback(generation); _error != nil {
+			return _error
+		}
+
+		utils.IncreaseProgressStep()
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package deployment
+
+import (
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+// serviceTransport runs the commands locally, except for the ones controlling the service
+type serviceTransport struct {
+	*LocalTransport
+}
+
+func (transport serviceTransport) Connect() error {
+	return nil
+}
+
+func (transport serviceTransport) Execute(command string, stdin io.Reader, stdout io.Writer) error {
+	if strings.Contains(command, "systemctl") {
+		return nil
+	}
+
+	return transport.LocalTransport.Execute(command, stdin, stdout)
+}
+
+func TestGetPreviousGeneration(t *testing.T) {
+	tests := []struct {
+		name        string
+		generations []uint
+		history     map[uint]string
+		previous    uint
+	}{
+		{name: "no generations"},
+		{name: "one generation", generations: []uint{1}, history: map[uint]string{1: "deploy"}},
+		{name: "deployments", generations: []uint{1, 2, 3}, history: map[uint]string{1: "deploy", 2: "deploy", 3: "deploy"}, previous: 2},
+		{name: "without history", generations: []uint{1, 2, 3}, previous: 2},
+		{name: "after a rollback", generations: []uint{1, 2, 3, 4}, history: map[uint]string{1: "deploy", 2: "deploy", 3: "deploy", 4: "rollback-to-2"}, previous: 1},
+		{name: "after two rollbacks", generations: []uint{1, 2, 3, 4, 5}, history: map[uint]string{1: "deploy", 2: "deploy", 3: "deploy", 4: "rollback-to-2", 5: "rollback-to-1"}},
+		{name: "after a rollback to a pruned generation", generations: []uint{3, 4}, history: map[uint]string{3: "deploy", 4: "rollback-to-2"}},
+		{name: "deployment after a rollback", generations: []uint{1, 2, 3, 4, 5}, history: map[uint]string{1: "deploy", 2: "deploy", 3: "deploy", 4: "rollback-to-2", 5: "deploy"}, previous: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous, ok := getPreviousGeneration(test.generations, test.history)
+
+			if ok != (test.previous > 0) || previous != test.previous {
+				t.Errorf("got %d (%v), expected %d", previous, ok, test.previous)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	_config := config.NewInternalConfig(t.TempDir())
+	_config.Config.DeploymentDirectory = t.TempDir()
+	_config.Generate()
+
+	if _, _, _error := _config.AddNode(testNode, "192.168.100.10", 0, 0, []string{utils.NodeController, utils.NodeWorker}); _error != nil {
+		t.Fatal(_error)
+	}
+
+	cluster := &testCluster{config: _config, files: map[string]string{}}
+
+	deploy := func(version string, names ...string) uint {
+		for _, name := range names {
+			cluster.writeFile(t, name, []byte(version))
+		}
+
+		deployment := NewDeployment(_config, DeploymentOptions{NewTransport: func(name string, node *config.Node) Transport {
+			return serviceTransport{NewLocalTransport()}
+		}})
+
+		if _error := deployment.nodes[testNode].UploadFiles(false, false); _error != nil {
+			t.Fatal(_error)
+		}
+
+		return deployment.nodes[testNode].generation
+	}
+
+	rollback := func(generation uint) {
+		deployment := NewDeployment(_config, DeploymentOptions{NewTransport: func(name string, node *config.Node) Transport {
+			return serviceTransport{NewLocalTransport()}
+		}})
+
+		if _error := deployment.Rollback(nil, generation); _error != nil {
+			t.Fatal(_error)
+		}
+	}
+
+	expect := func(name, content string) {
+		t.Helper()
+
+		data, _error := os.ReadFile(_config.GetFullTargetAssetFilename(name))
+
+		if len(content) == 0 {
+			if !os.IsNotExist(_error) {
+				t.Errorf("'%s' exists", name)
+			}
+
+			return
+		}
+
+		if string(data) != content {
+			t.Errorf("'%s' contains '%s', expected '%s'", name, data, content)
+		}
+	}
+
+	first := deploy("v1", utils.ConfigFilename, utils.PemCa)
+
+	// The generation is named after the deployment
+	if _, _error := os.Stat(path.Join(_config.GetFullTargetAssetDirectory(utils.DirectoryDynamicData), utils.SubdirectoryGenerations, strconv.FormatUint(uint64(first), 10))); _error != nil {
+		t.Error(_error)
+	}
+
+	deploy("v2", utils.PemCa, utils.BinaryKubelet)
+	deploy("v3", utils.PemCa)
+
+	rollback(0)
+
+	expect(utils.PemCa, "v2")
+	expect(utils.BinaryKubelet, "v2")
+
+	// A second rollback goes further back instead of undoing the first one
+	rollback(0)
+
+	expect(utils.PemCa, "v1")
+	expect(utils.ConfigFilename, "v1")
+	expect(utils.BinaryKubelet, "")
+}
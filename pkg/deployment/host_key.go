@@ -0,0 +1,204 @@
+package deployment
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type HostKeyVerifier struct {
+	config             *config.InternalConfig
+	knownHostsFilename string
+	recordedFilename   string
+	acceptNewHostKeys  bool
+	dryRun             bool
+	recorded           map[string]ssh.PublicKey
+	mutex              sync.Mutex
+}
+
+func NewHostKeyVerifier(config *config.InternalConfig, knownHostsFilename string, acceptNewHostKeys bool) *HostKeyVerifier {
+	return &HostKeyVerifier{config: config, knownHostsFilename: knownHostsFilename, recordedFilename: path.Join(config.GetFullLocalAssetDirectory(utils.DirectoryDynamicData), utils.KnownHostsFilename), acceptNewHostKeys: acceptNewHostKeys, recorded: map[string]ssh.PublicKey{}}
+}
+
+// Callback returns a host key callback for the node. Keys listed in the known_hosts file take precedence,
+// unknown hosts fall back to the keys k8s-tew records in its own known_hosts file on first use.
+func (verifier *HostKeyVerifier) Callback(nodeName string, node *config.Node) ssh.HostKeyCallback {
+	return verifier.callback(nodeName, node.HostKey)
+}
+
+// JumpHostCallback returns a host key callback for a jump host
+func (verifier *HostKeyVerifier) JumpHostCallback(address string) ssh.HostKeyCallback {
+	return verifier.callback(address, verifier.config.Config.SSH.HostKeys[address])
+}
+
+// callback verifies the key against the known_hosts file of the user and then against the recorded keys. Fingerprints
+// recorded in the config by previous versions are still accepted and moved to the recorded keys.
+func (verifier *HostKeyVerifier) callback(name string, legacyFingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fingerprint := ssh.FingerprintSHA256(key)
+
+		if len(verifier.knownHostsFilename) > 0 && utils.FileExists(verifier.knownHostsFilename) {
+			callback, _error := knownhosts.New(verifier.knownHostsFilename)
+			if _error != nil {
+				return errors.Wrapf(_error, "Could not load known hosts from %s", verifier.knownHostsFilename)
+			}
+
+			_error = callback(hostname, remote, key)
+
+			if _error == nil {
+				return nil
+			}
+
+			keyError, ok := _error.(*knownhosts.KeyError)
+			if !ok {
+				return _error
+			}
+
+			// The host is listed with a different key. The file is maintained by the user, so --accept-new-host-keys does not apply.
+			if len(keyError.Want) > 0 {
+				return fmt.Errorf("Host key of '%s' (%s) does not match the one in %s (got %s). If the change is expected, remove the old entry with 'ssh-keygen -R %s'", name, hostname, verifier.knownHostsFilename, fingerprint, knownhosts.Normalize(hostname))
+			}
+		}
+
+		return verifier.verifyRecorded(name, knownhosts.Normalize(hostname), key, legacyFingerprint)
+	}
+}
+
+func (verifier *HostKeyVerifier) verifyRecorded(name, host string, key ssh.PublicKey, legacyFingerprint string) error {
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+
+	fingerprint := ssh.FingerprintSHA256(key)
+
+	oldFingerprint, _error := verifier.getRecordedFingerprint(host)
+	if _error != nil {
+		return _error
+	}
+
+	if len(oldFingerprint) == 0 {
+		oldFingerprint = legacyFingerprint
+	}
+
+	if oldFingerprint == fingerprint {
+		// Keys recorded in the config are moved to the known_hosts file of k8s-tew
+		if _, ok := verifier.recorded[host]; ok {
+			return nil
+		}
+
+	} else if len(oldFingerprint) > 0 {
+		if !verifier.acceptNewHostKeys {
+			return fmt.Errorf("Host key of '%s' (%s) changed from %s to %s. If the change is expected, run the command again with --accept-new-host-keys", name, host, oldFingerprint, fingerprint)
+		}
+
+		log.WithFields(log.Fields{"name": name, "old": oldFingerprint, "new": fingerprint}).Info("Accepting changed host key")
+
+	} else {
+		log.WithFields(log.Fields{"name": name, "fingerprint": fingerprint}).Info("Recording host key")
+	}
+
+	verifier.recorded[host] = key
+
+	// Keep the key only in memory, nothing may be changed
+	if verifier.dryRun {
+		return nil
+	}
+
+	if _error := verifier.saveRecorded(host, key); _error != nil {
+		return errors.Wrapf(_error, "Could not record host key of '%s'", name)
+	}
+
+	return nil
+}
+
+// getRecordedFingerprint returns the fingerprint of the recorded key of the host or an empty string if none is recorded
+func (verifier *HostKeyVerifier) getRecordedFingerprint(host string) (string, error) {
+	if key, ok := verifier.recorded[host]; ok {
+		return ssh.FingerprintSHA256(key), nil
+	}
+
+	lines, _error := verifier.readRecorded()
+	if _error != nil {
+		return "", _error
+	}
+
+	for _, line := range lines {
+		_, hosts, key, _, _, _error := ssh.ParseKnownHosts([]byte(line))
+		if _error != nil {
+			continue
+		}
+
+		for _, _host := range hosts {
+			if _host == host {
+				verifier.recorded[host] = key
+
+				return ssh.FingerprintSHA256(key), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func (verifier *HostKeyVerifier) readRecorded() ([]string, error) {
+	content, _error := os.ReadFile(verifier.recordedFilename)
+	if os.IsNotExist(_error) {
+		return []string{}, nil
+	}
+
+	if _error != nil {
+		return nil, errors.Wrapf(_error, "Could not read recorded host keys from '%s'", verifier.recordedFilename)
+	}
+
+	lines := []string{}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if len(strings.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
+
+// saveRecorded replaces the recorded key of the host. The keys are stored in the format of known_hosts outside of the
+// config, so that recording a key neither changes the deployed files nor the journal of the deployment.
+func (verifier *HostKeyVerifier) saveRecorded(host string, key ssh.PublicKey) error {
+	lines, _error := verifier.readRecorded()
+	if _error != nil {
+		return _error
+	}
+
+	result := []string{}
+
+	for _, line := range lines {
+		if _, hosts, _, _, _, _error := ssh.ParseKnownHosts([]byte(line)); _error == nil && len(hosts) == 1 && hosts[0] == host {
+			continue
+		}
+
+		result = append(result, line)
+	}
+
+	result = append(result, knownhosts.Line([]string{host}, key))
+
+	if _error := utils.CreateDirectoryIfMissing(path.Dir(verifier.recordedFilename)); _error != nil {
+		return _error
+	}
+
+	temporaryFilename := verifier.recordedFilename + ".tmp"
+
+	if _error := os.WriteFile(temporaryFilename, []byte(strings.Join(result, "\n")+"\n"), 0600); _error != nil {
+		return _error
+	}
+
+	return os.Rename(temporaryFilename, verifier.recordedFilename)
+}
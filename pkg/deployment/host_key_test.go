@@ -0,0 +1,110 @@
+package deployment
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	publicKey, _, _error := ed25519.GenerateKey(rand.Reader)
+	if _error != nil {
+		t.Fatal(_error)
+	}
+
+	key, _error := ssh.NewPublicKey(publicKey)
+	if _error != nil {
+		t.Fatal(_error)
+	}
+
+	return key
+}
+
+func TestHostKeyVerifier(t *testing.T) {
+	const hostname = "192.168.100.10:22"
+
+	remote := &net.TCPAddr{IP: net.ParseIP("192.168.100.10"), Port: 22}
+	oldKey := newTestHostKey(t)
+	newKey := newTestHostKey(t)
+
+	tests := []struct {
+		name string
+		// legacy is the fingerprint recorded in the config by previous versions
+		legacy     ssh.PublicKey
+		recorded   ssh.PublicKey
+		key        ssh.PublicKey
+		accept     bool
+		dryRun     bool
+		failure    bool
+		recordedAs ssh.PublicKey
+	}{
+		{name: "first use", key: oldKey, recordedAs: oldKey},
+		{name: "first use in dry run", key: oldKey, dryRun: true},
+		{name: "unchanged", recorded: oldKey, key: oldKey, recordedAs: oldKey},
+		{name: "changed", recorded: oldKey, key: newKey, failure: true, recordedAs: oldKey},
+		{name: "changed and accepted", recorded: oldKey, key: newKey, accept: true, recordedAs: newKey},
+		{name: "recorded in the config", legacy: oldKey, key: oldKey, recordedAs: oldKey},
+		{name: "changed since recorded in the config", legacy: oldKey, key: newKey, failure: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_config := config.NewInternalConfig(t.TempDir())
+			_config.Generate()
+
+			node := &config.Node{IP: "192.168.100.10"}
+
+			if test.legacy != nil {
+				node.HostKey = ssh.FingerprintSHA256(test.legacy)
+			}
+
+			if test.recorded != nil {
+				verifier := NewHostKeyVerifier(_config, "", false)
+
+				if _error := verifier.Callback(testNode, node)(hostname, remote, test.recorded); _error != nil {
+					t.Fatal(_error)
+				}
+			}
+
+			configContent, _ := os.ReadFile(path.Join(_config.BaseDirectory, utils.SubdirectoryConfig, utils.SubdirectoryK8sTew, utils.ConfigFilename))
+
+			verifier := NewHostKeyVerifier(_config, path.Join(t.TempDir(), "missing"), test.accept)
+			verifier.dryRun = test.dryRun
+
+			_error := verifier.Callback(testNode, node)(hostname, remote, test.key)
+
+			if failure := _error != nil; failure != test.failure {
+				t.Fatalf("got error %v, expected failure %v", _error, test.failure)
+			}
+
+			// A new verifier only knows the keys written to the file
+			fingerprint, _error := NewHostKeyVerifier(_config, "", false).getRecordedFingerprint(knownhosts.Normalize(hostname))
+			if _error != nil {
+				t.Fatal(_error)
+			}
+
+			expected := ""
+
+			if test.recordedAs != nil {
+				expected = ssh.FingerprintSHA256(test.recordedAs)
+			}
+
+			if fingerprint != expected {
+				t.Errorf("recorded %q, expected %q", fingerprint, expected)
+			}
+
+			// The config must never change, as it is deployed to the nodes
+			if content, _ := os.ReadFile(path.Join(_config.BaseDirectory, utils.SubdirectoryConfig, utils.SubdirectoryK8sTew, utils.ConfigFilename)); string(content) != string(configContent) {
+				t.Error("config changed")
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package deployment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Journal records the completed steps of a deployment, so that a failed deployment can be resumed
+type Journal struct {
+	filename    string
+	Fingerprint string          `yaml:"fingerprint"`
+	Steps       map[string]bool `yaml:"steps"`
+	mutex       sync.Mutex
+}
+
+func NewJournal(filename string) *Journal {
+	return &Journal{filename: filename, Steps: map[string]bool{}}
+}
+
+// GetFingerprint hashes the config and the checksums of all generated assets
+func GetFingerprint(_config *config.InternalConfig, checksums *utils.Checksums) (string, error) {
+	hash := sha256.New()
+
+	content, _error := yaml.Marshal(_config.Config)
+	if _error != nil {
+		return "", _error
+	}
+
+	hash.Write(content)
+
+	names := []string{}
+
+	for name := range _config.Config.Assets.Files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		filename := _config.GetFullLocalAssetFilename(name)
+
+		if !utils.FileExists(filename) {
+			continue
+		}
+
+		checksum, _error := checksums.GetChecksum(filename)
+		if _error != nil {
+			return "", _error
+		}
+
+		fmt.Fprintf(hash, "%s %s\n", name, checksum)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Resume loads the journal, unless it was written for a different config or different assets
+func (journal *Journal) Resume(fingerprint string) error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	journal.Fingerprint = fingerprint
+	journal.Steps = map[string]bool{}
+
+	content, _error := os.ReadFile(journal.filename)
+	if os.IsNotExist(_error) {
+		log.Info("No journal found, starting from the beginning")
+
+		return nil
+	}
+
+	if _error != nil {
+		return errors.Wrapf(_error, "Could not read journal %s", journal.filename)
+	}
+
+	previous := NewJournal(journal.filename)
+
+	if _error := yaml.Unmarshal(content, previous); _error != nil {
+		return errors.Wrapf(_error, "Could not parse journal %s", journal.filename)
+	}
+
+	if previous.Fingerprint != fingerprint {
+		log.Info("Config or assets changed since the journal was written, starting from the beginning")
+
+		return nil
+	}
+
+	journal.Steps = previous.Steps
+
+	log.WithFields(log.Fields{"completed-steps": len(journal.Steps)}).Info("Resuming deployment")
+
+	return nil
+}
+
+// Reset starts a new journal
+func (journal *Journal) Reset(fingerprint string) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	journal.Fingerprint = fingerprint
+	journal.Steps = map[string]bool{}
+}
+
+func (journal *Journal) IsDone(step string) bool {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	if journal.Steps[step] {
+		log.WithFields(log.Fields{"step": step}).Info("Skipping completed step")
+
+		return true
+	}
+
+	return false
+}
+
+// Done marks the step as completed and persists the journal
+func (journal *Journal) Done(step string) error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	journal.Steps[step] = true
+
+	content, _error := yaml.Marshal(journal)
+	if _error != nil {
+		return _error
+	}
+
+	if _error := os.WriteFile(journal.filename, content, 0644); _error != nil {
+		return errors.Wrapf(_error, "Could not write journal %s", journal.filename)
+	}
+
+	return nil
+}
+
+// Remove deletes the journal once the deployment succeeded
+func (journal *Journal) Remove() {
+	if _error := os.Remove(journal.filename); _error != nil && !os.IsNotExist(_error) {
+		log.WithFields(log.Fields{"error": _error, "filename": journal.filename}).Error("Could not remove journal")
+	}
+}
+
+func uploadStep(nodeName string) string {
+	return fmt.Sprintf("upload/%s", nodeName)
+}
+
+func taintStep(nodeName string) string {
+	return fmt.Sprintf("taint/%s", nodeName)
+}
+
+func importImageStep(nodeName, image string) string {
+	return fmt.Sprintf("import-image/%s/%s", nodeName, image)
+}
+
+func commandStep(name string) string {
+	return fmt.Sprintf("command/%s", name)
+}
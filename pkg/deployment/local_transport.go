@@ -0,0 +1,103 @@
+package deployment
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// LocalTransport deploys to the machine k8s-tew is running on, without SSH. It requires root rights.
+type LocalTransport struct {
+}
+
+func NewLocalTransport() *LocalTransport {
+	return &LocalTransport{}
+}
+
+func (transport *LocalTransport) Connect() error {
+	if !utils.IsRoot() {
+		return fmt.Errorf("the local transport requires root rights")
+	}
+
+	return nil
+}
+
+func (transport *LocalTransport) Execute(command string, stdin io.Reader, stdout io.Writer) error {
+	cmd := exec.Command("sh", "-c", command)
+
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+
+	return cmd.Run()
+}
+
+// Upload writes the content to a temporary file next to the destination, verifies its checksum and renames it atomically
+func (transport *LocalTransport) Upload(reader io.Reader, to string, mode os.FileMode, checksum string, encoding UploadEncoding) error {
+	temporaryFilename := to + utils.UploadTemporarySuffix
+
+	if error := transport.write(reader, encoding, temporaryFilename, mode); error != nil {
+		_ = os.Remove(temporaryFilename)
+
+		return error
+	}
+
+	localChecksum, error := transport.Checksum(temporaryFilename)
+
+	if error != nil || localChecksum != checksum {
+		_ = os.Remove(temporaryFilename)
+
+		return fmt.Errorf("checksum mismatch of '%s' (expected %s, got %s)", to, checksum, localChecksum)
+	}
+
+	if error := os.Rename(temporaryFilename, to); error != nil {
+		_ = os.Remove(temporaryFilename)
+
+		return errors.Wrapf(error, "Could not rename '%s' to '%s'", temporaryFilename, to)
+	}
+
+	return nil
+}
+
+func (transport *LocalTransport) write(reader io.Reader, encoding UploadEncoding, filename string, mode os.FileMode) error {
+	var basis *os.File
+
+	if len(encoding.Basis) > 0 {
+		var error error
+
+		basis, error = os.Open(encoding.Basis)
+		if error != nil {
+			return errors.Wrapf(error, "Could not open '%s'", encoding.Basis)
+		}
+
+		defer basis.Close()
+	}
+
+	file, error := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if error != nil {
+		return errors.Wrapf(error, "Could not create '%s'", filename)
+	}
+
+	defer file.Close()
+
+	if error := decode(reader, encoding, basis, file); error != nil {
+		return errors.Wrapf(error, "Could not write '%s'", filename)
+	}
+
+	if error := file.Sync(); error != nil {
+		return errors.Wrapf(error, "Could not sync '%s'", filename)
+	}
+
+	// The mode passed to OpenFile is masked by the umask
+	return file.Chmod(mode)
+}
+
+func (transport *LocalTransport) Checksum(filename string) (string, error) {
+	return utils.SHA256(filename)
+}
+
+func (transport *LocalTransport) Close() {
+}
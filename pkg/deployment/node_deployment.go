@@ -2,33 +2,23 @@ package deployment
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/darxkies/k8s-tew/pkg/config"
 	"github.com/darxkies/k8s-tew/pkg/k8s"
 	"github.com/darxkies/k8s-tew/pkg/utils"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	"github.com/tmc/scp"
-	"golang.org/x/crypto/ssh"
 )
 
-type Session struct {
-	client  *ssh.Client
-	session *ssh.Session
-}
-
-func (session *Session) Close() {
-	session.session.Close()
-	session.client.Close()
-}
-
 type NodeDeployment struct {
-	identityFile            string
 	name                    string
 	node                    *config.Node
 	config                  *config.InternalConfig
@@ -36,10 +26,22 @@ type NodeDeployment struct {
 	parallel                bool
 	targetChecksumsFilename string
 	localChecksums          *utils.Checksums
+	transport               Transport
+	compressUploads         bool
+	deltaUploads            bool
+	deltaOnce               sync.Once
+	deltaSupported          bool
+	report                  *Report
+	generation              uint
 }
 
-func NewNodeDeployment(identityFile string, name string, node *config.Node, config *config.InternalConfig, parallel bool, localChecksums *utils.Checksums) *NodeDeployment {
-	return &NodeDeployment{identityFile: identityFile, name: name, node: node, config: config, sshLimiter: utils.NewLimiter(utils.ConcurrentSshConnectionsLimit), parallel: parallel, targetChecksumsFilename: path.Join(config.GetFullTargetAssetDirectory(utils.DirectoryDynamicData), "checksums"), localChecksums: localChecksums}
+func NewNodeDeployment(name string, node *config.Node, config *config.InternalConfig, parallel bool, localChecksums *utils.Checksums, transport Transport, compressUploads, deltaUploads bool) *NodeDeployment {
+	return &NodeDeployment{name: name, node: node, config: config, sshLimiter: utils.NewLimiter(utils.ConcurrentSshConnectionsLimit), parallel: parallel, targetChecksumsFilename: path.Join(config.GetFullTargetAssetDirectory(utils.DirectoryDynamicData), utils.ChecksumsFilename), localChecksums: localChecksums, transport: transport, compressUploads: compressUploads, deltaUploads: deltaUploads}
+}
+
+// Close releases the connection to the node
+func (deployment *NodeDeployment) Close() {
+	deployment.transport.Close()
 }
 
 func (deployment *NodeDeployment) Steps(skipRestart bool) (result int) {
@@ -70,7 +72,7 @@ func (deployment *NodeDeployment) Steps(skipRestart bool) (result int) {
 	return
 }
 
-func (deployment *NodeDeployment) md5sum(filename string) (result string, error error) {
+func (deployment *NodeDeployment) checksum(filename string) (result string, error error) {
 	return deployment.localChecksums.GetChecksum(filename)
 }
 
@@ -138,35 +140,58 @@ func (deployment *NodeDeployment) getFiles() map[string]string {
 	return files
 }
 
+// getRemoteChecksumDatabase returns the checksums recorded on the node
+func (deployment *NodeDeployment) getRemoteChecksumDatabase() map[string]string {
+	output, _ := deployment.Execute("get-checksum-database", fmt.Sprintf("if [ -f %s ]; then cat %s; fi", quote(deployment.targetChecksumsFilename), quote(deployment.targetChecksumsFilename)))
+
+	return utils.ParseChecksums(output)
+}
+
 func (deployment *NodeDeployment) getRemoteFileChecksums() map[string]string {
-	// Calculate checksums of remote files
+	database := deployment.getRemoteChecksumDatabase()
+
+	// Files that were not modified since the database was written are marked with '-', all others are hashed
 	checksumCommand := "for i in"
 
 	for _, toFile := range deployment.getFiles() {
-		checksumCommand += fmt.Sprintf(" '%s'", toFile)
+		checksumCommand += " " + quote(toFile)
 	}
 
-	checksumCommand += fmt.Sprintf("; do if [ -f $i ]; then if [ $i -ot '%s' ]; then grep -e \" $i$\" '%s'; else md5sum $i; fi; fi; done", deployment.targetChecksumsFilename, deployment.targetChecksumsFilename)
+	checksumCommand += fmt.Sprintf("; do if [ -f \"$i\" ]; then if [ \"$i\" -ot %s ]; then echo \"- $i\"; else sha256sum \"$i\"; fi; fi; done", quote(deployment.targetChecksumsFilename))
 
 	output, _ := deployment.Execute("get-checksums", checksumCommand)
 
-	// Parse remote checksum values
-	checksums := map[string]string{}
-	lines := strings.Split(output, "\n")
+	checksums := utils.ParseChecksums(output)
 
-	for _, line := range lines {
-		if len(line) == 0 {
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "- ") {
 			continue
 		}
 
-		tokens := strings.Split(line, " ")
+		filename := line[2:]
 
-		checksums[tokens[len(tokens)-1]] = tokens[0]
+		if checksum, ok := database[filename]; ok {
+			checksums[filename] = checksum
+		}
 	}
 
 	return checksums
 }
 
+// updateRemoteChecksumDatabase records the checksums of the uploaded files on the node
+func (deployment *NodeDeployment) updateRemoteChecksumDatabase(checksums map[string]string) error {
+	database := deployment.getRemoteChecksumDatabase()
+
+	for filename, checksum := range checksums {
+		database[filename] = checksum
+	}
+
+	content := []byte(utils.FormatChecksums(database))
+	hash := sha256.Sum256(content)
+
+	return deployment.transport.Upload(bytes.NewReader(content), deployment.targetChecksumsFilename, 0644, hex.EncodeToString(hash[:]), UploadEncoding{})
+}
+
 func (deployment *NodeDeployment) getChangedFiles() map[string]string {
 	remoteFileChecksums := deployment.getRemoteFileChecksums()
 
@@ -179,7 +204,7 @@ func (deployment *NodeDeployment) getChangedFiles() map[string]string {
 		}
 
 		if remoteChecksum, ok := remoteFileChecksums[toFile]; ok {
-			localChecksum, error := deployment.md5sum(fromFile)
+			localChecksum, error := deployment.checksum(fromFile)
 
 			if error == nil && localChecksum == remoteChecksum {
 				continue
@@ -194,29 +219,89 @@ func (deployment *NodeDeployment) getChangedFiles() map[string]string {
 	return files
 }
 
-func (deployment *NodeDeployment) UploadFiles(forceUpload bool, skipRestart bool) (_error error) {
-	if _error = deployment.createDirectories(); _error != nil {
-		return
+// getCleanupFiles returns the files that must not exist on the node
+func (deployment *NodeDeployment) getCleanupFiles() []string {
+	cleanupFiles := []string{}
+
+	// Remove controller manifests on controllers
+	if deployment.node.IsControllerOnly() {
+		if len(deployment.config.Config.ControllerVirtualIP) == 0 || len(deployment.config.Config.ControllerVirtualIPInterface) == 0 {
+			cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestControllerVirtualIP))
+		}
 	}
 
-	var files map[string]string
+	// Remove controller manifests on workers
+	if deployment.node.IsWorkerOnly() {
+		cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestControllerVirtualIP))
+		cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestEtcd))
+		cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestKubeApiserver))
+		cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestKubeControllerManager))
+		cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestKubeScheduler))
 
+		if len(deployment.config.Config.WorkerVirtualIP) == 0 || len(deployment.config.Config.WorkerVirtualIPInterface) == 0 {
+			cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestWorkerVirtualIP))
+		}
+	}
+
+	return cleanupFiles
+}
+
+func (deployment *NodeDeployment) UploadFiles(forceUpload bool, skipRestart bool) error {
+	files, _error := deployment.prepareUpload(forceUpload)
+	if _error != nil {
+		return _error
+	}
+
+	return deployment.uploadFiles(files, skipRestart)
+}
+
+// prepareUpload creates the remote directories and returns the files that have to be uploaded
+func (deployment *NodeDeployment) prepareUpload(forceUpload bool) (map[string]string, error) {
+	if _error := deployment.createDirectories(); _error != nil {
+		return nil, _error
+	}
+
+	return deployment.getUploadFiles(forceUpload), nil
+}
+
+// getUploadFiles returns all files if the upload is forced, otherwise only the changed files
+func (deployment *NodeDeployment) getUploadFiles(forceUpload bool) map[string]string {
 	if forceUpload {
-		files = deployment.getFiles()
-	} else {
-		files = deployment.getChangedFiles()
+		return deployment.getFiles()
 	}
 
-	if len(files) > 0 && !skipRestart {
+	return deployment.getChangedFiles()
+}
+
+func (deployment *NodeDeployment) uploadFiles(files map[string]string, skipRestart bool) (_error error) {
+	log.WithFields(log.Fields{"node": deployment.name, "files": len(files)}).Info("Uploading files")
+
+	// Changes of the config and the manifests are applied by reloading the service, which keeps the unchanged servers running
+	reload := deployment.isReloadable(files)
+
+	if len(files) > 0 && !skipRestart && !reload {
 		// Stop service
-		_, _ = deployment.Execute("stop-service", fmt.Sprintf("systemctl stop %s", utils.ServiceName))
+		start := time.Now()
+
+		_, _error = deployment.Execute("stop-service", fmt.Sprintf("systemctl stop %s", utils.ServiceName))
+
+		deployment.report.Record(deployment.name, ReportStepStop, utils.ServiceName, start, 0, _error)
+
+		if _error != nil {
+			return _error
+		}
 	}
 
 	utils.IncreaseProgressStep()
 
+	// The k8s-tew binary on the node is checked before it is replaced by the uploads
+	if deployment.deltaUploads && len(files) > 0 {
+		deployment.supportsDelta()
+	}
+
 	tasks := utils.Tasks{}
 
-	filesList := ""
+	filesList := []string{}
 
 	for name, file := range deployment.config.Config.Assets.Files {
 		fromFile := deployment.config.GetFullLocalAssetFilename(name)
@@ -234,11 +319,7 @@ func (deployment *NodeDeployment) UploadFiles(forceUpload bool, skipRestart bool
 			continue
 		}
 
-		if len(filesList) >= 0 {
-			filesList += " "
-		}
-
-		filesList += fmt.Sprintf("'%s'", toFile)
+		filesList = append(filesList, toFile)
 
 		tasks = append(tasks, func() error {
 			defer utils.IncreaseProgressStep()
@@ -252,31 +333,15 @@ func (deployment *NodeDeployment) UploadFiles(forceUpload bool, skipRestart bool
 		return errors[0]
 	}
 
-	cleanupFiles := []string{}
-
-	// Remove controller manifests on controllers
-	if deployment.node.IsControllerOnly() {
-		if len(deployment.config.Config.ControllerVirtualIP) == 0 || len(deployment.config.Config.ControllerVirtualIPInterface) == 0 {
-			cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestControllerVirtualIP))
-		}
-	}
-
-	// Remove controller manifests on workers
-	if deployment.node.IsWorkerOnly() {
-		cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestControllerVirtualIP))
-		cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestEtcd))
-		cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestKubeApiserver))
-		cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestKubeControllerManager))
-		cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestKubeScheduler))
-
-		if len(deployment.config.Config.WorkerVirtualIP) == 0 || len(deployment.config.Config.WorkerVirtualIPInterface) == 0 {
-			cleanupFiles = append(cleanupFiles, deployment.config.GetFullTargetAssetFilename(utils.ManifestWorkerVirtualIP))
-		}
-	}
+	cleanupFiles := deployment.getCleanupFiles()
 
 	if len(cleanupFiles) > 0 {
+		start := time.Now()
+
 		_, _error = deployment.Execute("cleanup-files", fmt.Sprintf("rm -Rf %s", strings.Join(cleanupFiles, " ")))
 
+		deployment.report.Record(deployment.name, ReportStepCleanup, strings.Join(cleanupFiles, ","), start, 0, _error)
+
 		if _error != nil {
 			return _error
 		}
@@ -285,18 +350,46 @@ func (deployment *NodeDeployment) UploadFiles(forceUpload bool, skipRestart bool
 	utils.IncreaseProgressStep()
 
 	if len(files) > 0 && !skipRestart {
-		// Registrate and start service
-		_, _error = deployment.Execute("start-service", fmt.Sprintf("systemctl daemon-reload && systemctl enable %s && systemctl start %s", utils.ServiceName, utils.ServiceName))
+		start := time.Now()
+
+		if reload {
+			// The service is started instead if it is not running
+			_, _error = deployment.Execute("reload-service", fmt.Sprintf("systemctl reload-or-restart %s", utils.ServiceName))
+
+			deployment.report.Record(deployment.name, ReportStepReload, utils.ServiceName, start, 0, _error)
+
+		} else {
+			// Registrate and start service
+			_, _error = deployment.Execute("start-service", fmt.Sprintf("systemctl daemon-reload && systemctl enable %s && systemctl start %s", utils.ServiceName, utils.ServiceName))
+
+			deployment.report.Record(deployment.name, ReportStepRestart, utils.ServiceName, start, 0, _error)
+		}
+
+		// A node whose service did not start must not be recorded as deployed
+		if _error != nil {
+			return _error
+		}
 	}
 
 	utils.IncreaseProgressStep()
 
 	if len(filesList) > 0 {
-		command := fmt.Sprintf("for i in %s; do if [ -f '%s' ]; then grep -ve \" $i$\" '%s' > /tmp/checksums; mv /tmp/checksums %s; fi; md5sum $i >> '%s'; done", filesList, deployment.targetChecksumsFilename, deployment.targetChecksumsFilename, deployment.targetChecksumsFilename, deployment.targetChecksumsFilename)
+		checksums := map[string]string{}
 
-		_, _error = deployment.Execute("update-checkups", command)
+		for fromFile, toFile := range files {
+			checksum, _error := deployment.checksum(fromFile)
+			if _error != nil {
+				return _error
+			}
 
-		if _error != nil {
+			checksums[toFile] = checksum
+		}
+
+		if _error = deployment.updateRemoteChecksumDatabase(checksums); _error != nil {
+			return errors.Wrapf(_error, "Could not update checksums on '%s'", deployment.name)
+		}
+
+		if _error = deployment.createGeneration("deploy"); _error != nil {
 			return _error
 		}
 	}
@@ -306,37 +399,22 @@ func (deployment *NodeDeployment) UploadFiles(forceUpload bool, skipRestart bool
 	return
 }
 
-func (deployment *NodeDeployment) getSession() (*Session, error) {
-	privateKeyContent, error := ioutil.ReadFile(deployment.identityFile)
-	if error != nil {
-		return nil, error
-	}
-
-	privateKey, error := ssh.ParsePrivateKey(privateKeyContent)
-	if error != nil {
-		return nil, error
-	}
+// isReloadable returns true if only the config and the manifests are uploaded
+func (deployment *NodeDeployment) isReloadable(files map[string]string) bool {
+	configFilename := deployment.config.GetFullTargetAssetFilename(utils.ConfigFilename)
+	manifestsDirectory := deployment.config.GetFullTargetAssetDirectory(utils.DirectoryK8sManifests)
 
-	client, error := ssh.Dial("tcp", deployment.node.IP+":22", &ssh.ClientConfig{
-		User: utils.DeploymentUser,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(privateKey),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	})
-	if error != nil {
-		return nil, error
+	for _, toFile := range files {
+		if toFile != configFilename && path.Dir(toFile) != manifestsDirectory {
+			return false
+		}
 	}
 
-	session, error := client.NewSession()
-	if error != nil {
-		return nil, error
-	}
+	return len(files) > 0
+}
 
-	return &Session{
-		client:  client,
-		session: session,
-	}, nil
+func (deployment *NodeDeployment) verifyHostKey() error {
+	return deployment.transport.Connect()
 }
 
 func (deployment *NodeDeployment) pullImage(image string) error {
@@ -387,18 +465,9 @@ func (deployment *NodeDeployment) importImage(image string, filename string) err
 func (deployment *NodeDeployment) Execute(name, command string) (string, error) {
 	log.WithFields(log.Fields{"name": name, "node": deployment.name, "_target": deployment.node.IP, "_command": command}).Info("Executing remote command")
 
-	session, error := deployment.getSession()
-	if error != nil {
-		return "", error
-	}
-
-	defer session.Close()
-
 	var buffer bytes.Buffer
 
-	session.session.Stdout = &buffer
-
-	error = session.session.Run(command)
+	error := deployment.transport.Execute(command, nil, &buffer)
 
 	if error != nil {
 		error = errors.Wrapf(error, "Could not execute remote command '%s' on '%s'", command, deployment.name)
@@ -407,17 +476,6 @@ func (deployment *NodeDeployment) Execute(name, command string) (string, error)
 	return buffer.String(), error
 }
 
-func (deployment *NodeDeployment) execute(command string) error {
-	session, error := deployment.getSession()
-	if error != nil {
-		return error
-	}
-
-	defer session.Close()
-
-	return session.session.Run(command)
-}
-
 func (deployment *NodeDeployment) UploadFile(from, to string) error {
 	deployment.sshLimiter.Lock()
 	defer deployment.sshLimiter.Unlock()
@@ -430,32 +488,30 @@ func (deployment *NodeDeployment) UploadFile(from, to string) error {
 		return nil
 	}
 
-	executable := false
-
 	info, error := os.Stat(from)
-	if error == nil {
-		executable = strings.Contains(info.Mode().String(), "x")
-	}
-
-	if executable {
-		command := fmt.Sprintf("rm %s", to)
-
-		_ = deployment.execute(command)
+	if error != nil {
+		return error
 	}
 
-	log.WithFields(log.Fields{"name": filename, "node": deployment.name, "_target": deployment.node.IP, "_source-filename": from, "_destination-filename": to, "_executable": executable}).Info("Deploying")
-
-	session, error := deployment.getSession()
+	checksum, error := deployment.checksum(from)
 	if error != nil {
 		return error
 	}
 
-	defer session.Close()
+	log.WithFields(log.Fields{"name": filename, "node": deployment.name, "_target": deployment.node.IP, "_source-filename": from, "_destination-filename": to, "_checksum": checksum}).Info("Deploying")
+
+	start := time.Now()
 
-	if error := scp.CopyPath(from, to, session.session); error != nil {
-		return fmt.Errorf("Could not deploy file '%s' (%s)", from, error.Error())
+	if error := deployment.upload(from, to, info, checksum); error != nil {
+		error = fmt.Errorf("Could not deploy file '%s' (%s)", from, error.Error())
+
+		deployment.report.Record(deployment.name, ReportStepUpload, to, start, 0, error)
+
+		return error
 	}
 
+	deployment.report.Record(deployment.name, ReportStepUpload, to, start, 0, nil)
+
 	return nil
 }
 
@@ -0,0 +1,39 @@
+package deployment
+
+import (
+	"github.com/darxkies/k8s-tew/pkg/config"
+)
+
+// TransportFactory returns the transport used to reach a node
+type TransportFactory func(name string, node *config.Node) Transport
+
+// DeploymentOptions controls which steps a deployment runs and how
+type DeploymentOptions struct {
+	IdentityFile        string
+	KnownHostsFile      string
+	AcceptNewHostKeys   bool
+	CommandRetries      uint
+	Parallel            bool
+	ParallelNodes       uint
+	ImportImages        bool
+	ForceUpload         bool
+	CompressUploads     bool
+	DeltaUploads        bool
+	SkipPreflight       bool
+	SkipSetup           bool
+	SkipUpload          bool
+	SkipRestart         bool
+	SkipStorageSetup    bool
+	SkipMonitoringSetup bool
+	SkipLoggingSetup    bool
+	SkipBackupSetup     bool
+	SkipShowcaseSetup   bool
+	SkipIngressSetup    bool
+	Wait                uint
+	Rolling             bool
+	RollingBatchSize    uint
+	RollingTimeout      uint
+	Resume              bool
+	// NewTransport replaces the transports configured for the nodes, e.g. by fakes in unit tests
+	NewTransport TransportFactory
+}
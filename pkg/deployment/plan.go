@@ -0,0 +1,211 @@
+package deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+type NodePlan struct {
+	Name    string   `json:"name"`
+	IP      string   `json:"ip"`
+	Upload  []string `json:"upload"`
+	Remove  []string `json:"remove"`
+	Restart bool     `json:"restart"`
+	Reload  bool     `json:"reload"`
+	Images  []string `json:"images"`
+}
+
+type Plan struct {
+	Nodes    []NodePlan `json:"nodes"`
+	Commands []string   `json:"commands"`
+}
+
+// getExistingFiles returns the files that exist on the node
+func (deployment *NodeDeployment) getExistingFiles(files []string) ([]string, error) {
+	result := []string{}
+
+	if len(files) == 0 {
+		return result, nil
+	}
+
+	quotedFiles := []string{}
+
+	for _, file := range files {
+		quotedFiles = append(quotedFiles, quote(file))
+	}
+
+	output, _error := deployment.Execute("get-existing-files", fmt.Sprintf("for i in %s; do if [ -e \"$i\" ]; then echo \"$i\"; fi; done", strings.Join(quotedFiles, " ")))
+	if _error != nil {
+		return nil, _error
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+
+		result = append(result, line)
+	}
+
+	return result, nil
+}
+
+// getImportedImages returns the images already imported on the node or nil if they could not be retrieved
+func (deployment *NodeDeployment) getImportedImages() map[string]bool {
+	ctr := fmt.Sprintf("CONTAINERD_NAMESPACE=\"%s\" \"%s\"", utils.ContainerdKubernetesNamespace, deployment.config.GetFullTargetAssetFilename(utils.BinaryCtr))
+
+	output, _error := deployment.Execute("list-images", fmt.Sprintf("%s i ls -q", ctr))
+	if _error != nil {
+		return nil
+	}
+
+	result := map[string]bool{}
+
+	for _, line := range strings.Split(output, "\n") {
+		result[strings.TrimSpace(line)] = true
+	}
+
+	return result
+}
+
+func (deployment *Deployment) planNode(nodeDeployment *NodeDeployment) (NodePlan, error) {
+	nodePlan := NodePlan{Name: nodeDeployment.name, IP: nodeDeployment.node.IP, Upload: []string{}, Remove: []string{}, Images: []string{}}
+
+	if !deployment.options.SkipUpload {
+		files := nodeDeployment.getUploadFiles(deployment.options.ForceUpload)
+
+		for _, toFile := range files {
+			nodePlan.Upload = append(nodePlan.Upload, toFile)
+		}
+
+		sort.Strings(nodePlan.Upload)
+
+		existingFiles, _error := nodeDeployment.getExistingFiles(nodeDeployment.getCleanupFiles())
+		if _error != nil {
+			return nodePlan, _error
+		}
+
+		nodePlan.Remove = existingFiles
+		reload := nodeDeployment.isReloadable(files)
+
+		nodePlan.Restart = len(files) > 0 && !deployment.options.SkipRestart && !reload
+		nodePlan.Reload = len(files) > 0 && !deployment.options.SkipRestart && reload
+	}
+
+	if !deployment.options.SkipSetup && deployment.options.ImportImages {
+		importedImages := nodeDeployment.getImportedImages()
+
+		for _, image := range deployment.images {
+			if image.Features.HasFeatures(deployment.skipSetupFeatures) {
+				continue
+			}
+
+			if importedImages[image.Name] {
+				continue
+			}
+
+			nodePlan.Images = append(nodePlan.Images, image.Name)
+		}
+	}
+
+	return nodePlan, nil
+}
+
+// Plan collects the changes a deployment would apply without changing anything on the nodes
+func (deployment *Deployment) Plan() (*Plan, error) {
+	defer deployment.Close()
+
+	deployment.hostKeyVerifier.dryRun = true
+
+	_ = deployment.localChecksums.Load()
+
+	plan := &Plan{Nodes: []NodePlan{}, Commands: []string{}}
+
+	for _, nodeName := range deployment.config.GetSortedNodeKeys() {
+		nodeDeployment := deployment.nodes[nodeName]
+
+		if _error := nodeDeployment.verifyHostKey(); _error != nil {
+			return nil, _error
+		}
+
+		nodePlan, _error := deployment.planNode(nodeDeployment)
+		if _error != nil {
+			return nil, errors.Wrapf(_error, "Could not plan deployment of '%s'", nodeName)
+		}
+
+		plan.Nodes = append(plan.Nodes, nodePlan)
+	}
+
+	if !deployment.options.SkipSetup {
+		for _, command := range deployment.config.Config.Commands {
+			if !command.Labels.HasLabels([]string{utils.NodeBootstrapper}) {
+				continue
+			}
+
+			if command.Features.HasFeatures(deployment.skipSetupFeatures) {
+				continue
+			}
+
+			plan.Commands = append(plan.Commands, command.Name)
+		}
+	}
+
+	return plan, nil
+}
+
+func (plan *Plan) WriteJSON(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(plan)
+}
+
+func (plan *Plan) WriteText(writer io.Writer) error {
+	var builder strings.Builder
+
+	writeList := func(title string, entries []string) {
+		fmt.Fprintf(&builder, "  %s (%d):\n", title, len(entries))
+
+		for _, entry := range entries {
+			fmt.Fprintf(&builder, "    %s\n", entry)
+		}
+	}
+
+	for _, nodePlan := range plan.Nodes {
+		fmt.Fprintf(&builder, "Node %s (%s)\n", nodePlan.Name, nodePlan.IP)
+
+		writeList("Upload", nodePlan.Upload)
+		writeList("Remove", nodePlan.Remove)
+
+		restart := "no"
+
+		if nodePlan.Restart {
+			restart = "yes"
+
+		} else if nodePlan.Reload {
+			restart = "reload"
+		}
+
+		fmt.Fprintf(&builder, "  Restart: %s\n", restart)
+
+		writeList("Import images", nodePlan.Images)
+
+		builder.WriteString("\n")
+	}
+
+	fmt.Fprintf(&builder, "Bootstrapper commands (%d):\n", len(plan.Commands))
+
+	for _, command := range plan.Commands {
+		fmt.Fprintf(&builder, "  %s\n", command)
+	}
+
+	_, _error := io.WriteString(writer, builder.String())
+
+	return _error
+}
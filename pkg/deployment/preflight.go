@@ -0,0 +1,386 @@
+package deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const PreflightOK = "ok"
+const PreflightWarning = "warning"
+const PreflightFailure = "failure"
+
+type PreflightResult struct {
+	Node    string `json:"node"`
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Details string `json:"details"`
+}
+
+type PreflightResults []PreflightResult
+
+// HasFailures returns true if at least one check failed, warnings do not block a deployment
+func (results PreflightResults) HasFailures() bool {
+	for _, result := range results {
+		if result.Status == PreflightFailure {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (results PreflightResults) WriteJSON(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(results)
+}
+
+func (results PreflightResults) WriteTable(writer io.Writer) error {
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tabWriter, "NODE\tCHECK\tSTATUS\tDETAILS")
+
+	for _, result := range results {
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\n", result.Node, result.Check, result.Status, result.Details)
+	}
+
+	return tabWriter.Flush()
+}
+
+// Log writes all results that are not ok to the log
+func (results PreflightResults) Log() {
+	for _, result := range results {
+		fields := log.Fields{"node": result.Node, "check": result.Check, "details": result.Details}
+
+		switch result.Status {
+		case PreflightFailure:
+			log.WithFields(fields).Error("Preflight check failed")
+		case PreflightWarning:
+			log.WithFields(fields).Info("Preflight check warning")
+		default:
+			log.WithFields(fields).Debug("Preflight check passed")
+		}
+	}
+}
+
+func (deployment *NodeDeployment) preflightResult(check, status, details string) PreflightResult {
+	return PreflightResult{Node: deployment.name, Check: check, Status: status, Details: details}
+}
+
+func (deployment *NodeDeployment) checkOS() PreflightResult {
+	output, _error := deployment.Execute("preflight-os", ". /etc/os-release && echo \"$ID/$VERSION_ID\"")
+	if _error != nil {
+		return deployment.preflightResult("os", PreflightWarning, "Could not determine the operating system")
+	}
+
+	osNameAndRelease := strings.ToLower(strings.TrimSpace(output))
+	osName := strings.Split(osNameAndRelease, "/")[0]
+
+	for _, supportedOS := range []string{utils.OsUbuntu, utils.OsCentos} {
+		if osName == supportedOS {
+			return deployment.preflightResult("os", PreflightOK, osNameAndRelease)
+		}
+	}
+
+	return deployment.preflightResult("os", PreflightWarning, fmt.Sprintf("%s was not tested (local %s)", osNameAndRelease, utils.GetOSNameAndRelease()))
+}
+
+// getKernelModules returns the modules loaded by the commands of the node
+func (deployment *NodeDeployment) getKernelModules() []string {
+	modules := []string{}
+
+	for _, command := range deployment.config.Config.Commands {
+		if !config.CompareLabels(deployment.node.Labels, command.Labels) {
+			continue
+		}
+
+		if !strings.HasPrefix(command.Command, "modprobe ") {
+			continue
+		}
+
+		modules = append(modules, strings.Fields(command.Command)[1:]...)
+	}
+
+	return modules
+}
+
+func (deployment *NodeDeployment) checkKernelModules() PreflightResult {
+	modules := deployment.getKernelModules()
+
+	if len(modules) == 0 {
+		return deployment.preflightResult("kernel-modules", PreflightOK, "none required")
+	}
+
+	output, _error := deployment.Execute("preflight-kernel-modules", fmt.Sprintf("for i in %s; do if [ ! -d \"/sys/module/$i\" ] && ! modprobe -n \"$i\" 2>/dev/null; then echo \"$i\"; fi; done", strings.Join(modules, " ")))
+	if _error != nil {
+		return deployment.preflightResult("kernel-modules", PreflightFailure, _error.Error())
+	}
+
+	missing := strings.Fields(output)
+
+	if len(missing) > 0 {
+		return deployment.preflightResult("kernel-modules", PreflightFailure, fmt.Sprintf("missing %s", strings.Join(missing, ", ")))
+	}
+
+	return deployment.preflightResult("kernel-modules", PreflightOK, strings.Join(modules, ", "))
+}
+
+func (deployment *NodeDeployment) checkSwap() PreflightResult {
+	output, _error := deployment.Execute("preflight-swap", "tail -n +2 /proc/swaps | wc -l")
+	if _error != nil {
+		return deployment.preflightResult("swap", PreflightWarning, "Could not determine the swap state")
+	}
+
+	if strings.TrimSpace(output) != "0" {
+		return deployment.preflightResult("swap", PreflightWarning, "swap is enabled and will be turned off")
+	}
+
+	return deployment.preflightResult("swap", PreflightOK, "disabled")
+}
+
+// getRequiredPorts returns the ports the components of the node listen on
+func (deployment *NodeDeployment) getRequiredPorts() []uint16 {
+	ports := []uint16{utils.PortKubelet, deployment.config.GetMetricsPort()}
+
+	if deployment.node.IsController() {
+		ports = append(ports, deployment.config.Config.APIServerPort, utils.PortEtcdClient, utils.PortEtcdPeer, utils.PortEtcdMetrics, deployment.config.Config.LoadBalancerPort, deployment.config.Config.VIPRaftControllerPort)
+	}
+
+	if deployment.node.IsWorker() {
+		ports = append(ports, deployment.config.Config.VIPRaftWorkerPort)
+	}
+
+	return ports
+}
+
+func (deployment *NodeDeployment) checkPorts() PreflightResult {
+	// The ports are in use by the cluster itself when updating
+	if _, _error := deployment.Execute("preflight-service", fmt.Sprintf("systemctl is-active --quiet %s", utils.ServiceName)); _error == nil {
+		return deployment.preflightResult("ports", PreflightOK, fmt.Sprintf("%s is running", utils.ServiceName))
+	}
+
+	output, _error := deployment.Execute("preflight-ports", "ss -Htln")
+	if _error != nil {
+		return deployment.preflightResult("ports", PreflightWarning, "Could not list the listening ports")
+	}
+
+	used := map[uint16]bool{}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) < 4 {
+			continue
+		}
+
+		address := fields[3]
+
+		port, _error := strconv.ParseUint(address[strings.LastIndex(address, ":")+1:], 10, 16)
+		if _error != nil {
+			continue
+		}
+
+		used[uint16(port)] = true
+	}
+
+	busy := []string{}
+
+	for _, port := range deployment.getRequiredPorts() {
+		if used[port] {
+			busy = append(busy, strconv.Itoa(int(port)))
+		}
+	}
+
+	if len(busy) > 0 {
+		return deployment.preflightResult("ports", PreflightFailure, fmt.Sprintf("in use %s", strings.Join(busy, ", ")))
+	}
+
+	return deployment.preflightResult("ports", PreflightOK, "free")
+}
+
+func (deployment *NodeDeployment) checkDiskSpace(forceUpload bool) PreflightResult {
+	// Space needed by the files that are not deployed yet or by all files if the upload is forced. Images are needed
+	// twice, once as archive and once imported.
+	required := uint64(0)
+
+	images := map[string]bool{}
+
+	for _, image := range deployment.config.Config.Versions.GetImages() {
+		images[deployment.config.GetFullLocalAssetFilename(image.GetImageFilename())] = true
+	}
+
+	for fromFile := range deployment.getUploadFiles(forceUpload) {
+		info, _error := os.Stat(fromFile)
+		if _error != nil {
+			continue
+		}
+
+		required += uint64(info.Size())
+
+		if images[fromFile] {
+			required += uint64(info.Size())
+		}
+	}
+
+	output, _error := deployment.Execute("preflight-disk-space", fmt.Sprintf("df -Pk %s | tail -n 1", quote(deployment.config.Config.DeploymentDirectory)))
+	if _error != nil {
+		return deployment.preflightResult("disk-space", PreflightWarning, "Could not determine the free disk space")
+	}
+
+	fields := strings.Fields(output)
+
+	if len(fields) < 4 {
+		return deployment.preflightResult("disk-space", PreflightWarning, "Could not determine the free disk space")
+	}
+
+	available, _error := strconv.ParseUint(fields[3], 10, 64)
+	if _error != nil {
+		return deployment.preflightResult("disk-space", PreflightWarning, "Could not determine the free disk space")
+	}
+
+	available *= 1024
+
+	details := fmt.Sprintf("%s available, %s required", formatBytes(available), formatBytes(required))
+
+	if available < required {
+		return deployment.preflightResult("disk-space", PreflightFailure, details)
+	}
+
+	if deployment.node.IsStorage() && available < required+utils.PreflightCephDiskSpace {
+		return deployment.preflightResult("disk-space", PreflightWarning, fmt.Sprintf("%s, less than %s left for Ceph", details, formatBytes(utils.PreflightCephDiskSpace)))
+	}
+
+	return deployment.preflightResult("disk-space", PreflightOK, details)
+}
+
+func (deployment *NodeDeployment) checkClockSkew() PreflightResult {
+	start := time.Now()
+
+	output, _error := deployment.Execute("preflight-clock", "date +%s.%N")
+	if _error != nil {
+		return deployment.preflightResult("clock-skew", PreflightWarning, "Could not read the clock")
+	}
+
+	end := time.Now()
+
+	remote, _error := strconv.ParseFloat(strings.TrimSpace(output), 64)
+	if _error != nil {
+		return deployment.preflightResult("clock-skew", PreflightWarning, "Could not read the clock")
+	}
+
+	// Assume the remote clock was read halfway through the round trip
+	local := start.Add(end.Sub(start) / 2)
+	skew := time.Duration((remote - float64(local.UnixNano())/1e9) * float64(time.Second))
+
+	details := fmt.Sprintf("%s (round trip %s)", skew.Round(time.Millisecond), end.Sub(start).Round(time.Millisecond))
+
+	if math.Abs(skew.Seconds()) > utils.PreflightMaximumClockSkew {
+		return deployment.preflightResult("clock-skew", PreflightFailure, details)
+	}
+
+	return deployment.preflightResult("clock-skew", PreflightOK, details)
+}
+
+func (deployment *NodeDeployment) checkCgroupVersion() PreflightResult {
+	output, _error := deployment.Execute("preflight-cgroup", "stat -fc %T /sys/fs/cgroup")
+	if _error != nil {
+		return deployment.preflightResult("cgroup", PreflightWarning, "Could not determine the cgroup version")
+	}
+
+	if strings.TrimSpace(output) == "cgroup2fs" {
+		return deployment.preflightResult("cgroup", PreflightOK, "v2")
+	}
+
+	return deployment.preflightResult("cgroup", PreflightOK, "v1")
+}
+
+func (deployment *NodeDeployment) checkHostname() PreflightResult {
+	output, _error := deployment.Execute("preflight-hostname", "hostname")
+	if _error != nil {
+		return deployment.preflightResult("hostname", PreflightFailure, _error.Error())
+	}
+
+	hostname := strings.TrimSpace(output)
+
+	// k8s-tew finds its node in the config using the hostname
+	if hostname != deployment.name {
+		return deployment.preflightResult("hostname", PreflightFailure, fmt.Sprintf("hostname is '%s' instead of '%s'", hostname, deployment.name))
+	}
+
+	return deployment.preflightResult("hostname", PreflightOK, hostname)
+}
+
+// Preflight runs all checks on the node
+func (deployment *NodeDeployment) Preflight(forceUpload bool) PreflightResults {
+	if _error := deployment.verifyHostKey(); _error != nil {
+		return PreflightResults{deployment.preflightResult("ssh", PreflightFailure, _error.Error())}
+	}
+
+	return PreflightResults{
+		deployment.preflightResult("ssh", PreflightOK, "connected"),
+		deployment.checkOS(),
+		deployment.checkHostname(),
+		deployment.checkKernelModules(),
+		deployment.checkSwap(),
+		deployment.checkPorts(),
+		deployment.checkDiskSpace(forceUpload),
+		deployment.checkClockSkew(),
+		deployment.checkCgroupVersion(),
+	}
+}
+
+// Preflight checks all nodes at the same time
+func (deployment *Deployment) Preflight() PreflightResults {
+	sortedNodeKeys := deployment.config.GetSortedNodeKeys()
+	nodeResults := make([]PreflightResults, len(sortedNodeKeys))
+
+	_ = deployment.localChecksums.Load()
+
+	tasks := utils.Tasks{}
+
+	for i, nodeName := range sortedNodeKeys {
+		i := i
+		nodeDeployment := deployment.nodes[nodeName]
+
+		tasks = append(tasks, func() error {
+			nodeResults[i] = nodeDeployment.Preflight(deployment.options.ForceUpload)
+
+			return nil
+		})
+	}
+
+	utils.RunParallelTasks(tasks, true)
+
+	results := PreflightResults{}
+
+	for _, _results := range nodeResults {
+		results = append(results, _results...)
+	}
+
+	return results
+}
+
+func formatBytes(value uint64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	size := float64(value)
+	unit := 0
+
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
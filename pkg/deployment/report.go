@@ -0,0 +1,226 @@
+package deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const ReportSucceeded = "succeeded"
+const ReportFailed = "failed"
+const ReportSkipped = "skipped"
+
+const ReportStepUpload = "upload"
+const ReportStepStop = "stop"
+const ReportStepRestart = "restart"
+const ReportStepReload = "reload"
+const ReportStepCleanup = "cleanup"
+const ReportStepTaint = "taint"
+const ReportStepImportImage = "import-image"
+const ReportStepCommand = "command"
+const ReportStepManifest = "manifest"
+
+type ReportStep struct {
+	Node     string    `json:"node,omitempty"`
+	Type     string    `json:"type"`
+	Name     string    `json:"name"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+	Retries  uint      `json:"retries"`
+	Outcome  string    `json:"outcome"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type Report struct {
+	Start    time.Time    `json:"start"`
+	End      time.Time    `json:"end"`
+	Duration float64      `json:"duration"`
+	Outcome  string       `json:"outcome"`
+	Error    string       `json:"error,omitempty"`
+	Steps    []ReportStep `json:"steps"`
+	mutex    sync.Mutex
+	stream   io.Writer
+}
+
+func NewReport() *Report {
+	return &Report{Start: time.Now(), Steps: []ReportStep{}}
+}
+
+// SetStream enables writing each step as a JSON line as soon as it is recorded
+func (report *Report) SetStream(writer io.Writer) {
+	if report == nil {
+		return
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	report.stream = writer
+}
+
+// Record adds a step that started at the given time. A nil report ignores all steps.
+func (report *Report) Record(node, _type, name string, start time.Time, retries uint, _error error) {
+	if report == nil {
+		return
+	}
+
+	step := ReportStep{Node: node, Type: _type, Name: name, Start: start, Duration: time.Since(start).Seconds(), Retries: retries, Outcome: ReportSucceeded}
+
+	if _error != nil {
+		step.Outcome = ReportFailed
+		step.Error = _error.Error()
+	}
+
+	report.add(step)
+}
+
+// Skip adds a step that was not executed because it was completed by a previous deployment
+func (report *Report) Skip(node, _type, name string) {
+	if report == nil {
+		return
+	}
+
+	report.add(ReportStep{Node: node, Type: _type, Name: name, Start: time.Now(), Outcome: ReportSkipped})
+}
+
+func (report *Report) add(step ReportStep) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	report.Steps = append(report.Steps, step)
+
+	report.writeLine(step)
+}
+
+func (report *Report) writeLine(value interface{}) {
+	if report.stream == nil {
+		return
+	}
+
+	if _error := json.NewEncoder(report.stream).Encode(value); _error != nil {
+		log.WithFields(log.Fields{"error": _error}).Debug("Could not stream report")
+	}
+}
+
+// Finish sets the outcome of the deployment and streams the report without the steps
+func (report *Report) Finish(_error error) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	report.End = time.Now()
+	report.Duration = report.End.Sub(report.Start).Seconds()
+	report.Outcome = ReportSucceeded
+
+	if _error != nil {
+		report.Outcome = ReportFailed
+		report.Error = _error.Error()
+	}
+
+	report.writeLine(struct {
+		Start    time.Time `json:"start"`
+		End      time.Time `json:"end"`
+		Duration float64   `json:"duration"`
+		Outcome  string    `json:"outcome"`
+		Error    string    `json:"error,omitempty"`
+	}{report.Start, report.End, report.Duration, report.Outcome, report.Error})
+}
+
+func (report *Report) WriteJSON(writer io.Writer) error {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
+
+// WriteTable writes one line per step followed by the totals per step type
+func (report *Report) WriteTable(writer io.Writer) error {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tabWriter, "NODE\tTYPE\tNAME\tDURATION\tRETRIES\tOUTCOME\tERROR")
+
+	types := []string{}
+	durations := map[string]float64{}
+	counts := map[string]int{}
+	failures := map[string]int{}
+
+	for _, step := range report.Steps {
+		node := step.Node
+
+		if len(node) == 0 {
+			node = "-"
+		}
+
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", node, step.Type, step.Name, formatSeconds(step.Duration), step.Retries, step.Outcome, step.Error)
+
+		if _, ok := counts[step.Type]; !ok {
+			types = append(types, step.Type)
+		}
+
+		counts[step.Type]++
+		durations[step.Type] += step.Duration
+
+		if step.Outcome == ReportFailed {
+			failures[step.Type]++
+		}
+	}
+
+	fmt.Fprintln(tabWriter)
+	fmt.Fprintln(tabWriter, "TYPE\tSTEPS\tFAILED\tDURATION")
+
+	for _, _type := range types {
+		fmt.Fprintf(tabWriter, "%s\t%d\t%d\t%s\n", _type, counts[_type], failures[_type], formatSeconds(durations[_type]))
+	}
+
+	fmt.Fprintln(tabWriter)
+	fmt.Fprintf(tabWriter, "Outcome: %s\n", report.Outcome)
+	fmt.Fprintf(tabWriter, "Duration: %s\n", formatSeconds(report.Duration))
+
+	if len(report.Error) > 0 {
+		fmt.Fprintf(tabWriter, "Error: %s\n", report.Error)
+	}
+
+	return tabWriter.Flush()
+}
+
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Millisecond).String()
+}
+
+// Save writes the report as JSON and as table to the directory
+func (report *Report) Save(directory string) error {
+	for filename, write := range map[string]func(io.Writer) error{utils.DeploymentReportFilename: report.WriteJSON, utils.DeploymentReportSummaryFilename: report.WriteTable} {
+		fullFilename := path.Join(directory, filename)
+
+		file, _error := os.Create(fullFilename)
+		if _error != nil {
+			return errors.Wrapf(_error, "Could not create report '%s'", fullFilename)
+		}
+
+		_error = write(file)
+
+		if closeError := file.Close(); _error == nil {
+			_error = closeError
+		}
+
+		if _error != nil {
+			return errors.Wrapf(_error, "Could not write report '%s'", fullFilename)
+		}
+	}
+
+	return nil
+}
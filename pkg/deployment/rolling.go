@@ -0,0 +1,219 @@
+package deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/k8s"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// getRollingBatches returns the nodes in the order they are updated. Controllers are updated one at a time,
+// all other nodes in batches of the given size.
+func (deployment *Deployment) getRollingBatches() [][]string {
+	batches := [][]string{}
+	batch := []string{}
+
+	for _, nodeName := range deployment.config.GetSortedNodeKeys() {
+		if deployment.nodes[nodeName].node.IsController() {
+			batches = append(batches, []string{nodeName})
+		}
+	}
+
+	for _, nodeName := range deployment.config.GetSortedNodeKeys() {
+		if deployment.nodes[nodeName].node.IsController() {
+			continue
+		}
+
+		batch = append(batch, nodeName)
+
+		if len(batch) >= int(deployment.options.RollingBatchSize) {
+			batches = append(batches, batch)
+			batch = []string{}
+		}
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// rollingUpload updates the nodes batch by batch and stops at the first node that does not become healthy again
+func (deployment *Deployment) rollingUpload() error {
+	for _, batch := range deployment.getRollingBatches() {
+		tasks := utils.Tasks{}
+
+		for _, nodeName := range batch {
+			nodeDeployment := deployment.nodes[nodeName]
+
+			tasks = append(tasks, func() error {
+				return deployment.rollingUploadNode(nodeDeployment)
+			})
+		}
+
+		if errors := utils.RunParallelTasks(tasks, true); len(errors) > 0 {
+			return errors[0]
+		}
+	}
+
+	return nil
+}
+
+func (deployment *Deployment) rollingUploadNode(nodeDeployment *NodeDeployment) error {
+	if deployment.journal.IsDone(uploadStep(nodeDeployment.name)) {
+		deployment.report.Skip(nodeDeployment.name, ReportStepUpload, nodeDeployment.name)
+
+		increaseProgressSteps(nodeDeployment.Steps(false))
+
+		return nil
+	}
+
+	if _error := deployment.rollingUpdateNode(nodeDeployment); _error != nil {
+		return _error
+	}
+
+	return deployment.journal.Done(uploadStep(nodeDeployment.name))
+}
+
+func (deployment *Deployment) rollingUpdateNode(nodeDeployment *NodeDeployment) error {
+	files, _error := nodeDeployment.prepareUpload(deployment.options.ForceUpload)
+	if _error != nil {
+		return _error
+	}
+
+	kubernetesClient := k8s.NewK8S(deployment.config)
+
+	// Nothing changed, so the node does not need to be restarted
+	if len(files) == 0 {
+		if _error := nodeDeployment.uploadFiles(files, false); _error != nil {
+			return _error
+		}
+
+		held, _error := kubernetesClient.IsCordonedBy(nodeDeployment.name, utils.CordonHolderRollingUpdate)
+		if _error != nil {
+			return _error
+		}
+
+		// An aborted rolling update left the node cordoned after its files were uploaded
+		if !held {
+			return nil
+		}
+
+		return deployment.releaseNode(kubernetesClient, nodeDeployment, time.Now())
+	}
+
+	log.WithFields(log.Fields{"node": nodeDeployment.name}).Info("Draining node")
+
+	// The node is marked, so that 'k8s-tew run' does not uncordon it when it is restarted by the update
+	if _error := kubernetesClient.CordonBy(nodeDeployment.name, utils.CordonHolderRollingUpdate); _error != nil {
+		return errors.Wrapf(_error, "Could not cordon node '%s'", nodeDeployment.name)
+	}
+
+	if _error := kubernetesClient.Drain(nodeDeployment.name); _error != nil {
+		return errors.Wrapf(_error, "Could not drain node '%s'", nodeDeployment.name)
+	}
+
+	since := time.Now()
+
+	if _error := nodeDeployment.uploadFiles(files, false); _error != nil {
+		return _error
+	}
+
+	return deployment.releaseNode(kubernetesClient, nodeDeployment, since)
+}
+
+// releaseNode uncordons the node once it is healthy again. The node stays cordoned on failure, so that nothing is
+// scheduled on it until it was inspected.
+func (deployment *Deployment) releaseNode(kubernetesClient *k8s.K8S, nodeDeployment *NodeDeployment, since time.Time) error {
+	if _error := kubernetesClient.WaitForNode(nodeDeployment.name, since, deployment.options.RollingTimeout); _error != nil {
+		return errors.Wrapf(_error, "Rolling update aborted, node '%s' is still cordoned", nodeDeployment.name)
+	}
+
+	if nodeDeployment.node.IsController() {
+		if _error := deployment.waitForEtcd(); _error != nil {
+			return errors.Wrapf(_error, "Rolling update aborted, node '%s' is still cordoned", nodeDeployment.name)
+		}
+	}
+
+	if _error := kubernetesClient.UncordonBy(nodeDeployment.name, utils.CordonHolderRollingUpdate); _error != nil {
+		return errors.Wrapf(_error, "Could not uncordon node '%s'", nodeDeployment.name)
+	}
+
+	log.WithFields(log.Fields{"node": nodeDeployment.name}).Info("Node updated")
+
+	return nil
+}
+
+// waitForEtcd waits until all etcd members report to be healthy
+func (deployment *Deployment) waitForEtcd() error {
+	log.Info("Waiting for etcd")
+
+	client := http.Client{Timeout: 5 * time.Second}
+
+	checkMember := func(ip string) error {
+		response, _error := client.Get(fmt.Sprintf("http://%s/health", net.JoinHostPort(ip, strconv.Itoa(int(utils.PortEtcdMetrics)))))
+		if _error != nil {
+			return _error
+		}
+
+		defer response.Body.Close()
+
+		health := struct {
+			Health string `json:"health"`
+		}{}
+
+		if _error := json.NewDecoder(response.Body).Decode(&health); _error != nil {
+			return _error
+		}
+
+		if health.Health != "true" {
+			return fmt.Errorf("etcd on %s is not healthy", ip)
+		}
+
+		return nil
+	}
+
+	timeout := deployment.options.RollingTimeout
+
+	if timeout == 0 {
+		timeout = utils.RollingTimeout
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	for {
+		var _error error
+
+		for _, node := range deployment.config.Config.Nodes {
+			if !node.IsController() {
+				continue
+			}
+
+			if _error = checkMember(node.IP); _error != nil {
+				break
+			}
+		}
+
+		if _error == nil {
+			log.Info("Etcd healthy")
+
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return errors.Wrapf(_error, "Etcd did not become healthy within %d seconds", timeout)
+		}
+
+		log.WithFields(log.Fields{"error": _error}).Debug("Etcd not healthy")
+
+		time.Sleep(time.Second)
+	}
+}
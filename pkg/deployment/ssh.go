@@ -0,0 +1,305 @@
+package deployment
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SSHTransport executes commands and uploads files over SSH using a pooled connection
+type SSHTransport struct {
+	identityFile    string
+	name            string
+	node            *config.Node
+	config          *config.InternalConfig
+	hostKeyVerifier *HostKeyVerifier
+	sshAgent        agent.ExtendedAgent
+	sshAgentOnce    sync.Once
+	sshAgentError   error
+	sshPool         *SSHPool
+}
+
+func NewSSHTransport(identityFile string, name string, node *config.Node, config *config.InternalConfig, hostKeyVerifier *HostKeyVerifier) *SSHTransport {
+	transport := &SSHTransport{identityFile: identityFile, name: name, node: node, config: config, hostKeyVerifier: hostKeyVerifier}
+
+	transport.sshPool = NewSSHPool(name, transport.dial)
+
+	return transport
+}
+
+// Connect opens the pooled connection, which also verifies the host key
+func (transport *SSHTransport) Connect() error {
+	session, error := transport.getSession()
+	if error != nil {
+		return errors.Wrapf(error, "Could not connect to '%s'", transport.name)
+	}
+
+	// The connection stays open in the pool and is reused by the following operations
+	session.Close()
+
+	return nil
+}
+
+func (transport *SSHTransport) Execute(command string, stdin io.Reader, stdout io.Writer) error {
+	session, error := transport.getSession()
+	if error != nil {
+		return error
+	}
+
+	defer session.Close()
+
+	session.session.Stdin = stdin
+	session.session.Stdout = stdout
+
+	return session.Run(transport.getSSHConfig(), command)
+}
+
+// Upload streams the content to a temporary file next to the destination, verifies its checksum and renames it atomically,
+// so that the destination is either the old or the complete new file. Running binaries are replaced without 'text file busy' errors.
+func (transport *SSHTransport) Upload(reader io.Reader, to string, mode os.FileMode, checksum string, encoding UploadEncoding) error {
+	temporaryFilename := to + utils.UploadTemporarySuffix
+
+	decoders := []string{}
+
+	if encoding.Compressed {
+		decoders = append(decoders, "gzip -dc")
+	}
+
+	// Deltas are applied by the k8s-tew binary deployed on the node
+	if len(encoding.Basis) > 0 {
+		decoders = append(decoders, fmt.Sprintf("%s delta patch %s", quote(transport.config.GetFullTargetAssetFilename(utils.BinaryK8sTew)), quote(encoding.Basis)))
+	}
+
+	if len(decoders) == 0 {
+		decoders = append(decoders, "cat")
+	}
+
+	// The content is streamed over stdin, so that it also works with sudo
+	if error := transport.Execute(fmt.Sprintf("%s > %s && chmod %o %s", strings.Join(decoders, " | "), quote(temporaryFilename), mode, quote(temporaryFilename)), reader, nil); error != nil {
+		_ = transport.Execute(fmt.Sprintf("rm -f %s", quote(temporaryFilename)), nil, nil)
+
+		return error
+	}
+
+	remoteChecksum, error := transport.Checksum(temporaryFilename)
+
+	if error != nil || remoteChecksum != checksum {
+		_ = transport.Execute(fmt.Sprintf("rm -f %s", quote(temporaryFilename)), nil, nil)
+
+		return fmt.Errorf("checksum mismatch of '%s' on '%s' (expected %s, got %s)", to, transport.name, checksum, remoteChecksum)
+	}
+
+	return transport.Execute(fmt.Sprintf("mv -f %s %s", quote(temporaryFilename), quote(to)), nil, nil)
+}
+
+func (transport *SSHTransport) Checksum(filename string) (string, error) {
+	var buffer bytes.Buffer
+
+	if error := transport.Execute(fmt.Sprintf("sha256sum %s", quote(filename)), nil, &buffer); error != nil {
+		return "", error
+	}
+
+	return utils.ParseChecksums(buffer.String())[filename], nil
+}
+
+// Close releases the pooled connection
+func (transport *SSHTransport) Close() {
+	transport.sshPool.Close()
+}
+
+type Session struct {
+	session *ssh.Session
+	pool    *SSHPool
+	once    sync.Once
+}
+
+func (session *Session) Close() {
+	session.once.Do(func() {
+		session.session.Close()
+
+		session.pool.ReleaseSession()
+	})
+}
+
+// Run executes a command and escalates it with sudo if required
+func (session *Session) Run(sshConfig config.SSHConfig, command string) error {
+	return session.session.Run(wrapCommand(sshConfig, command))
+}
+
+// wrapCommand runs the command in a root shell using sudo if the user is not root and escalation is enabled
+func wrapCommand(sshConfig config.SSHConfig, command string) string {
+	if !sshConfig.UseSudo() {
+		return command
+	}
+
+	return fmt.Sprintf("sudo -n sh -c %s", quote(command))
+}
+
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
+
+// getSSHConfig returns the SSH defaults of the cluster overridden by the settings of the node
+func (transport *SSHTransport) getSSHConfig() config.SSHConfig {
+	sshConfig := transport.config.Config.SSH.Merge(transport.node.SSH)
+
+	if len(sshConfig.IdentityFile) == 0 {
+		sshConfig.IdentityFile = transport.identityFile
+	}
+
+	return sshConfig
+}
+
+// getSSHAgent connects once to the SSH agent and shares the connection between all sessions of the node
+func (transport *SSHTransport) getSSHAgent() (agent.ExtendedAgent, error) {
+	transport.sshAgentOnce.Do(func() {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+
+		if len(socket) == 0 {
+			transport.sshAgentError = errors.New("SSH agent authentication requested but SSH_AUTH_SOCK is not set")
+
+			return
+		}
+
+		connection, error := net.Dial("unix", socket)
+		if error != nil {
+			transport.sshAgentError = errors.Wrap(error, "Could not connect to the SSH agent")
+
+			return
+		}
+
+		transport.sshAgent = agent.NewClient(connection)
+	})
+
+	return transport.sshAgent, transport.sshAgentError
+}
+
+func (transport *SSHTransport) getAuthMethods(sshConfig config.SSHConfig) ([]ssh.AuthMethod, error) {
+	authMethods := []ssh.AuthMethod{}
+
+	if sshConfig.Agent {
+		sshAgent, error := transport.getSSHAgent()
+		if error != nil {
+			return nil, error
+		}
+
+		authMethods = append(authMethods, ssh.PublicKeysCallback(sshAgent.Signers))
+	}
+
+	if len(sshConfig.IdentityFile) > 0 {
+		privateKeyContent, error := os.ReadFile(sshConfig.IdentityFile)
+
+		// The identity file is optional if the agent is used
+		if error != nil && sshConfig.Agent {
+			return authMethods, nil
+		}
+
+		if error != nil {
+			return nil, error
+		}
+
+		privateKey, error := ssh.ParsePrivateKey(privateKeyContent)
+		if error != nil {
+			return nil, errors.Wrapf(error, "Could not parse identity file %s", sshConfig.IdentityFile)
+		}
+
+		authMethods = append(authMethods, ssh.PublicKeys(privateKey))
+	}
+
+	return authMethods, nil
+}
+
+// dial connects to the node, hopping over the jump hosts in the given order
+func (transport *SSHTransport) dial() ([]*ssh.Client, error) {
+	sshConfig := transport.getSSHConfig()
+
+	authMethods, _error := transport.getAuthMethods(sshConfig)
+	if _error != nil {
+		return nil, _error
+	}
+
+	jumpHosts, _error := sshConfig.GetJumpHosts()
+	if _error != nil {
+		return nil, _error
+	}
+
+	clients := []*ssh.Client{}
+
+	closeClients := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+
+	connect := func(address, user string, hostKeyCallback ssh.HostKeyCallback) error {
+		clientConfig := &ssh.ClientConfig{
+			User:            user,
+			Auth:            authMethods,
+			HostKeyCallback: hostKeyCallback,
+		}
+
+		// First hop
+		if len(clients) == 0 {
+			client, error := ssh.Dial("tcp", address, clientConfig)
+			if error != nil {
+				return errors.Wrapf(error, "Could not connect to %s", address)
+			}
+
+			clients = append(clients, client)
+
+			return nil
+		}
+
+		// Tunnel through the previous hop
+		connection, error := clients[len(clients)-1].Dial("tcp", address)
+		if error != nil {
+			return errors.Wrapf(error, "Could not connect to %s", address)
+		}
+
+		clientConnection, channels, requests, error := ssh.NewClientConn(connection, address, clientConfig)
+		if error != nil {
+			connection.Close()
+
+			return errors.Wrapf(error, "Could not connect to %s", address)
+		}
+
+		clients = append(clients, ssh.NewClient(clientConnection, channels, requests))
+
+		return nil
+	}
+
+	for _, jumpHost := range jumpHosts {
+		if error := connect(jumpHost.Address, jumpHost.User, transport.hostKeyVerifier.JumpHostCallback(jumpHost.Address)); error != nil {
+			closeClients()
+
+			return nil, error
+		}
+	}
+
+	if error := connect(sshConfig.GetAddress(transport.node.IP), sshConfig.GetUser(), transport.hostKeyVerifier.Callback(transport.name, transport.node)); error != nil {
+		closeClients()
+
+		return nil, error
+	}
+
+	return clients, nil
+}
+
+func (transport *SSHTransport) getSession() (*Session, error) {
+	session, error := transport.sshPool.NewSession()
+	if error != nil {
+		return nil, error
+	}
+
+	return &Session{session: session, pool: transport.sshPool}, nil
+}
@@ -0,0 +1,181 @@
+package deployment
+
+import (
+	"sync"
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+type sshConnection struct {
+	clients []*ssh.Client
+	done    chan struct{}
+}
+
+func (connection *sshConnection) target() *ssh.Client {
+	return connection.clients[len(connection.clients)-1]
+}
+
+func (connection *sshConnection) close() {
+	close(connection.done)
+
+	// Close the target first and then the jump hosts
+	for i := len(connection.clients) - 1; i >= 0; i-- {
+		connection.clients[i].Close()
+	}
+}
+
+// SSHPool keeps one connection per node open and multiplexes all sessions over it. Dead connections are detected
+// using keepalives and replaced on the next request. Every session holds a slot of the limiter until it is released,
+// which keeps the number of concurrent sessions below the MaxSessions limit of the SSH server.
+type SSHPool struct {
+	name       string
+	dial       func() ([]*ssh.Client, error)
+	connection *sshConnection
+	limiter    *utils.Limiter
+	mutex      sync.Mutex
+}
+
+func NewSSHPool(name string, dial func() ([]*ssh.Client, error)) *SSHPool {
+	return &SSHPool{name: name, dial: dial, limiter: utils.NewLimiter(utils.ConcurrentSshConnectionsLimit)}
+}
+
+func (pool *SSHPool) getConnection() (*sshConnection, error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.connection != nil {
+		return pool.connection, nil
+	}
+
+	clients, _error := pool.dial()
+	if _error != nil {
+		return nil, _error
+	}
+
+	pool.connection = &sshConnection{clients: clients, done: make(chan struct{})}
+
+	go pool.keepAlive(pool.connection)
+
+	log.WithFields(log.Fields{"node": pool.name}).Debug("SSH connection opened")
+
+	return pool.connection, nil
+}
+
+// invalidate closes the connection, unless it was already replaced by another one
+func (pool *SSHPool) invalidate(connection *sshConnection) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.connection != connection {
+		return
+	}
+
+	pool.connection = nil
+
+	connection.close()
+
+	log.WithFields(log.Fields{"node": pool.name}).Debug("SSH connection closed")
+}
+
+func (pool *SSHPool) keepAlive(connection *sshConnection) {
+	ticker := time.NewTicker(utils.SSHKeepAliveInterval * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-connection.done:
+			return
+
+		case <-ticker.C:
+			if _, _, _error := connection.target().SendRequest("keepalive@openssh.com", true, nil); _error != nil {
+				log.WithFields(log.Fields{"node": pool.name, "error": _error}).Debug("SSH keepalive failed")
+
+				pool.invalidate(connection)
+
+				return
+			}
+		}
+	}
+}
+
+// NewSession opens a session on the pooled connection and reconnects once if the connection broke in the meantime.
+// Channels rejected by the server are retried with an increasing delay. Each session has to be released with
+// ReleaseSession once it is closed.
+func (pool *SSHPool) NewSession() (*ssh.Session, error) {
+	pool.limiter.Lock()
+
+	session, _error := pool.newSession()
+	if _error != nil {
+		pool.limiter.Unlock()
+
+		return nil, _error
+	}
+
+	return session, nil
+}
+
+// ReleaseSession frees the slot of a session returned by NewSession
+func (pool *SSHPool) ReleaseSession() {
+	pool.limiter.Unlock()
+}
+
+func (pool *SSHPool) newSession() (*ssh.Session, error) {
+	var _error error
+
+	reconnected := false
+
+	for retries := 0; retries < utils.SSHSessionRetries; retries++ {
+		var connection *sshConnection
+
+		connection, _error = pool.getConnection()
+		if _error != nil {
+			return nil, _error
+		}
+
+		var session *ssh.Session
+
+		session, _error = connection.target().NewSession()
+		if _error == nil {
+			return session, nil
+		}
+
+		// The server rejected the channel, but the connection itself is still alive
+		if channelError, ok := _error.(*ssh.OpenChannelError); ok {
+			// Sessions of other clients count toward the MaxSessions limit of the server as well
+			if channelError.Reason != ssh.Prohibited {
+				break
+			}
+
+			log.WithFields(log.Fields{"node": pool.name, "error": _error}).Debug("SSH session rejected")
+
+			time.Sleep(time.Duration(retries+1) * utils.SSHSessionRetryDelay * time.Second)
+
+			continue
+		}
+
+		pool.invalidate(connection)
+
+		if reconnected {
+			break
+		}
+
+		reconnected = true
+	}
+
+	return nil, errors.Wrapf(_error, "Could not open session on '%s'", pool.name)
+}
+
+// Close closes the pooled connection
+func (pool *SSHPool) Close() {
+	pool.mutex.Lock()
+	connection := pool.connection
+	pool.mutex.Unlock()
+
+	if connection != nil {
+		pool.invalidate(connection)
+	}
+}
@@ -0,0 +1,184 @@
+package deployment
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/delta"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// countingReader counts the bytes read so far
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (reader *countingReader) Read(buffer []byte) (int, error) {
+	count, _error := reader.reader.Read(buffer)
+
+	atomic.AddInt64(&reader.count, int64(count))
+
+	return count, _error
+}
+
+func (reader *countingReader) Count() int64 {
+	return atomic.LoadInt64(&reader.count)
+}
+
+// upload transfers the file to the node. If enabled, large files are sent as a delta against the file already on the
+// node and the content is compressed on the wire. A failed delta transfer falls back to a full transfer.
+func (deployment *NodeDeployment) upload(from, to string, info os.FileInfo, checksum string) error {
+	// The k8s-tew binary on the node is not used to patch itself
+	if deployment.deltaUploads && info.Size() >= utils.DeltaMinimumSize && to != deployment.config.GetFullTargetAssetFilename(utils.BinaryK8sTew) && deployment.supportsDelta() {
+		signature, _error := deployment.getRemoteSignature(to)
+
+		if _error == nil {
+			if _error = deployment.transfer(from, to, info, checksum, signature); _error == nil {
+				return nil
+			}
+		}
+
+		log.WithFields(log.Fields{"name": path.Base(to), "node": deployment.name, "error": _error}).Debug("Delta transfer not possible")
+	}
+
+	return deployment.transfer(from, to, info, checksum, nil)
+}
+
+// supportsDelta returns true if the k8s-tew binary on the node is the local one. Older binaries might not know the delta
+// subcommands. The binaries are compared only once per node.
+func (deployment *NodeDeployment) supportsDelta() bool {
+	deployment.deltaOnce.Do(func() {
+		localChecksum, _error := deployment.checksum(deployment.config.GetFullLocalAssetFilename(utils.BinaryK8sTew))
+		if _error != nil {
+			log.WithFields(log.Fields{"node": deployment.name, "error": _error}).Debug("Delta transfer not possible")
+
+			return
+		}
+
+		// The binary is missing on new nodes
+		remoteChecksum, _ := deployment.transport.Checksum(deployment.config.GetFullTargetAssetFilename(utils.BinaryK8sTew))
+
+		deployment.deltaSupported = localChecksum == remoteChecksum
+
+		if !deployment.deltaSupported {
+			log.WithFields(log.Fields{"node": deployment.name}).Info("Delta transfers disabled until the k8s-tew binary on the node is up to date")
+		}
+	})
+
+	return deployment.deltaSupported
+}
+
+// getRemoteSignature returns the block signature of the file on the node, computed by the k8s-tew binary deployed there
+func (deployment *NodeDeployment) getRemoteSignature(filename string) (*delta.Signature, error) {
+	var buffer bytes.Buffer
+
+	command := fmt.Sprintf("%s delta signature --block-size %d %s", quote(deployment.config.GetFullTargetAssetFilename(utils.BinaryK8sTew)), utils.DeltaBlockSize, quote(filename))
+
+	if _error := deployment.transport.Execute(command, nil, &buffer); _error != nil {
+		return nil, errors.Wrapf(_error, "Could not get signature of '%s'", filename)
+	}
+
+	return delta.ReadSignature(&buffer)
+}
+
+// transfer streams the encoded file to the node and reports the progress in bytes
+func (deployment *NodeDeployment) transfer(from, to string, info os.FileInfo, checksum string, signature *delta.Signature) error {
+	file, _error := os.Open(from)
+	if _error != nil {
+		return _error
+	}
+
+	defer file.Close()
+
+	source := &countingReader{reader: file}
+	encoding := UploadEncoding{Compressed: deployment.compressUploads}
+
+	if signature != nil {
+		encoding.Basis = to
+	}
+
+	var content io.Reader = source
+
+	// Encode the content on the fly
+	if encoding.Compressed || signature != nil {
+		pipeReader, pipeWriter := io.Pipe()
+
+		go func() {
+			pipeWriter.CloseWithError(encode(source, encoding.Compressed, signature, pipeWriter))
+		}()
+
+		defer pipeReader.Close()
+
+		content = pipeReader
+	}
+
+	sent := &countingReader{reader: content}
+	done := make(chan struct{})
+	start := time.Now()
+	name := path.Base(to)
+	total := info.Size()
+
+	if total == 0 {
+		total = 1
+	}
+
+	go func() {
+		ticker := time.NewTicker(utils.UploadProgressInterval * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ticker.C:
+				log.WithFields(log.Fields{"name": name, "node": deployment.name, "bytes": source.Count(), "total": info.Size(), "percent": source.Count() * 100 / total, "sent": sent.Count()}).Info("Uploading")
+			}
+		}
+	}()
+
+	_error = deployment.transport.Upload(sent, to, info.Mode().Perm(), checksum, encoding)
+
+	close(done)
+
+	if _error != nil {
+		return _error
+	}
+
+	log.WithFields(log.Fields{"name": name, "node": deployment.name, "bytes": info.Size(), "sent": sent.Count(), "delta": signature != nil, "compressed": encoding.Compressed, "duration": time.Since(start).Round(time.Millisecond)}).Debug("Uploaded")
+
+	return nil
+}
+
+// encode writes the optionally delta encoded and compressed content
+func encode(reader io.Reader, compressed bool, signature *delta.Signature, writer io.Writer) error {
+	if compressed {
+		gzipWriter, _error := gzip.NewWriterLevel(writer, gzip.BestSpeed)
+		if _error != nil {
+			return _error
+		}
+
+		if _error := encode(reader, false, signature, gzipWriter); _error != nil {
+			return _error
+		}
+
+		return gzipWriter.Close()
+	}
+
+	if signature != nil {
+		return delta.Diff(signature, reader, writer)
+	}
+
+	_, _error := io.Copy(writer, reader)
+
+	return _error
+}
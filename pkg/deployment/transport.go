@@ -0,0 +1,64 @@
+package deployment
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/delta"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+// UploadEncoding describes how the uploaded content is encoded on the wire
+type UploadEncoding struct {
+	// Compressed is true if the content is gzip compressed
+	Compressed bool
+	// Basis is set if the content is a delta against this file on the node
+	Basis string
+}
+
+// Transport is the way a node is reached. Commands are executed by a shell with root rights on the node.
+type Transport interface {
+	// Connect establishes the connection, if the transport needs one
+	Connect() error
+	// Execute runs a shell command, stdin and stdout are optional
+	Execute(command string, stdin io.Reader, stdout io.Writer) error
+	// Upload decodes the content, writes it atomically to the file and verifies its SHA-256 checksum
+	Upload(reader io.Reader, to string, mode os.FileMode, checksum string, encoding UploadEncoding) error
+	// Checksum returns the SHA-256 checksum of the file
+	Checksum(filename string) (string, error)
+	// Close releases the connection
+	Close()
+}
+
+// NewTransport returns the transport configured for the node, SSH by default
+func NewTransport(identityFile string, name string, node *config.Node, config *config.InternalConfig, hostKeyVerifier *HostKeyVerifier) Transport {
+	if node.Transport == utils.TransportLocal {
+		return NewLocalTransport()
+	}
+
+	return NewSSHTransport(identityFile, name, node, config, hostKeyVerifier)
+}
+
+// decode writes the decoded content, basis is only used for deltas
+func decode(reader io.Reader, encoding UploadEncoding, basis io.ReaderAt, writer io.Writer) error {
+	if encoding.Compressed {
+		gzipReader, _error := gzip.NewReader(reader)
+		if _error != nil {
+			return _error
+		}
+
+		defer gzipReader.Close()
+
+		reader = gzipReader
+	}
+
+	if len(encoding.Basis) > 0 {
+		return delta.Patch(basis, reader, writer)
+	}
+
+	_, _error := io.Copy(writer, reader)
+
+	return _error
+}
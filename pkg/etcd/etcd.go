@@ -0,0 +1,325 @@
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Etcd manages the members of the etcd cluster running on the controllers
+type Etcd struct {
+	config *config.InternalConfig
+}
+
+func NewEtcd(config *config.InternalConfig) *Etcd {
+	return &Etcd{config: config}
+}
+
+func (etcd *Etcd) getTLSConfig() (*tls.Config, error) {
+	certificate, _error := tls.LoadX509KeyPair(etcd.config.GetFullLocalAssetFilename(utils.PemKubernetes), etcd.config.GetFullLocalAssetFilename(utils.PemKubernetesKey))
+	if _error != nil {
+		return nil, errors.Wrap(_error, "Could not load etcd client certificate")
+	}
+
+	ca, _error := os.ReadFile(etcd.config.GetFullLocalAssetFilename(utils.PemCa))
+	if _error != nil {
+		return nil, errors.Wrap(_error, "Could not load CA")
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("Could not parse CA")
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{certificate}, RootCAs: pool}, nil
+}
+
+// getEndpoints returns the client URLs of the controllers that already joined the cluster and are not excluded
+func (etcd *Etcd) getEndpoints(excludedNodeName string) []string {
+	endpoints := []string{}
+
+	for _, name := range etcd.config.GetSortedNodeKeys() {
+		node := etcd.config.Config.Nodes[name]
+
+		if name == excludedNodeName || !node.IsController() {
+			continue
+		}
+
+		if etcd.config.Config.EtcdClusterState == utils.EtcdClusterStateExisting && !etcd.config.IsEtcdMember(name) {
+			continue
+		}
+
+		endpoints = append(endpoints, getClientURL(node.IP))
+	}
+
+	return endpoints
+}
+
+func getClientURL(ip string) string {
+	return fmt.Sprintf("https://%s:%d", ip, utils.PortEtcdClient)
+}
+
+func getPeerURL(ip string) string {
+	return fmt.Sprintf("https://%s:%d", ip, utils.PortEtcdPeer)
+}
+
+func (etcd *Etcd) getClient(excludedNodeName string) (*clientv3.Client, error) {
+	endpoints := etcd.getEndpoints(excludedNodeName)
+
+	if len(endpoints) == 0 {
+		return nil, errors.New("No etcd endpoints found")
+	}
+
+	tlsConfig, _error := etcd.getTLSConfig()
+	if _error != nil {
+		return nil, _error
+	}
+
+	client, _error := clientv3.New(clientv3.Config{Endpoints: endpoints, TLS: tlsConfig, DialTimeout: requestTimeout, Logger: zap.NewNop()})
+	if _error != nil {
+		return nil, errors.Wrapf(_error, "Could not connect to etcd (%s)", strings.Join(endpoints, ","))
+	}
+
+	return client, nil
+}
+
+// GetMembers returns the names of the voting members of the cluster
+func (etcd *Etcd) GetMembers() ([]string, error) {
+	client, _error := etcd.getClient("")
+	if _error != nil {
+		return nil, _error
+	}
+
+	defer client.Close()
+
+	members, _error := etcd.listMembers(client)
+	if _error != nil {
+		return nil, _error
+	}
+
+	result := []string{}
+
+	for _, member := range members {
+		if member.IsLearner || len(member.Name) == 0 {
+			continue
+		}
+
+		result = append(result, member.Name)
+	}
+
+	return result, nil
+}
+
+func (etcd *Etcd) listMembers(client *clientv3.Client) ([]*etcdserverpb.Member, error) {
+	_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	response, _error := client.MemberList(_context)
+	if _error != nil {
+		return nil, errors.Wrap(_error, "Could not list etcd members")
+	}
+
+	return response.Members, nil
+}
+
+// findMember returns the member that uses the peer URL of the node or nil
+func findMember(members []*etcdserverpb.Member, peerURL string) *etcdserverpb.Member {
+	for _, member := range members {
+		for _, url := range member.PeerURLs {
+			if url == peerURL {
+				return member
+			}
+		}
+	}
+
+	return nil
+}
+
+// AddLearner adds the controller as a non-voting member, unless it is already a member
+func (etcd *Etcd) AddLearner(name string) error {
+	node, ok := etcd.config.Config.Nodes[name]
+	if !ok {
+		return fmt.Errorf("Node '%s' not found", name)
+	}
+
+	client, _error := etcd.getClient(name)
+	if _error != nil {
+		return _error
+	}
+
+	defer client.Close()
+
+	members, _error := etcd.listMembers(client)
+	if _error != nil {
+		return _error
+	}
+
+	peerURL := getPeerURL(node.IP)
+
+	if member := findMember(members, peerURL); member != nil {
+		log.WithFields(log.Fields{"node": name, "id": fmt.Sprintf("%x", member.ID)}).Debug("Etcd member exists already")
+
+		return nil
+	}
+
+	_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	response, _error := client.MemberAddAsLearner(_context, []string{peerURL})
+	if _error != nil {
+		return errors.Wrapf(_error, "Could not add etcd learner '%s'", name)
+	}
+
+	log.WithFields(log.Fields{"node": name, "id": fmt.Sprintf("%x", response.Member.ID)}).Info("Etcd learner added")
+
+	return nil
+}
+
+// PromoteLearner waits until the learner caught up with the leader and turns it into a voting member
+func (etcd *Etcd) PromoteLearner(name string, timeout uint) error {
+	node, ok := etcd.config.Config.Nodes[name]
+	if !ok {
+		return fmt.Errorf("Node '%s' not found", name)
+	}
+
+	client, _error := etcd.getClient(name)
+	if _error != nil {
+		return _error
+	}
+
+	defer client.Close()
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	for {
+		members, _error := etcd.listMembers(client)
+		if _error != nil {
+			return _error
+		}
+
+		member := findMember(members, getPeerURL(node.IP))
+		if member == nil {
+			return fmt.Errorf("Etcd member '%s' not found", name)
+		}
+
+		if !member.IsLearner {
+			return nil
+		}
+
+		_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+
+		// The promotion is refused as long as the learner is not in sync with the leader
+		_, _error = client.MemberPromote(_context, member.ID)
+
+		cancel()
+
+		if _error == nil {
+			log.WithFields(log.Fields{"node": name, "id": fmt.Sprintf("%x", member.ID)}).Info("Etcd learner promoted")
+
+			return nil
+		}
+
+		log.WithFields(log.Fields{"node": name, "error": _error}).Debug("Etcd learner not promoted yet")
+
+		if time.Now().After(deadline) {
+			return errors.Wrapf(_error, "Could not promote etcd learner '%s'", name)
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// RemoveMember removes the member with the given name, a missing member is not an error
+func (etcd *Etcd) RemoveMember(name string) error {
+	client, _error := etcd.getClient(name)
+	if _error != nil {
+		return _error
+	}
+
+	defer client.Close()
+
+	members, _error := etcd.listMembers(client)
+	if _error != nil {
+		return _error
+	}
+
+	for _, member := range members {
+		if member.Name != name {
+			continue
+		}
+
+		_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+
+		if _, _error := client.MemberRemove(_context, member.ID); _error != nil {
+			return errors.Wrapf(_error, "Could not remove etcd member '%s'", name)
+		}
+
+		log.WithFields(log.Fields{"node": name, "id": fmt.Sprintf("%x", member.ID)}).Info("Etcd member removed")
+
+		return nil
+	}
+
+	log.WithFields(log.Fields{"node": name}).Info("Etcd member not found")
+
+	return nil
+}
+
+// RemoveStaleMembers removes all members that are not controllers in the config anymore and returns their names
+func (etcd *Etcd) RemoveStaleMembers() ([]string, error) {
+	client, _error := etcd.getClient("")
+	if _error != nil {
+		return nil, _error
+	}
+
+	defer client.Close()
+
+	members, _error := etcd.listMembers(client)
+	if _error != nil {
+		return nil, _error
+	}
+
+	removed := []string{}
+
+	for _, member := range members {
+		// Learners that did not start yet have no name
+		if len(member.Name) == 0 {
+			continue
+		}
+
+		if node, ok := etcd.config.Config.Nodes[member.Name]; ok && node.IsController() {
+			continue
+		}
+
+		_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+
+		_, _error := client.MemberRemove(_context, member.ID)
+
+		cancel()
+
+		if _error != nil {
+			return removed, errors.Wrapf(_error, "Could not remove etcd member '%s'", member.Name)
+		}
+
+		log.WithFields(log.Fields{"node": member.Name, "id": fmt.Sprintf("%x", member.ID)}).Info("Etcd member removed")
+
+		removed = append(removed, member.Name)
+	}
+
+	return removed, nil
+}
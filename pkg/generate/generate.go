@@ -1,10 +1,16 @@
 package generate
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"os"
 	"path"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sethvargo/go-password/password"
@@ -53,6 +59,8 @@ func NewGenerator(config *config.InternalConfig) *Generator {
 		generator.generateCertificates,
 		// Generate Kubeconfig files
 		generator.generateKubeConfigs,
+		// Copy OIDC CA
+		generator.generateOIDCCA,
 		// Generate Ceph Manager secrets file
 		generator.generateCephManagerCredentials,
 		// Generate Ceph certificates config map file
@@ -124,7 +132,7 @@ func NewGenerator(config *config.InternalConfig) *Generator {
 		// Generate Worker Virtual-IP manifest
 		generator.generateManifestWorkerVirtualIP,
 		// Generate Etcd manifest
-		generator.generateManifestEtcd,
+		generator.GenerateManifestEtcd,
 		// Generate Kube-Apiserver manifest
 		generator.generateManifestKubeApiserver,
 		// Generate Kube-Controller-Manager manifest
@@ -158,11 +166,14 @@ func (generator *Generator) generateServiceFile() error {
 		Command       string
 		BaseDirectory string
 		Binary        string
+		StopTimeout   uint
 	}{
 		ProjectTitle:  utils.ProjectTitle,
 		Command:       generator.config.GetFullTargetAssetFilename(utils.BinaryK8sTew),
 		BaseDirectory: generator.config.Config.DeploymentDirectory,
 		Binary:        utils.BinaryK8sTew,
+		// systemd must not kill k8s-tew before its own shutdown timeout expired
+		StopTimeout: utils.ShutdownTimeout + utils.ServiceStopTimeoutMargin,
 	}, generator.config.GetFullLocalAssetFilename(utils.ServiceConfig), true, false, 0644)
 }
 
@@ -475,7 +486,8 @@ func (generator *Generator) generateManifestWorkerVirtualIP() error {
 	return nil
 }
 
-func (generator *Generator) generateManifestEtcd() error {
+// GenerateManifestEtcd generates the static pod manifests of etcd on all controllers
+func (generator *Generator) GenerateManifestEtcd() error {
 	for nodeName, node := range generator.config.Config.Nodes {
 		generator.config.SetNode(nodeName, node)
 
@@ -492,6 +504,7 @@ func (generator *Generator) generateManifestEtcd() error {
 			NodeIP            string
 			EtcdDataDirectory string
 			EtcdCluster       string
+			EtcdClusterState  string
 		}{
 			EtcdImage:         generator.config.Config.Versions.Etcd,
 			Name:              nodeName,
@@ -501,6 +514,7 @@ func (generator *Generator) generateManifestEtcd() error {
 			NodeIP:            node.IP,
 			EtcdDataDirectory: generator.config.GetFullTargetAssetDirectory(utils.DirectoryEtcdData),
 			EtcdCluster:       generator.config.GetEtcdCluster(),
+			EtcdClusterState:  generator.config.Config.EtcdClusterState,
 		}, generator.config.GetFullLocalAssetFilename(utils.ManifestEtcd), true, false, 0644); error != nil {
 			return error
 		}
@@ -510,6 +524,17 @@ func (generator *Generator) generateManifestEtcd() error {
 }
 
 func (generator *Generator) generateManifestKubeApiserver() error {
+	oidcIssuerURL := ""
+	oidcCA := ""
+
+	if generator.config.Config.OIDC.IsEnabled() {
+		oidcIssuerURL = generator.config.Config.OIDC.IssuerURL
+	}
+
+	if generator.config.Config.OIDC.HasCA() {
+		oidcCA = generator.config.GetFullTargetAssetFilename(utils.PemOIDCCa)
+	}
+
 	for nodeName, node := range generator.config.Config.Nodes {
 		generator.config.SetNode(nodeName, node)
 
@@ -534,6 +559,11 @@ func (generator *Generator) generateManifestKubeApiserver() error {
 			APIServerPort        uint16
 			ClusterIPRange       string
 			ClusterDomain        string
+			OIDCIssuerURL        string
+			OIDCClientID         string
+			OIDCUsernameClaim    string
+			OIDCGroupsClaim      string
+			OIDCCA               string
 		}{
 			KubernetesImage:      generator.config.Config.Versions.KubeAPIServer,
 			ControllersCount:     generator.config.GetControllersCount(),
@@ -551,6 +581,11 @@ func (generator *Generator) generateManifestKubeApiserver() error {
 			APIServerPort:        generator.config.Config.APIServerPort,
 			ClusterIPRange:       generator.config.Config.ClusterIPRange,
 			ClusterDomain:        generator.config.Config.ClusterDomain,
+			OIDCIssuerURL:        oidcIssuerURL,
+			OIDCClientID:         generator.config.Config.OIDC.ClientID,
+			OIDCUsernameClaim:    generator.config.Config.OIDC.UsernameClaim,
+			OIDCGroupsClaim:      generator.config.Config.OIDC.GroupsClaim,
+			OIDCCA:               oidcCA,
 		}, generator.config.GetFullLocalAssetFilename(utils.ManifestKubeApiserver), true, false, 0644); error != nil {
 			return error
 		}
@@ -811,6 +846,28 @@ func (generator *Generator) generateConfigKubeConfig(kubeConfigFilename, caFilen
 	}, kubeConfigFilename, true, false, 0600)
 }
 
+// generateOIDCCA copies the CA of the OIDC issuer next to the other certificates so it gets deployed to the controllers
+func (generator *Generator) generateOIDCCA() error {
+	filename := generator.config.GetFullLocalAssetFilename(utils.PemOIDCCa)
+
+	if !generator.config.Config.OIDC.HasCA() {
+		return nil
+	}
+
+	content, error := utils.ReadFile(generator.config.Config.OIDC.CAFile)
+	if error != nil {
+		return error
+	}
+
+	if error := os.WriteFile(filename, []byte(content), 0644); error != nil {
+		return errors.Wrapf(error, "Could not write to %s", filename)
+	}
+
+	utils.LogFilename("Generated", filename)
+
+	return nil
+}
+
 func (generator *Generator) getAPIServerAddress(ip string) string {
 	return fmt.Sprintf("%s:%d", ip, generator.config.Config.LoadBalancerPort)
 }
@@ -852,6 +909,163 @@ func (generator *Generator) generateKubeConfigs() error {
 	return nil
 }
 
+// ValidateUserName rejects user names that cannot be used as part of a filename
+func ValidateUserName(name string) error {
+	if len(name) == 0 {
+		return errors.New("empty user name")
+	}
+
+	if strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+		return fmt.Errorf("Invalid user name '%s'", name)
+	}
+
+	return nil
+}
+
+// GenerateUserKubeConfig creates a client certificate signed by the cluster CA and a kubeconfig using it
+func (generator *Generator) GenerateUserKubeConfig(name, group, kubeConfigFilename string) error {
+	var error error
+
+	if error := ValidateUserName(name); error != nil {
+		return error
+	}
+
+	generator.ca, error = pki.LoadCertificateAndPrivateKey(generator.config.GetFullLocalAssetFilename(utils.PemCa), generator.config.GetFullLocalAssetFilename(utils.PemCaKey))
+	if error != nil {
+		return error
+	}
+
+	apiServer, error := generator.config.GetAPIServerIP()
+	if error != nil {
+		return error
+	}
+
+	certificatesDirectory := generator.config.GetFullLocalAssetDirectory(utils.DirectoryCertificates)
+	certificateFilename := path.Join(certificatesDirectory, fmt.Sprintf(utils.PemUser, name))
+	keyFilename := path.Join(certificatesDirectory, fmt.Sprintf(utils.PemUserKey, name))
+
+	if error := pki.GenerateClient(generator.ca, generator.config.Config.RSASize, generator.config.Config.ClientValidityPeriod, name, group, []string{}, []string{}, certificateFilename, keyFilename, true); error != nil {
+		return error
+	}
+
+	return generator.generateConfigKubeConfig(kubeConfigFilename, generator.ca.CertificateFilename, name, generator.getAPIServerAddress(apiServer), certificateFilename, keyFilename, true)
+}
+
+// GenerateUserOIDCKubeConfig creates a kubeconfig that retrieves the user's token from the OIDC issuer using the kubectl oidc-login exec plugin
+func (generator *Generator) GenerateUserOIDCKubeConfig(name, clientSecret string, extraScopes []string, kubeConfigFilename string) error {
+	oidc := generator.config.Config.OIDC
+
+	if error := ValidateUserName(name); error != nil {
+		return error
+	}
+
+	if !oidc.IsEnabled() {
+		return errors.New("OIDC is not configured, set at least the issuer URL and the client ID")
+	}
+
+	// The CA is embedded, as the kubeconfig is handed to users that do not have the file
+	issuerCAData := ""
+
+	if oidc.HasCA() {
+		var error error
+
+		issuerCAData, error = utils.GetBase64OfPEM(oidc.CAFile)
+		if error != nil {
+			return error
+		}
+	}
+
+	if error := checkOIDCDiscovery(oidc.IssuerURL, oidc.CAFile); error != nil {
+		return error
+	}
+
+	apiServer, error := generator.config.GetAPIServerIP()
+	if error != nil {
+		return error
+	}
+
+	base64CA, error := utils.GetBase64OfPEM(generator.config.GetFullLocalAssetFilename(utils.PemCa))
+	if error != nil {
+		return error
+	}
+
+	return utils.ApplyTemplateAndSave("kubeconfig-oidc", utils.TemplateKubeconfigOIDC, struct {
+		Name         string
+		User         string
+		APIServer    string
+		CAData       string
+		Command      string
+		Plugin       string
+		IssuerURL    string
+		ClientID     string
+		ClientSecret string
+		ExtraScopes  []string
+		IssuerCAData string
+	}{
+		Name:         name,
+		User:         name,
+		APIServer:    generator.getAPIServerAddress(apiServer),
+		CAData:       base64CA,
+		Command:      utils.OIDCLoginCommand,
+		Plugin:       utils.OIDCLoginPlugin,
+		IssuerURL:    oidc.IssuerURL,
+		ClientID:     oidc.ClientID,
+		ClientSecret: clientSecret,
+		ExtraScopes:  extraScopes,
+		IssuerCAData: issuerCAData,
+	}, kubeConfigFilename, true, false, 0600)
+}
+
+// checkOIDCDiscovery verifies that the issuer serves its discovery document and identifies itself with the configured URL,
+// which is what the API Server and kubelogin expect
+func checkOIDCDiscovery(issuerURL, caFile string) error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if len(caFile) > 0 {
+		content, error := os.ReadFile(caFile)
+		if error != nil {
+			return errors.Wrapf(error, "Could not read OIDC CA '%s'", caFile)
+		}
+
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(content) {
+			return fmt.Errorf("No certificates found in OIDC CA '%s'", caFile)
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	client := &http.Client{Transport: transport, Timeout: utils.OIDCDiscoveryTimeout * time.Second}
+
+	discoveryURL := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+
+	response, error := client.Get(discoveryURL)
+	if error != nil {
+		return errors.Wrapf(error, "Could not retrieve OIDC discovery document from '%s'", discoveryURL)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Could not retrieve OIDC discovery document from '%s' (%s)", discoveryURL, response.Status)
+	}
+
+	discovery := struct {
+		Issuer string `json:"issuer"`
+	}{}
+
+	if error := json.NewDecoder(response.Body).Decode(&discovery); error != nil {
+		return errors.Wrapf(error, "Could not parse OIDC discovery document from '%s'", discoveryURL)
+	}
+
+	if discovery.Issuer != issuerURL {
+		return fmt.Errorf("OIDC issuer '%s' does not match the configured issuer URL '%s'", discovery.Issuer, issuerURL)
+	}
+
+	return nil
+}
+
 func (generator *Generator) generateCephSetup() error {
 	return utils.ApplyTemplateAndSave("ceph-setup", utils.TemplateCephSetup, struct {
 		Namespace                   string
@@ -1192,11 +1406,13 @@ func (generator *Generator) generatePrometheusSetup() error {
 		PrometheusImage string
 		PrometheusSize  uint16
 		BusyboxImage    string
+		MetricsPort     uint16
 	}{
 		Namespace:       utils.NamespaceMonitoring,
 		PrometheusImage: generator.config.Config.Versions.Prometheus,
 		PrometheusSize:  generator.config.Config.PrometheusSize,
 		BusyboxImage:    generator.config.Config.Versions.Busybox,
+		MetricsPort:     generator.config.GetMetricsPort(),
 	}, generator.config.GetFullLocalAssetFilename(utils.K8sPrometheusSetup), true, true, 0644)
 }
 
@@ -0,0 +1,157 @@
+package generate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+// newOIDCStandIn starts a TLS server serving the discovery document of an OIDC issuer
+func newOIDCStandIn(t *testing.T, issuer func(url string) string) *httptest.Server {
+	var server *httptest.Server
+
+	server = httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(writer, request)
+
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+
+		_ = json.NewEncoder(writer).Encode(map[string]string{"issuer": issuer(server.URL), "authorization_endpoint": server.URL + "/auth", "token_endpoint": server.URL + "/token", "jwks_uri": server.URL + "/keys"})
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newOIDCConfig(t *testing.T, server *httptest.Server) *config.InternalConfig {
+	directory := t.TempDir()
+
+	_config := config.NewInternalConfig(directory)
+	_config.Generate()
+
+	if _, _, error := _config.AddNode("controller", "192.168.100.10", 0, 0, []string{utils.NodeController, utils.NodeWorker}); error != nil {
+		t.Fatal(error)
+	}
+
+	issuerCA := path.Join(directory, "issuer-ca.pem")
+
+	if error := os.WriteFile(issuerCA, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); error != nil {
+		t.Fatal(error)
+	}
+
+	clusterCA := _config.GetFullLocalAssetFilename(utils.PemCa)
+
+	if error := os.MkdirAll(path.Dir(clusterCA), 0755); error != nil {
+		t.Fatal(error)
+	}
+
+	if error := os.WriteFile(clusterCA, []byte("cluster-ca"), 0644); error != nil {
+		t.Fatal(error)
+	}
+
+	_config.Config.OIDC = config.OIDCConfig{IssuerURL: server.URL, ClientID: "kubernetes", CAFile: issuerCA}
+
+	return _config
+}
+
+func TestGenerateUserOIDCKubeConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		issuer   func(url string) string
+		path     string
+		expected bool
+	}{
+		{name: "valid issuer", user: "jane", issuer: func(url string) string { return url }, expected: true},
+		{name: "issuer with trailing slash", user: "jane", issuer: func(url string) string { return url + "/" }, path: "/", expected: true},
+		{name: "issuer mismatch", user: "jane", issuer: func(url string) string { return "https://other.example.com" }},
+		{name: "missing discovery document", user: "jane", issuer: func(url string) string { return url }, path: "/missing"},
+		{name: "user name with path separator", user: "../jane", issuer: func(url string) string { return url }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newOIDCStandIn(t, test.issuer)
+			_config := newOIDCConfig(t, server)
+			_config.Config.OIDC.IssuerURL = server.URL + test.path
+
+			kubeconfig := path.Join(t.TempDir(), "kubeconfig")
+
+			error := NewGenerator(_config).GenerateUserOIDCKubeConfig(test.user, "", []string{"email", "groups"}, kubeconfig)
+
+			if !test.expected {
+				if error == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if error != nil {
+				t.Fatal(error)
+			}
+
+			content, error := os.ReadFile(kubeconfig)
+			if error != nil {
+				t.Fatal(error)
+			}
+
+			issuerCA, error := utils.GetBase64OfPEM(_config.Config.OIDC.CAFile)
+			if error != nil {
+				t.Fatal(error)
+			}
+
+			for _, expected := range []string{
+				"- --oidc-issuer-url=" + _config.Config.OIDC.IssuerURL,
+				"- --oidc-client-id=kubernetes",
+				"- --oidc-extra-scope=groups",
+				"- --certificate-authority-data=" + issuerCA,
+				"certificate-authority-data: " + base64.StdEncoding.EncodeToString([]byte("cluster-ca")),
+				"server: https://192.168.100.10:",
+			} {
+				if !strings.Contains(string(content), expected) {
+					t.Errorf("kubeconfig does not contain '%s':\n%s", expected, content)
+				}
+			}
+
+			if strings.Contains(string(content), _config.Config.OIDC.CAFile) {
+				t.Errorf("kubeconfig contains the local CA filename:\n%s", content)
+			}
+		})
+	}
+}
+
+func TestValidateUserName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{name: "jane", valid: true},
+		{name: "jane.doe@example.com", valid: true},
+		{name: ""},
+		{name: "."},
+		{name: ".."},
+		{name: "../../x"},
+		{name: "a/b"},
+		{name: "a\\b"},
+	}
+
+	for _, test := range tests {
+		if error := ValidateUserName(test.name); (error == nil) != test.valid {
+			t.Errorf("ValidateUserName(%q) = %v, expected valid %v", test.name, error, test.valid)
+		}
+	}
+}
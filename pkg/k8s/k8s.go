@@ -18,6 +18,7 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -70,7 +71,8 @@ func (k8s *K8S) getClient() (*kubernetes.Clientset, error) {
 	return result, nil
 }
 
-func (k8s *K8S) unschedulable(name string, unschedulable bool) error {
+// updateNode applies the change to the node and saves it, unless the change reports that nothing changed
+func (k8s *K8S) updateNode(name string, change func(node *v1.Node) bool) error {
 	// Create client
 	clientset, error := k8s.getClient()
 	if error != nil {
@@ -85,12 +87,10 @@ func (k8s *K8S) unschedulable(name string, unschedulable bool) error {
 		return errors.Wrapf(error, "Could not get Kubernetes node '%s'", name)
 	}
 
-	if node.Spec.Unschedulable == unschedulable {
+	if !change(node) {
 		return nil
 	}
 
-	node.Spec.Unschedulable = unschedulable
-
 	_, error = clientset.CoreV1().Nodes().Update(context, node, metav1.UpdateOptions{})
 
 	if error != nil {
@@ -100,6 +100,18 @@ func (k8s *K8S) unschedulable(name string, unschedulable bool) error {
 	return nil
 }
 
+func (k8s *K8S) unschedulable(name string, unschedulable bool) error {
+	return k8s.updateNode(name, func(node *v1.Node) bool {
+		if node.Spec.Unschedulable == unschedulable {
+			return false
+		}
+
+		node.Spec.Unschedulable = unschedulable
+
+		return true
+	})
+}
+
 func (k8s *K8S) Cordon(name string) error {
 	return k8s.unschedulable(name, true)
 }
@@ -108,6 +120,68 @@ func (k8s *K8S) Uncordon(name string) error {
 	return k8s.unschedulable(name, false)
 }
 
+// CordonBy cordons the node and records the holder in an annotation. Such a node is not uncordoned by UncordonUnlessHeld,
+// only by UncordonBy with the same holder.
+func (k8s *K8S) CordonBy(name, holder string) error {
+	return k8s.updateNode(name, func(node *v1.Node) bool {
+		if node.Annotations == nil {
+			node.Annotations = map[string]string{}
+		}
+
+		node.Annotations[utils.AnnotationCordonedBy] = holder
+		node.Spec.Unschedulable = true
+
+		return true
+	})
+}
+
+// UncordonBy uncordons the node and removes the annotation of the holder
+func (k8s *K8S) UncordonBy(name, holder string) error {
+	return k8s.updateNode(name, func(node *v1.Node) bool {
+		if node.Annotations[utils.AnnotationCordonedBy] == holder {
+			delete(node.Annotations, utils.AnnotationCordonedBy)
+		}
+
+		node.Spec.Unschedulable = false
+
+		return true
+	})
+}
+
+// IsCordonedBy returns true if the node was cordoned by CordonBy with the holder
+func (k8s *K8S) IsCordonedBy(name, holder string) (bool, error) {
+	clientset, _error := k8s.getClient()
+	if _error != nil {
+		return false, _error
+	}
+
+	node, _error := clientset.CoreV1().Nodes().Get(context.Background(), name, metav1.GetOptions{})
+	if _error != nil {
+		return false, errors.Wrapf(_error, "Could not get Kubernetes node '%s'", name)
+	}
+
+	return node.Spec.Unschedulable && node.Annotations[utils.AnnotationCordonedBy] == holder, nil
+}
+
+// UncordonUnlessHeld uncordons the node, unless it was cordoned by CordonBy. In that case the holder is returned.
+func (k8s *K8S) UncordonUnlessHeld(name string) (string, error) {
+	holder := ""
+
+	_error := k8s.updateNode(name, func(node *v1.Node) bool {
+		holder = node.Annotations[utils.AnnotationCordonedBy]
+
+		if len(holder) > 0 || !node.Spec.Unschedulable {
+			return false
+		}
+
+		node.Spec.Unschedulable = false
+
+		return true
+	})
+
+	return holder, _error
+}
+
 func (k8s *K8S) DeleteJob(namespace, jobName string) error {
 	clientset, _error := k8s.getClient()
 	if _error != nil {
@@ -128,7 +202,63 @@ func (k8s *K8S) DeleteJob(namespace, jobName string) error {
 	return nil
 }
 
+// DeleteNode removes the node object from the cluster, a missing node is not an error
+func (k8s *K8S) DeleteNode(name string) error {
+	clientset, _error := k8s.getClient()
+	if _error != nil {
+		return errors.Wrapf(_error, "Could not connect to cluster")
+	}
+
+	_error = clientset.CoreV1().Nodes().Delete(context.Background(), name, metav1.DeleteOptions{})
+	if _error != nil && !apierrors.IsNotFound(_error) {
+		return errors.Wrapf(_error, "Could not delete node '%s'", name)
+	}
+
+	return nil
+}
+
+// DeleteDeployment removes a deployment and its pods, a missing deployment is not an error
+func (k8s *K8S) DeleteDeployment(namespace, name string) error {
+	clientset, _error := k8s.getClient()
+	if _error != nil {
+		return errors.Wrapf(_error, "Could not connect to cluster")
+	}
+
+	delete := metav1.DeletePropagationForeground
+
+	_error = clientset.AppsV1().Deployments(namespace).Delete(context.Background(), name, metav1.DeleteOptions{PropagationPolicy: &delete})
+	if _error != nil && !apierrors.IsNotFound(_error) {
+		return errors.Wrapf(_error, "Could not delete deployment '%s/%s'", namespace, name)
+	}
+
+	return nil
+}
+
+// ExecInRunningPod executes a command in the first running pod matching the label selector
+func (k8s *K8S) ExecInRunningPod(namespace, labelSelector, container, command string) (string, error) {
+	clientset, _error := k8s.getClient()
+	if _error != nil {
+		return "", errors.Wrapf(_error, "Could not connect to cluster")
+	}
+
+	pods, _error := clientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{LabelSelector: labelSelector, FieldSelector: "status.phase=Running"})
+	if _error != nil {
+		return "", errors.Wrap(_error, "Could not get pods")
+	}
+
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("No running pod found in namespace '%s' for '%s'", namespace, labelSelector)
+	}
+
+	return k8s.Exec(namespace, pods.Items[0].Name, container, command)
+}
+
 func (k8s *K8S) Drain(nodeName string) error {
+	return k8s.DrainContext(context.Background(), nodeName)
+}
+
+// DrainContext drains the node like Drain, but gives up once the context is done
+func (k8s *K8S) DrainContext(_context context.Context, nodeName string) error {
 	var clientset *kubernetes.Clientset
 	var pods *v1.PodList
 
@@ -137,7 +267,6 @@ func (k8s *K8S) Drain(nodeName string) error {
 		return errors.Wrapf(_error, "Could not connect to cluster")
 	}
 
-	context := context.Background()
 	fieldSelector := fmt.Sprintf("spec.nodeName=%s", nodeName)
 
 	// Delete non-essential pods
@@ -147,7 +276,7 @@ func (k8s *K8S) Drain(nodeName string) error {
 		labelSelector := "cluster-relevant!=true"
 
 		for {
-			pods, _error = clientset.CoreV1().Pods("").List(context, metav1.ListOptions{FieldSelector: fieldSelector, LabelSelector: labelSelector})
+			pods, _error = clientset.CoreV1().Pods("").List(_context, metav1.ListOptions{FieldSelector: fieldSelector, LabelSelector: labelSelector})
 			if _error != nil {
 				return errors.Wrap(_error, "Could not get pods")
 			}
@@ -183,7 +312,7 @@ func (k8s *K8S) Drain(nodeName string) error {
 
 				gracePeriodSeconds := int64(k8s.config.Config.DrainGracePeriodSeconds)
 
-				_error := clientset.CoreV1().Pods(pod.Namespace).Delete(context, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriodSeconds})
+				_error := clientset.CoreV1().Pods(pod.Namespace).Delete(_context, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriodSeconds})
 				if _error != nil {
 					log.WithFields(log.Fields{"error": _error, "namespace": pod.Namespace, "pod": pod.Name}).Debug("Could not evict pod")
 				}
@@ -195,7 +324,9 @@ func (k8s *K8S) Drain(nodeName string) error {
 				break
 			}
 
-			time.Sleep(time.Second)
+			if _error := sleepContext(_context, time.Second); _error != nil {
+				return _error
+			}
 		}
 	}
 
@@ -206,7 +337,7 @@ func (k8s *K8S) Drain(nodeName string) error {
 		done := false
 
 		for i := 0; i < 5; i++ {
-			pods, _error = clientset.CoreV1().Pods("").List(context, metav1.ListOptions{FieldSelector: fieldSelector})
+			pods, _error = clientset.CoreV1().Pods("").List(_context, metav1.ListOptions{FieldSelector: fieldSelector})
 			if _error != nil {
 				return errors.Wrap(_error, "Could not get pods")
 			}
@@ -237,7 +368,7 @@ func (k8s *K8S) Drain(nodeName string) error {
 		if done {
 			log.Debug("Removing VolumeAttachments")
 
-			attachments, _error := clientset.StorageV1().VolumeAttachments().List(context, metav1.ListOptions{})
+			attachments, _error := clientset.StorageV1().VolumeAttachments().List(_context, metav1.ListOptions{})
 			if _error != nil {
 				return errors.Wrap(_error, "Could not get VolumeAttachments")
 			}
@@ -247,7 +378,7 @@ func (k8s *K8S) Drain(nodeName string) error {
 					continue
 				}
 
-				_error := clientset.StorageV1().VolumeAttachments().Delete(context, attachment.Name, metav1.DeleteOptions{})
+				_error := clientset.StorageV1().VolumeAttachments().Delete(_context, attachment.Name, metav1.DeleteOptions{})
 				if _error != nil {
 					log.WithFields(log.Fields{"error": _error, "namespace": attachment.Namespace, "attachment": attachment.Name}).Debug("Could not remove attachment")
 				}
@@ -268,13 +399,26 @@ func (k8s *K8S) Drain(nodeName string) error {
 
 			log.WithFields(log.Fields{"mounts": list}).Debug("Found CSI mounts")
 
-			time.Sleep(time.Second)
+			if _error := sleepContext(_context, time.Second); _error != nil {
+				return _error
+			}
 		}
 	}
 
 	return nil
 }
 
+// sleepContext waits for the duration, unless the context is done before
+func sleepContext(_context context.Context, duration time.Duration) error {
+	select {
+	case <-_context.Done():
+		return errors.Wrap(_context.Err(), "Drain aborted")
+
+	case <-time.After(duration):
+		return nil
+	}
+}
+
 func (k8s *K8S) TaintNode(name string, nodeData *config.Node) error {
 	// Create client
 	clientset, error := k8s.getClient()
@@ -724,6 +868,97 @@ func (k8s *K8S) WaitForCluster(totalStableIterations uint) error {
 	return nil
 }
 
+// WaitForNode waits until the kubelet renewed its lease after since, the node is ready and all its static pods are ready
+func (k8s *K8S) WaitForNode(name string, since time.Time, timeout uint) error {
+	log.WithFields(log.Fields{"node": name}).Info("Waiting for node")
+
+	checkNode := func() (reason string, _error error) {
+		clientset, _error := k8s.getClient()
+		if _error != nil {
+			return
+		}
+
+		context := context.Background()
+
+		lease, _error := clientset.CoordinationV1().Leases(utils.NamespaceKubeNodeLease).Get(context, name, metav1.GetOptions{})
+		if _error != nil {
+			return
+		}
+
+		if lease.Spec.RenewTime == nil || lease.Spec.RenewTime.Time.Before(since) {
+			return "kubelet not reporting", nil
+		}
+
+		node, _error := clientset.CoreV1().Nodes().Get(context, name, metav1.GetOptions{})
+		if _error != nil {
+			return
+		}
+
+		nodeReady := false
+
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+				nodeReady = true
+			}
+		}
+
+		if !nodeReady {
+			return "node not ready", nil
+		}
+
+		pods, _error := clientset.CoreV1().Pods("").List(context, metav1.ListOptions{FieldSelector: fmt.Sprintf("spec.nodeName=%s", name)})
+		if _error != nil {
+			return
+		}
+
+		for _, pod := range pods.Items {
+			isStatic := false
+
+			for _, ownerReference := range pod.OwnerReferences {
+				if ownerReference.Kind == "Node" {
+					isStatic = true
+				}
+			}
+
+			if !isStatic {
+				continue
+			}
+
+			for _, container := range pod.Status.ContainerStatuses {
+				if !container.Ready {
+					return fmt.Sprintf("static pod %s not ready", pod.Name), nil
+				}
+			}
+		}
+
+		return "", nil
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	for {
+		reason, _error := checkNode()
+
+		if _error == nil && len(reason) == 0 {
+			log.WithFields(log.Fields{"node": name}).Info("Node ready")
+
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if _error != nil {
+				reason = _error.Error()
+			}
+
+			return fmt.Errorf("Node '%s' did not become ready within %d seconds (%s)", name, timeout, reason)
+		}
+
+		log.WithFields(log.Fields{"node": name, "reason": reason, "error": _error}).Debug("Node not ready")
+
+		time.Sleep(time.Second)
+	}
+}
+
 func ApplyManifest(_config *config.InternalConfig, name, manifest string, commandRetries int) error {
 	var error error
 
@@ -0,0 +1,203 @@
+package servers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const apiActionStart = "start"
+const apiActionStop = "stop"
+const apiActionRestart = "restart"
+
+// API exposes the status of the servers and commands and controls the servers over a unix socket
+type API struct {
+	servers    *Servers
+	filename   string
+	tlsConfig  *tls.Config
+	httpServer *http.Server
+}
+
+// getTLSCertificates returns the certificate of the node and the CA used to verify the peer
+func getTLSCertificates(_config *config.InternalConfig) (tls.Certificate, *x509.CertPool, error) {
+	certificate, _error := tls.LoadX509KeyPair(_config.GetFullLocalAssetFilename(utils.PemKubelet), _config.GetFullLocalAssetFilename(utils.PemKubeletKey))
+	if _error != nil {
+		return certificate, nil, errors.Wrap(_error, "Could not load certificate")
+	}
+
+	ca, _error := os.ReadFile(_config.GetFullLocalAssetFilename(utils.PemCa))
+	if _error != nil {
+		return certificate, nil, errors.Wrap(_error, "Could not load CA")
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(ca) {
+		return certificate, nil, errors.New("Could not parse CA")
+	}
+
+	return certificate, pool, nil
+}
+
+func NewAPI(servers *Servers, useTLS bool) (*API, error) {
+	api := &API{servers: servers, filename: servers.getConfig().GetFullLocalAssetFilename(utils.ControlSocket)}
+
+	if useTLS {
+		certificate, pool, _error := getTLSCertificates(servers.getConfig())
+		if _error != nil {
+			return nil, _error
+		}
+
+		api.tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	}
+
+	return api, nil
+}
+
+// Start listens on the socket, which is only accessible by root
+func (api *API) Start() error {
+	if _error := utils.CreateDirectoryIfMissing(filepath.Dir(api.filename)); _error != nil {
+		return _error
+	}
+
+	// Remove the socket of a previous run
+	_ = os.Remove(api.filename)
+
+	listener, _error := net.Listen("unix", api.filename)
+	if _error != nil {
+		return errors.Wrapf(_error, "Could not listen on '%s'", api.filename)
+	}
+
+	if _error := os.Chmod(api.filename, 0600); _error != nil {
+		listener.Close()
+
+		return errors.Wrapf(_error, "Could not change mode of '%s'", api.filename)
+	}
+
+	if api.tlsConfig != nil {
+		listener = tls.NewListener(listener, api.tlsConfig)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", api.handleStatus)
+	mux.HandleFunc("/servers/", api.handleServer)
+
+	api.httpServer = &http.Server{Handler: mux}
+
+	go func() {
+		if _error := api.httpServer.Serve(listener); _error != nil && _error != http.ErrServerClosed {
+			log.WithFields(log.Fields{"error": _error}).Error("API failed")
+		}
+	}()
+
+	log.WithFields(log.Fields{"socket": api.filename, "tls": api.tlsConfig != nil}).Info("API started")
+
+	return nil
+}
+
+// Stop closes the socket and waits for the pending requests to finish. Stopping it again has no effect.
+func (api *API) Stop() {
+	if api.httpServer == nil {
+		return
+	}
+
+	_ = api.httpServer.Shutdown(context.Background())
+
+	api.httpServer = nil
+
+	_ = os.Remove(api.filename)
+
+	log.Info("API stopped")
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+
+	_ = json.NewEncoder(writer).Encode(value)
+}
+
+func writeError(writer http.ResponseWriter, status int, _error error) {
+	writeJSON(writer, status, map[string]string{"error": _error.Error()})
+}
+
+func (api *API) handleStatus(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", request.Method))
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, api.servers.Status())
+}
+
+// handleServer executes the action of a request in the form POST /servers/{name}/{action}
+func (api *API) handleServer(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", request.Method))
+
+		return
+	}
+
+	tokens := strings.Split(strings.TrimPrefix(request.URL.Path, "/servers/"), "/")
+	if len(tokens) != 2 {
+		writeError(writer, http.StatusNotFound, fmt.Errorf("Unknown path '%s'", request.URL.Path))
+
+		return
+	}
+
+	name, action := tokens[0], tokens[1]
+
+	// Requests are serialized with reloads, so that the servers being replaced are not started again
+	api.servers.lifecycle.Lock()
+	defer api.servers.lifecycle.Unlock()
+
+	server := api.servers.findServer(name)
+	if server == nil {
+		writeError(writer, http.StatusNotFound, fmt.Errorf("Server '%s' not found", name))
+
+		return
+	}
+
+	log.WithFields(log.Fields{"name": name, "action": action}).Info("API request")
+
+	switch action {
+	case apiActionStart:
+		if _error := server.Start(); _error != nil {
+			writeError(writer, http.StatusInternalServerError, _error)
+
+			return
+		}
+
+	case apiActionStop:
+		server.Stop()
+
+	case apiActionRestart:
+		server.Stop()
+
+		if _error := server.Start(); _error != nil {
+			writeError(writer, http.StatusInternalServerError, _error)
+
+			return
+		}
+
+	default:
+		writeError(writer, http.StatusNotFound, fmt.Errorf("Unknown action '%s'", action))
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, server.Status())
+}
@@ -0,0 +1,140 @@
+package servers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// The host is ignored, the requests are sent to the unix socket
+const apiHost = "k8s-tew"
+
+// APIClient talks to the API of a running 'k8s-tew run'
+type APIClient struct {
+	filename string
+	baseURL  string
+	client   *http.Client
+}
+
+func NewAPIClient(_config *config.InternalConfig, useTLS bool) (*APIClient, error) {
+	filename := _config.GetFullLocalAssetFilename(utils.ControlSocket)
+
+	transport := &http.Transport{DialContext: func(_context context.Context, _, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+
+		return dialer.DialContext(_context, "unix", filename)
+	}}
+
+	baseURL := "http://" + apiHost
+
+	if useTLS {
+		baseURL = "https://" + apiHost
+
+		certificate, pool, _error := getTLSCertificates(_config)
+		if _error != nil {
+			return nil, _error
+		}
+
+		// The certificate of the node does not name the socket, so only its chain is verified
+		transport.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, InsecureSkipVerify: true, VerifyPeerCertificate: func(rawCertificates [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertificateChain(rawCertificates, pool)
+		}}
+	}
+
+	return &APIClient{filename: filename, baseURL: baseURL, client: &http.Client{Transport: transport, Timeout: utils.APITimeout * time.Second}}, nil
+}
+
+func verifyCertificateChain(rawCertificates [][]byte, pool *x509.CertPool) error {
+	if len(rawCertificates) == 0 {
+		return errors.New("No certificate received")
+	}
+
+	certificates := []*x509.Certificate{}
+
+	for _, rawCertificate := range rawCertificates {
+		certificate, _error := x509.ParseCertificate(rawCertificate)
+		if _error != nil {
+			return _error
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	intermediates := x509.NewCertPool()
+
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	_, _error := certificates[0].Verify(x509.VerifyOptions{Roots: pool, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+
+	return _error
+}
+
+func (client *APIClient) do(method, path string, result interface{}) error {
+	request, _error := http.NewRequest(method, client.baseURL+path, nil)
+	if _error != nil {
+		return _error
+	}
+
+	response, _error := client.client.Do(request)
+	if _error != nil {
+		return errors.Wrapf(_error, "Could not connect to '%s', is 'k8s-tew run' running?", client.filename)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		failure := map[string]string{}
+
+		if _error := json.NewDecoder(response.Body).Decode(&failure); _error == nil && len(failure["error"]) > 0 {
+			return errors.New(failure["error"])
+		}
+
+		return fmt.Errorf("Unexpected status code %d", response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+func (client *APIClient) GetStatus() (*Status, error) {
+	status := &Status{}
+
+	if _error := client.do(http.MethodGet, "/status", status); _error != nil {
+		return nil, _error
+	}
+
+	return status, nil
+}
+
+func (client *APIClient) control(name, action string) (*ServerStatus, error) {
+	status := &ServerStatus{}
+
+	if _error := client.do(http.MethodPost, fmt.Sprintf("/servers/%s/%s", url.PathEscape(name), action), status); _error != nil {
+		return nil, _error
+	}
+
+	return status, nil
+}
+
+func (client *APIClient) StartServer(name string) (*ServerStatus, error) {
+	return client.control(name, apiActionStart)
+}
+
+func (client *APIClient) StopServer(name string) (*ServerStatus, error) {
+	return client.control(name, apiActionStop)
+}
+
+func (client *APIClient) RestartServer(name string) (*ServerStatus, error) {
+	return client.control(name, apiActionRestart)
+}
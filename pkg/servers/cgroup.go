@@ -0,0 +1,257 @@
+package servers
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+var cgroupControllers = []string{"cpu", "memory", "io"}
+
+var cgroupParentOnce sync.Once
+var cgroupParent string
+var cgroupParentError error
+
+// cgroup places the process of a server in its own cgroup v2 below the cgroup of k8s-tew and applies its resource limits
+type cgroup struct {
+	name      string
+	directory string
+	resources *config.ResourcesConfig
+}
+
+func newCgroup(name string, resources *config.ResourcesConfig) *cgroup {
+	return &cgroup{name: name, resources: resources}
+}
+
+// getCgroupParent returns the cgroup delegated to k8s-tew by systemd, which contains the cgroups of the servers. The
+// controllers can only be delegated to the children of a cgroup without processes, so k8s-tew moves itself into a leaf
+// cgroup the first time. That has to happen before any server is started.
+func getCgroupParent() (string, error) {
+	cgroupParentOnce.Do(func() {
+		cgroupParent, cgroupParentError = setupCgroupParent()
+	})
+
+	return cgroupParent, cgroupParentError
+}
+
+func setupCgroupParent() (string, error) {
+	if !isCgroupV2() {
+		return "", fmt.Errorf("No cgroup v2 mounted on '%s'", utils.CgroupRoot)
+	}
+
+	content, _error := os.ReadFile("/proc/self/cgroup")
+	if _error != nil {
+		return "", errors.Wrap(_error, "Could not read cgroup of k8s-tew")
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		// The cgroup v2 hierarchy has the ID 0 and no controllers
+		if !strings.HasPrefix(line, "0::") {
+			continue
+		}
+
+		parent := path.Join(utils.CgroupRoot, strings.TrimPrefix(line, "0::"))
+
+		if path.Base(parent) == utils.CgroupSupervisor {
+			parent = path.Dir(parent)
+		}
+
+		supervisor := path.Join(parent, utils.CgroupSupervisor)
+
+		if _error := utils.CreateDirectoryIfMissing(supervisor); _error != nil {
+			return "", _error
+		}
+
+		if _error := writeValue(supervisor, "cgroup.procs", strconv.Itoa(os.Getpid())); _error != nil {
+			return "", _error
+		}
+
+		if _error := enableControllers(parent); _error != nil {
+			return "", _error
+		}
+
+		log.WithFields(log.Fields{"cgroup": parent}).Debug("Delegated cgroup")
+
+		return parent, nil
+	}
+
+	return "", errors.New("Could not find cgroup v2 of k8s-tew")
+}
+
+func isCgroupV2() bool {
+	_, _error := os.Stat(path.Join(utils.CgroupRoot, "cgroup.controllers"))
+
+	return _error == nil
+}
+
+func writeValue(directory, filename, value string) error {
+	if _error := os.WriteFile(path.Join(directory, filename), []byte(value), 0644); _error != nil {
+		return errors.Wrapf(_error, "Could not write '%s' to '%s'", value, path.Join(directory, filename))
+	}
+
+	return nil
+}
+
+// enableControllers delegates the controllers to the children of the directory
+func enableControllers(directory string) error {
+	content, _error := os.ReadFile(path.Join(directory, "cgroup.subtree_control"))
+	if _error != nil {
+		return errors.Wrapf(_error, "Could not read controllers of '%s'", directory)
+	}
+
+	enabled := map[string]bool{}
+
+	for _, controller := range strings.Fields(string(content)) {
+		enabled[controller] = true
+	}
+
+	for _, controller := range cgroupControllers {
+		if enabled[controller] {
+			continue
+		}
+
+		if _error := writeValue(directory, "cgroup.subtree_control", "+"+controller); _error != nil {
+			return _error
+		}
+	}
+
+	return nil
+}
+
+// create creates the cgroup and applies the limits. Limits that are not set are reset to their defaults.
+func (cgroup *cgroup) create() error {
+	parent, _error := getCgroupParent()
+	if _error != nil {
+		return _error
+	}
+
+	cgroup.directory = path.Join(parent, cgroup.name)
+
+	if _error := utils.CreateDirectoryIfMissing(cgroup.directory); _error != nil {
+		return _error
+	}
+
+	cpu, _error := cgroup.resources.GetCPU()
+	if _error != nil {
+		return _error
+	}
+
+	cpuMax := fmt.Sprintf("max %d", utils.CgroupCPUPeriod)
+
+	if cpu > 0 {
+		cpuMax = fmt.Sprintf("%d %d", cpu*utils.CgroupCPUPeriod/1000, utils.CgroupCPUPeriod)
+	}
+
+	memory, _error := cgroup.resources.GetMemory()
+	if _error != nil {
+		return _error
+	}
+
+	memoryHigh, _error := cgroup.resources.GetMemoryHigh()
+	if _error != nil {
+		return _error
+	}
+
+	cpuWeight := cgroup.resources.CPUWeight
+	if cpuWeight == 0 {
+		cpuWeight = utils.CgroupDefaultWeight
+	}
+
+	ioWeight := cgroup.resources.IOWeight
+	if ioWeight == 0 {
+		ioWeight = utils.CgroupDefaultWeight
+	}
+
+	values := [][2]string{
+		{"cpu.max", cpuMax},
+		{"cpu.weight", strconv.FormatUint(uint64(cpuWeight), 10)},
+		{"memory.max", formatCgroupLimit(memory)},
+		{"memory.high", formatCgroupLimit(memoryHigh)},
+		{"io.weight", fmt.Sprintf("default %d", ioWeight)},
+	}
+
+	for _, value := range values {
+		if _error := writeValue(cgroup.directory, value[0], value[1]); _error != nil {
+			return _error
+		}
+	}
+
+	for _, limit := range cgroup.resources.IO {
+		value, _error := formatIOLimit(limit)
+		if _error != nil {
+			return _error
+		}
+
+		if _error := writeValue(cgroup.directory, "io.max", value); _error != nil {
+			return _error
+		}
+	}
+
+	return nil
+}
+
+func formatCgroupLimit(value int64) string {
+	if value <= 0 {
+		return "max"
+	}
+
+	return strconv.FormatInt(value, 10)
+}
+
+// formatIOLimit returns the io.max line of the limit, with the device path replaced by its major and minor number
+func formatIOLimit(limit config.IOLimitConfig) (string, error) {
+	var stat unix.Stat_t
+
+	if _error := unix.Stat(limit.Device, &stat); _error != nil {
+		return "", errors.Wrapf(_error, "Could not find device '%s'", limit.Device)
+	}
+
+	if stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return "", fmt.Errorf("'%s' is not a block device", limit.Device)
+	}
+
+	format := func(value uint64) string {
+		if value == 0 {
+			return "max"
+		}
+
+		return strconv.FormatUint(value, 10)
+	}
+
+	return fmt.Sprintf("%d:%d rbps=%s wbps=%s riops=%s wiops=%s", unix.Major(uint64(stat.Rdev)), unix.Minor(uint64(stat.Rdev)), format(limit.ReadBPS), format(limit.WriteBPS), format(limit.ReadIOPS), format(limit.WriteIOPS)), nil
+}
+
+// open returns the directory of the cgroup, which is passed to the process on start, so that it is created inside the
+// cgroup
+func (cgroup *cgroup) open() (*os.File, error) {
+	file, _error := os.Open(cgroup.directory)
+	if _error != nil {
+		return nil, errors.Wrapf(_error, "Could not open cgroup '%s'", cgroup.directory)
+	}
+
+	return file, nil
+}
+
+func setOOMScoreAdjust(pid int, resources *config.ResourcesConfig) error {
+	if resources == nil || resources.OOMScoreAdjust == nil {
+		return nil
+	}
+
+	return writeValue(fmt.Sprintf("/proc/%d", pid), "oom_score_adj", strconv.Itoa(*resources.OOMScoreAdjust))
+}
+
+// remove deletes the cgroup once the process exited. It fails as long as processes forked by the server are still in it.
+func (cgroup *cgroup) remove() {
+	if _error := os.Remove(cgroup.directory); _error != nil && !os.IsNotExist(_error) {
+		log.WithFields(log.Fields{"name": cgroup.name, "cgroup": cgroup.directory, "error": _error}).Debug("Could not remove cgroup")
+	}
+}
@@ -0,0 +1,111 @@
+package servers
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+// orderServerConfigs sorts the servers so that every server follows its dependencies. Otherwise the order of the config
+// is kept. Dependencies on servers that exist in the config, but do not run on this node, are ignored.
+func orderServerConfigs(_config *config.InternalConfig, serverConfigs []config.ServerConfig) ([]config.ServerConfig, error) {
+	known := map[string]bool{}
+
+	for _, serverConfig := range _config.Config.Servers {
+		known[serverConfig.Name] = true
+	}
+
+	local := map[string]config.ServerConfig{}
+
+	for _, serverConfig := range serverConfigs {
+		for _, dependency := range serverConfig.DependsOn {
+			if _error := dependency.Validate(); _error != nil {
+				return nil, fmt.Errorf("Invalid dependency of server '%s': %s", serverConfig.Name, _error.Error())
+			}
+
+			if !known[dependency.Name] {
+				return nil, fmt.Errorf("Server '%s' depends on unknown server '%s'", serverConfig.Name, dependency.Name)
+			}
+		}
+
+		local[serverConfig.Name] = serverConfig
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	states := map[string]int{}
+	path := []string{}
+	result := []config.ServerConfig{}
+
+	var visit func(serverConfig config.ServerConfig) error
+
+	visit = func(serverConfig config.ServerConfig) error {
+		switch states[serverConfig.Name] {
+		case visited:
+			return nil
+
+		case visiting:
+			return fmt.Errorf("Dependency cycle between servers: %s -> %s", strings.Join(path, " -> "), serverConfig.Name)
+		}
+
+		states[serverConfig.Name] = visiting
+		path = append(path, serverConfig.Name)
+
+		for _, dependency := range serverConfig.DependsOn {
+			dependencyConfig, ok := local[dependency.Name]
+			if !ok {
+				log.WithFields(log.Fields{"name": serverConfig.Name, "dependency": dependency.Name}).Debug("Ignoring dependency not running on this node")
+
+				continue
+			}
+
+			if _error := visit(dependencyConfig); _error != nil {
+				return _error
+			}
+		}
+
+		path = path[:len(path)-1]
+		states[serverConfig.Name] = visited
+		result = append(result, serverConfig)
+
+		return nil
+	}
+
+	for _, serverConfig := range serverConfigs {
+		if _error := visit(serverConfig); _error != nil {
+			return nil, _error
+		}
+	}
+
+	return result, nil
+}
+
+// waitDependencies delays starting the server until its dependencies reached their conditions. A dependency that does
+// not become ready in time does not block the server.
+func (servers *Servers) waitDependencies(server Server) {
+	servers.mutex.Lock()
+	serverConfig := servers.serverConfigs[server.Name()]
+	servers.mutex.Unlock()
+
+	for _, dependency := range serverConfig.DependsOn {
+		dependencyServer := servers.findServer(dependency.Name)
+		if dependencyServer == nil {
+			continue
+		}
+
+		if dependency.GetCondition() != utils.DependencyConditionReady {
+			continue
+		}
+
+		log.WithFields(log.Fields{"name": server.Name(), "dependency": dependency.Name}).Info("Waiting for dependency")
+
+		servers.waitReady(dependencyServer)
+	}
+}
@@ -0,0 +1,324 @@
+package servers
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/journal"
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const backupTimeFormat = "20060102-150405.000"
+
+// rotatingWriter appends to a log file and rotates it once it exceeds the maximum size or age. Rotated files are
+// optionally compressed and removed once there are too many of them or they exceed the retention time.
+type rotatingWriter struct {
+	mutex          sync.Mutex
+	filename       string
+	maximumSize    int64
+	maximumAge     time.Duration
+	maximumBackups int
+	retention      time.Duration
+	compress       bool
+	file           *os.File
+	size           int64
+	opened         time.Time
+	closed         bool
+	compressions   sync.WaitGroup
+	maintenance    sync.Mutex
+}
+
+func newRotatingWriter(logger config.LoggerConfig) (*rotatingWriter, error) {
+	writer := &rotatingWriter{filename: logger.Filename, maximumSize: int64(logger.GetMaximumSize()) * 1024 * 1024, maximumAge: time.Duration(logger.GetMaximumAge()) * time.Hour, maximumBackups: int(logger.GetMaximumBackups()), retention: time.Duration(logger.GetRetention()) * 24 * time.Hour, compress: logger.Compress}
+
+	if _error := writer.open(); _error != nil {
+		return nil, _error
+	}
+
+	return writer, nil
+}
+
+func (writer *rotatingWriter) open() error {
+	file, _error := os.OpenFile(writer.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if _error != nil {
+		return errors.Wrapf(_error, "Could not open log file '%s'", writer.filename)
+	}
+
+	info, _error := file.Stat()
+	if _error != nil {
+		file.Close()
+
+		return errors.Wrapf(_error, "Could not stat log file '%s'", writer.filename)
+	}
+
+	writer.file = file
+	writer.size = info.Size()
+	writer.opened = writer.createdAt(info)
+
+	return nil
+}
+
+// createdAt determines when the current log file was started so that reopening it does not restart its age
+func (writer *rotatingWriter) createdAt(info os.FileInfo) time.Time {
+	if info.Size() == 0 {
+		return time.Now()
+	}
+
+	var statx unix.Statx_t
+
+	if _error := unix.Statx(unix.AT_FDCWD, writer.filename, 0, unix.STATX_BTIME, &statx); _error == nil && statx.Mask&unix.STATX_BTIME != 0 {
+		return time.Unix(statx.Btime.Sec, int64(statx.Btime.Nsec))
+	}
+
+	// Without a birth time the file was started when the newest backup was rotated
+	backups, _ := filepath.Glob(writer.filename + ".*")
+
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for _, backup := range backups {
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(backup, writer.filename+"."), ".gz")
+
+		if rotated, _error := time.ParseInLocation(backupTimeFormat, timestamp, time.Local); _error == nil {
+			return rotated
+		}
+	}
+
+	return info.ModTime()
+}
+
+func (writer *rotatingWriter) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return len(data), nil
+	}
+
+	// Output is dropped rather than failing the process while the log file can not be opened
+	if writer.file == nil {
+		if _error := writer.open(); _error != nil {
+			log.WithFields(log.Fields{"filename": writer.filename, "error": _error}).Debug("Dropping log output")
+
+			return len(data), nil
+		}
+	}
+
+	if writer.size > 0 && (writer.size+int64(len(data)) > writer.maximumSize || time.Since(writer.opened) > writer.maximumAge) {
+		if _error := writer.rotate(); _error != nil {
+			log.WithFields(log.Fields{"filename": writer.filename, "error": _error}).Error("Log rotation failed")
+		}
+	}
+
+	if writer.file == nil {
+		return len(data), nil
+	}
+
+	count, _error := writer.file.Write(data)
+
+	writer.size += int64(count)
+
+	if _error != nil {
+		log.WithFields(log.Fields{"filename": writer.filename, "error": _error}).Debug("Dropping log output")
+	}
+
+	return len(data), nil
+}
+
+// rotate renames the current file, opens a new one and removes the obsolete backups
+func (writer *rotatingWriter) rotate() error {
+	if _error := writer.file.Close(); _error != nil {
+		writer.file = nil
+
+		return _error
+	}
+
+	backup := fmt.Sprintf("%s.%s", writer.filename, time.Now().Format(backupTimeFormat))
+
+	if _error := os.Rename(writer.filename, backup); _error != nil {
+		// Keep on writing to the old file
+		writer.file = nil
+
+		_ = writer.open()
+
+		return errors.Wrapf(_error, "Could not rename log file '%s'", writer.filename)
+	}
+
+	writer.file = nil
+
+	if _error := writer.open(); _error != nil {
+		return _error
+	}
+
+	writer.compressions.Add(1)
+
+	go func() {
+		defer writer.compressions.Done()
+
+		// Backups are processed one after the other
+		writer.maintenance.Lock()
+		defer writer.maintenance.Unlock()
+
+		if writer.compress {
+			if _error := compressFile(backup); _error != nil {
+				log.WithFields(log.Fields{"filename": backup, "error": _error}).Error("Log compression failed")
+			}
+		}
+
+		writer.removeBackups()
+	}()
+
+	return nil
+}
+
+func compressFile(filename string) error {
+	source, _error := os.Open(filename)
+	if os.IsNotExist(_error) {
+		// Already removed due to the retention
+		return nil
+	}
+
+	if _error != nil {
+		return _error
+	}
+
+	defer source.Close()
+
+	target, _error := os.OpenFile(filename+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if _error != nil {
+		return _error
+	}
+
+	gzipWriter := gzip.NewWriter(target)
+
+	_, _error = io.Copy(gzipWriter, source)
+
+	if closeError := gzipWriter.Close(); _error == nil {
+		_error = closeError
+	}
+
+	if closeError := target.Close(); _error == nil {
+		_error = closeError
+	}
+
+	if _error != nil {
+		os.Remove(filename + ".gz")
+
+		return _error
+	}
+
+	return os.Remove(filename)
+}
+
+// removeBackups removes the oldest backups beyond the maximum count and all backups older than the retention time
+func (writer *rotatingWriter) removeBackups() {
+	backups, _error := filepath.Glob(writer.filename + ".*")
+	if _error != nil {
+		return
+	}
+
+	// The timestamps in the names sort the backups from the newest to the oldest
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for index, backup := range backups {
+		info, _error := os.Stat(backup)
+		if _error != nil {
+			continue
+		}
+
+		if index < writer.maximumBackups && time.Since(info.ModTime()) < writer.retention {
+			continue
+		}
+
+		if _error := os.Remove(backup); _error != nil {
+			log.WithFields(log.Fields{"filename": backup, "error": _error}).Error("Could not remove log file")
+
+			continue
+		}
+
+		log.WithFields(log.Fields{"filename": backup}).Debug("Removed log file")
+	}
+}
+
+func (writer *rotatingWriter) Close() error {
+	writer.mutex.Lock()
+
+	var _error error
+
+	if writer.file != nil {
+		_error = writer.file.Close()
+		writer.file = nil
+	}
+
+	writer.closed = true
+
+	writer.mutex.Unlock()
+
+	writer.compressions.Wait()
+
+	return _error
+}
+
+// journaldWriter forwards each line to journald using the server name as syslog identifier
+type journaldWriter struct {
+	name  string
+	mutex sync.Mutex
+	line  []byte
+}
+
+func newJournaldWriter(name string) (*journaldWriter, error) {
+	if !journal.Enabled() {
+		return nil, errors.New("journald is not available")
+	}
+
+	return &journaldWriter{name: name}, nil
+}
+
+func (writer *journaldWriter) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	for _, value := range data {
+		if value != '\n' {
+			if len(writer.line) < maximumLineLength {
+				writer.line = append(writer.line, value)
+			}
+
+			continue
+		}
+
+		writer.send()
+	}
+
+	return len(data), nil
+}
+
+func (writer *journaldWriter) send() {
+	if len(writer.line) == 0 {
+		return
+	}
+
+	if _error := journal.Send(string(writer.line), journal.PriInfo, map[string]string{"SYSLOG_IDENTIFIER": writer.name}); _error != nil {
+		log.WithFields(log.Fields{"name": writer.name, "error": _error}).Debug("Could not send to journald")
+	}
+
+	writer.line = writer.line[:0]
+}
+
+func (writer *journaldWriter) Close() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.send()
+
+	return nil
+}
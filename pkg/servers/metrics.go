@@ -0,0 +1,181 @@
+package servers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/container"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+const metricsNamespace = "k8s_tew"
+
+var serverStates = []string{utils.ServerStateStarting, utils.ServerStateRunning, utils.ServerStateBackoff, utils.ServerStateCrashLoop, utils.ServerStateExited, utils.ServerStateFailed, utils.ServerStateStopped}
+
+// Metrics exposes the state of the servers, the commands, the restored pods and the imported images to Prometheus
+type Metrics struct {
+	servers             *Servers
+	address             string
+	registry            *prometheus.Registry
+	commandSuccess      *prometheus.GaugeVec
+	commandDuration     *prometheus.GaugeVec
+	podRestores         *prometheus.GaugeVec
+	imageImported       *prometheus.GaugeVec
+	imageImportDuration *prometheus.GaugeVec
+	imageImportFailures *prometheus.CounterVec
+	httpServer          *http.Server
+
+	serverUp        *prometheus.Desc
+	serverReady     *prometheus.Desc
+	serverState     *prometheus.Desc
+	serverRestarts  *prometheus.Desc
+	serverUptime    *prometheus.Desc
+	commandsTotal   *prometheus.Desc
+	commandsDone    *prometheus.Desc
+	commandsSuccess *prometheus.Desc
+}
+
+func NewMetrics(servers *Servers, ip string, port uint16) *Metrics {
+	serverLabels := []string{"node", "server"}
+	nodeLabels := []string{"node"}
+	constLabels := prometheus.Labels{"node": servers.getConfig().Name}
+
+	metrics := &Metrics{
+		servers:  servers,
+		address:  net.JoinHostPort(ip, strconv.Itoa(int(port))),
+		registry: prometheus.NewRegistry(),
+
+		commandSuccess:      prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: metricsNamespace, Name: "command_success", Help: "Whether the last execution of the command succeeded", ConstLabels: constLabels}, []string{"command"}),
+		commandDuration:     prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: metricsNamespace, Name: "command_duration_seconds", Help: "Duration of the last execution of the command including retries", ConstLabels: constLabels}, []string{"command"}),
+		podRestores:         prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: metricsNamespace, Name: "pod_restores", Help: "Pods and containers restored on start", ConstLabels: constLabels}, []string{"kind", "result"}),
+		imageImported:       prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: metricsNamespace, Name: "image_imported", Help: "Whether the image was imported", ConstLabels: constLabels}, []string{"image"}),
+		imageImportDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: metricsNamespace, Name: "image_import_duration_seconds", Help: "Duration of the image import including retries", ConstLabels: constLabels}, []string{"image"}),
+		imageImportFailures: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: metricsNamespace, Name: "image_import_failures_total", Help: "Failed attempts to import the image", ConstLabels: constLabels}, []string{"image"}),
+
+		serverUp:        prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "server", "up"), "Whether the server is running", serverLabels, nil),
+		serverReady:     prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "server", "ready"), "Whether the server is ready", serverLabels, nil),
+		serverState:     prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "server", "state"), "The current state of the server", append(serverLabels, "state"), nil),
+		serverRestarts:  prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "server", "restarts_total"), "Restarts of the server", serverLabels, nil),
+		serverUptime:    prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "server", "uptime_seconds"), "Seconds since the server was started", serverLabels, nil),
+		commandsTotal:   prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "commands", "total"), "Count of commands", nodeLabels, nil),
+		commandsDone:    prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "commands", "completed"), "Count of completed commands", nodeLabels, nil),
+		commandsSuccess: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "commands", "success"), "Whether the commands finished without errors", nodeLabels, nil),
+	}
+
+	metrics.registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	metrics.registry.MustRegister(metrics.commandSuccess, metrics.commandDuration, metrics.podRestores, metrics.imageImported, metrics.imageImportDuration, metrics.imageImportFailures)
+	metrics.registry.MustRegister(metrics)
+
+	return metrics
+}
+
+// Describe implements prometheus.Collector for the metrics derived from the status of the servers
+func (metrics *Metrics) Describe(descriptions chan<- *prometheus.Desc) {
+	descriptions <- metrics.serverUp
+	descriptions <- metrics.serverReady
+	descriptions <- metrics.serverState
+	descriptions <- metrics.serverRestarts
+	descriptions <- metrics.serverUptime
+	descriptions <- metrics.commandsTotal
+	descriptions <- metrics.commandsDone
+	descriptions <- metrics.commandsSuccess
+}
+
+// Collect implements prometheus.Collector and reads the status of the servers at scrape time
+func (metrics *Metrics) Collect(values chan<- prometheus.Metric) {
+	status := metrics.servers.Status()
+
+	toFloat := func(value bool) float64 {
+		if value {
+			return 1
+		}
+
+		return 0
+	}
+
+	for _, server := range status.Servers {
+		values <- prometheus.MustNewConstMetric(metrics.serverUp, prometheus.GaugeValue, toFloat(server.State == utils.ServerStateRunning), status.Node, server.Name)
+		values <- prometheus.MustNewConstMetric(metrics.serverReady, prometheus.GaugeValue, toFloat(server.Ready), status.Node, server.Name)
+		values <- prometheus.MustNewConstMetric(metrics.serverRestarts, prometheus.CounterValue, float64(server.Restarts), status.Node, server.Name)
+		values <- prometheus.MustNewConstMetric(metrics.serverUptime, prometheus.GaugeValue, server.Uptime, status.Node, server.Name)
+
+		for _, state := range serverStates {
+			values <- prometheus.MustNewConstMetric(metrics.serverState, prometheus.GaugeValue, toFloat(server.State == state), status.Node, server.Name, state)
+		}
+	}
+
+	values <- prometheus.MustNewConstMetric(metrics.commandsTotal, prometheus.GaugeValue, float64(status.Commands.Total), status.Node)
+	values <- prometheus.MustNewConstMetric(metrics.commandsDone, prometheus.GaugeValue, float64(status.Commands.Completed), status.Node)
+	values <- prometheus.MustNewConstMetric(metrics.commandsSuccess, prometheus.GaugeValue, toFloat(len(status.Commands.Error) == 0), status.Node)
+}
+
+// Start serves the metrics on the IP of the node, which Prometheus scrapes from within the cluster
+func (metrics *Metrics) Start() error {
+	listener, _error := net.Listen("tcp", metrics.address)
+	if _error != nil {
+		return errors.Wrapf(_error, "Could not listen on '%s'", metrics.address)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{}))
+
+	metrics.httpServer = &http.Server{Handler: mux, ReadHeaderTimeout: utils.APITimeout * time.Second}
+
+	go func() {
+		if _error := metrics.httpServer.Serve(listener); _error != nil && _error != http.ErrServerClosed {
+			log.WithFields(log.Fields{"error": _error}).Error("Metrics failed")
+		}
+	}()
+
+	log.WithFields(log.Fields{"address": metrics.address}).Info("Metrics started")
+
+	return nil
+}
+
+func (metrics *Metrics) Stop() {
+	if metrics.httpServer == nil {
+		return
+	}
+
+	_ = metrics.httpServer.Shutdown(context.Background())
+}
+
+func (metrics *Metrics) SetCommandResult(name string, start time.Time, _error error) {
+	success := 1.0
+
+	if _error != nil {
+		success = 0
+	}
+
+	metrics.commandSuccess.WithLabelValues(name).Set(success)
+	metrics.commandDuration.WithLabelValues(name).Set(time.Since(start).Seconds())
+}
+
+func (metrics *Metrics) SetRestoreResult(result container.RestoreResult) {
+	metrics.podRestores.WithLabelValues("pod", "restored").Set(float64(result.PodsRestored))
+	metrics.podRestores.WithLabelValues("pod", "failed").Set(float64(result.PodsFailed))
+	metrics.podRestores.WithLabelValues("container", "restored").Set(float64(result.ContainersRestored))
+	metrics.podRestores.WithLabelValues("container", "failed").Set(float64(result.ContainersFailed))
+}
+
+func (metrics *Metrics) AddImage(name string) {
+	metrics.imageImported.WithLabelValues(name).Set(0)
+	metrics.imageImportFailures.WithLabelValues(name).Add(0)
+}
+
+func (metrics *Metrics) AddImageImportFailure(name string) {
+	metrics.imageImportFailures.WithLabelValues(name).Inc()
+}
+
+func (metrics *Metrics) SetImageImported(name string, start time.Time) {
+	metrics.imageImported.WithLabelValues(name).Set(1)
+	metrics.imageImportDuration.WithLabelValues(name).Set(time.Since(start).Seconds())
+}
@@ -0,0 +1,182 @@
+package servers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Probe checks the health of a server
+type Probe struct {
+	config *config.ProbeConfig
+	target string
+}
+
+// NewProbe returns a probe for the target, which is the config's target with the templates applied
+func NewProbe(probeConfig *config.ProbeConfig, target string) (*Probe, error) {
+	if _error := probeConfig.Validate(); _error != nil {
+		return nil, _error
+	}
+
+	return &Probe{config: probeConfig, target: target}, nil
+}
+
+// Check runs the probe once
+func (probe *Probe) Check(_context context.Context) error {
+	_context, cancel := context.WithTimeout(_context, time.Duration(probe.config.GetTimeout())*time.Second)
+	defer cancel()
+
+	switch probe.config.Type {
+	case utils.ProbeTypeHTTP, utils.ProbeTypeHTTPS:
+		return probe.checkHTTP(_context)
+
+	case utils.ProbeTypeGRPC:
+		return probe.checkGRPC(_context)
+
+	case utils.ProbeTypeUnix:
+		return probe.checkUnix(_context)
+
+	case utils.ProbeTypeExec:
+		return probe.checkExec(_context)
+	}
+
+	return fmt.Errorf("Unknown probe type '%s'", probe.config.Type)
+}
+
+func (probe *Probe) checkHTTP(_context context.Context) error {
+	request, _error := http.NewRequestWithContext(_context, http.MethodGet, probe.target, nil)
+	if _error != nil {
+		return _error
+	}
+
+	// The health endpoints of the servers use self-signed certificates
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+	response, _error := client.Do(request)
+	if _error != nil {
+		return _error
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("Unexpected status code %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+func (probe *Probe) checkGRPC(_context context.Context) error {
+	connection, _error := grpc.DialContext(_context, probe.target, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	if _error != nil {
+		return errors.Wrapf(_error, "Could not connect to '%s'", probe.target)
+	}
+
+	defer connection.Close()
+
+	response, _error := grpc_health_v1.NewHealthClient(connection).Check(_context, &grpc_health_v1.HealthCheckRequest{})
+	if _error != nil {
+		return _error
+	}
+
+	if response.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return fmt.Errorf("Unexpected status %s", response.Status)
+	}
+
+	return nil
+}
+
+func (probe *Probe) checkUnix(_context context.Context) error {
+	var dialer net.Dialer
+
+	connection, _error := dialer.DialContext(_context, "unix", probe.target)
+	if _error != nil {
+		return _error
+	}
+
+	return connection.Close()
+}
+
+func (probe *Probe) checkExec(_context context.Context) error {
+	var output bytes.Buffer
+
+	command := exec.CommandContext(_context, "sh", "-c", probe.target)
+	command.Stdout = &output
+	command.Stderr = &output
+
+	if _error := command.Run(); _error != nil && output.Len() > 0 {
+		return errors.Wrapf(_error, "%s", bytes.TrimSpace(output.Bytes()))
+
+	} else if _error != nil {
+		return _error
+	}
+
+	return nil
+}
+
+// Run probes periodically until the context is done and reports each change of the result. The result changes after
+// the configured number of consecutive failures or successes.
+func (probe *Probe) Run(_context context.Context, changed func(healthy bool, _error error)) {
+	select {
+	case <-_context.Done():
+		return
+	case <-time.After(time.Duration(probe.config.InitialDelay) * time.Second):
+	}
+
+	ticker := time.NewTicker(time.Duration(probe.config.GetPeriod()) * time.Second)
+	defer ticker.Stop()
+
+	healthy := false
+	initial := true
+	failures := uint(0)
+	successes := uint(0)
+
+	for {
+		_error := probe.Check(_context)
+
+		if _context.Err() != nil {
+			return
+		}
+
+		if _error == nil {
+			failures = 0
+			successes++
+
+			if (!healthy || initial) && successes >= probe.config.GetSuccessThreshold() {
+				healthy = true
+				initial = false
+
+				changed(true, nil)
+			}
+
+		} else {
+			successes = 0
+			failures++
+
+			if (healthy || initial) && failures >= probe.config.GetFailureThreshold() {
+				healthy = false
+				initial = false
+
+				changed(false, _error)
+			}
+		}
+
+		select {
+		case <-_context.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package servers
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+// supervise reloads the config on SIGHUP or when the config file changes and returns on SIGINT or SIGTERM
+func (servers *Servers) supervise(commandRetries uint) {
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	filename := servers.getConfig().GetFullLocalAssetFilename(utils.ConfigFilename)
+
+	checksum, error := utils.SHA256(filename)
+	if error != nil {
+		log.WithFields(log.Fields{"filename": filename, "error": error}).Warn("Could not compute checksum of config")
+	}
+
+	ticker := time.NewTicker(utils.ConfigWatchInterval * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case _signal := <-signals:
+			if _signal != syscall.SIGHUP {
+				servers.terminate()
+
+				return
+			}
+
+			log.Info("Reload requested")
+
+		case <-ticker.C:
+			newChecksum, error := utils.SHA256(filename)
+			if error != nil || newChecksum == checksum {
+				continue
+			}
+
+			log.WithFields(log.Fields{"filename": filename}).Info("Config changed")
+		}
+
+		// The checksum is updated even if the reload fails, so that a broken config is not reloaded over and over again
+		checksum, _ = utils.SHA256(filename)
+
+		if error := servers.reload(commandRetries); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Reload failed")
+		}
+	}
+}
+
+// loadConfig reads the config file again for the same node
+func (servers *Servers) loadConfig() (*config.InternalConfig, error) {
+	currentConfig := servers.getConfig()
+
+	newConfig := config.NewInternalConfig(currentConfig.BaseDirectory)
+	newConfig.Name = currentConfig.Name
+
+	if error := newConfig.Load(); error != nil {
+		return nil, error
+	}
+
+	if newConfig.Node == nil {
+		return nil, fmt.Errorf("Node '%s' not found in the config", newConfig.Name)
+	}
+
+	return newConfig, nil
+}
+
+// reload applies the changes of the config file. Only the servers whose rendered settings changed are restarted, new servers
+// are started and removed servers are stopped, both in the order of their dependencies. Commands that were not part of the previous config are executed.
+func (servers *Servers) reload(commandRetries uint) error {
+	// The API must not start or stop servers while they are replaced
+	servers.lifecycle.Lock()
+	defer servers.lifecycle.Unlock()
+
+	newConfig, error := servers.loadConfig()
+	if error != nil {
+		return error
+	}
+
+	currentConfig := servers.getConfig()
+
+	current := map[string]Server{}
+
+	for _, server := range servers.getServers() {
+		current[server.Name()] = server
+	}
+
+	serverConfigs, error := getServerConfigs(newConfig)
+	if error != nil {
+		return error
+	}
+
+	newServers := []Server{}
+	newServerConfigs := map[string]config.ServerConfig{}
+	started := []Server{}
+	stopped := map[string]bool{}
+
+	// All servers are created before anything is stopped, so that an invalid config changes nothing
+	for _, serverConfig := range serverConfigs {
+		newServerConfigs[serverConfig.Name] = serverConfig
+
+		server, exists := current[serverConfig.Name]
+
+		newServer, error := servers.newServer(newConfig, serverConfig)
+		if error != nil {
+			return error
+		}
+
+		// The rendered settings are compared, because the templates might yield other values for the same config
+		if exists && sameServer(server, newServer) {
+			newServers = append(newServers, server)
+
+			continue
+		}
+
+		if exists {
+			log.WithFields(log.Fields{"name": serverConfig.Name}).Info("Server changed")
+
+			stopped[serverConfig.Name] = true
+
+		} else {
+			log.WithFields(log.Fields{"name": serverConfig.Name}).Info("Server added")
+		}
+
+		newServers = append(newServers, newServer)
+		started = append(started, newServer)
+	}
+
+	for name := range current {
+		if _, ok := newServerConfigs[name]; ok {
+			continue
+		}
+
+		log.WithFields(log.Fields{"name": name}).Info("Server removed")
+
+		stopped[name] = true
+	}
+
+	newCommands := config.Commands{}
+
+	for _, command := range newConfig.Config.Commands {
+		if !containsCommand(currentConfig.Config.Commands, command) {
+			newCommands = append(newCommands, command)
+		}
+	}
+
+	// Dependent servers are stopped first
+	currentServers := servers.getServers()
+
+	for index := len(currentServers) - 1; index >= 0; index-- {
+		if stopped[currentServers[index].Name()] {
+			currentServers[index].Stop()
+		}
+	}
+
+	servers.mutex.Lock()
+	servers.config = newConfig
+	servers.servers = newServers
+	servers.serverConfigs = newServerConfigs
+	servers.mutex.Unlock()
+
+	// The servers are started in the order of their dependencies
+	for _, server := range started {
+		servers.waitDependencies(server)
+
+		if error := server.Start(); error != nil {
+			log.WithFields(log.Fields{"name": server.Name(), "error": error}).Error("Could not start server")
+
+			continue
+		}
+
+		// Like on startup, the pods are restored once the new containerd is ready
+		if server.Name() == utils.ContainerdServerName {
+			servers.waitReady(server)
+
+			servers.restorePods()
+		}
+	}
+
+	log.WithFields(log.Fields{"started": len(started), "stopped": len(stopped), "commands": len(newCommands)}).Info("Reloaded config")
+
+	if len(newCommands) > 0 {
+		go servers.runCommands(newConfig, newCommands, commandRetries)
+	}
+
+	return nil
+}
+
+// containsCommand returns true if the commands contain an identical command
+func containsCommand(commands config.Commands, command *config.Command) bool {
+	for _, _command := range commands {
+		if reflect.DeepEqual(_command, command) {
+			return true
+		}
+	}
+
+	return false
+}
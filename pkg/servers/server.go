@@ -1,7 +1,26 @@
 package servers
 
+import "time"
+
+type ServerStatus struct {
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	Ready    bool      `json:"ready"`
+	PID      int       `json:"pid,omitempty"`
+	Restarts uint      `json:"restarts"`
+	LastExit string    `json:"last-exit,omitempty"`
+	ExitCode int       `json:"exit-code"`
+	Since    time.Time `json:"since"`
+	Uptime   float64   `json:"uptime"`
+	LogFile  string    `json:"log-file,omitempty"`
+}
+
 type Server interface {
 	Start() error
 	Stop()
+	StopWithin(timeout time.Duration)
+	GracePeriod() time.Duration
 	Name() string
+	Status() ServerStatus
+	WaitReady(timeout time.Duration) error
 }
@@ -3,13 +3,18 @@ package servers
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/darxkies/k8s-tew/pkg/config"
@@ -28,6 +33,26 @@ type ServerWrapper struct {
 	context         context.Context
 	cancel          context.CancelFunc
 	done            chan bool
+	restart         *config.RestartConfig
+	restartTimes    []time.Time
+	tail            *tailBuffer
+	output          io.WriteCloser
+	mutex           sync.Mutex
+	lifecycle       sync.Mutex
+	state           string
+	pid             int
+	restarts        uint
+	crashLooping    bool
+	lastExit        string
+	exitCode        int
+	since           time.Time
+	liveness        *Probe
+	readiness       *Probe
+	ready           bool
+	resources       *config.ResourcesConfig
+	cgroup          *cgroup
+	stopConfig      *config.StopConfig
+	stopTimeout     time.Duration
 }
 
 func NewServerWrapper(_config config.InternalConfig, name string, serverConfig config.ServerConfig, pathEnvironment string) (Server, error) {
@@ -39,14 +64,53 @@ func NewServerWrapper(_config config.InternalConfig, name string, serverConfig c
 		return nil, error
 	}
 
-	server := &ServerWrapper{name: name, baseDirectory: _config.BaseDirectory, command: []string{serverConfig.Command}, logger: serverConfig.Logger, pathEnvironment: pathEnvironment, environment: serverConfig.Environment}
+	if error := serverConfig.Restart.Validate(); error != nil {
+		return nil, error
+	}
+
+	if error := serverConfig.Stop.Validate(); error != nil {
+		return nil, errors.Wrapf(error, "Invalid stop settings of '%s'", name)
+	}
+
+	if error := serverConfig.Resources.Validate(); error != nil {
+		return nil, errors.Wrapf(error, "Invalid resources of '%s'", name)
+	}
+
+	server := &ServerWrapper{name: name, baseDirectory: _config.BaseDirectory, command: []string{serverConfig.Command}, logger: serverConfig.Logger, pathEnvironment: pathEnvironment, environment: serverConfig.Environment, restart: serverConfig.Restart, resources: serverConfig.Resources, stopConfig: serverConfig.Stop, tail: newTailBuffer(utils.CrashLoopLogLines), state: utils.ServerStateStopped, since: time.Now()}
 
 	server.logger.Filename, error = _config.ApplyTemplate("LoggingDirectory", server.logger.Filename)
 	if error != nil {
 		return nil, error
 	}
 
-	for key, value := range serverConfig.Arguments {
+	if serverConfig.Resources.HasLimits() {
+		server.cgroup = newCgroup(name, serverConfig.Resources)
+	}
+
+	if serverConfig.Liveness != nil {
+		if server.liveness, error = newServerProbe(_config, fmt.Sprintf("%s.liveness", name), serverConfig.Liveness); error != nil {
+			return nil, error
+		}
+	}
+
+	if serverConfig.Readiness != nil {
+		if server.readiness, error = newServerProbe(_config, fmt.Sprintf("%s.readiness", name), serverConfig.Readiness); error != nil {
+			return nil, error
+		}
+	}
+
+	// The arguments are sorted, so that the same config always results in the same command
+	keys := []string{}
+
+	for key := range serverConfig.Arguments {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := serverConfig.Arguments[key]
+
 		if len(value) == 0 {
 			server.command = append(server.command, fmt.Sprintf("--%s", key))
 
@@ -63,95 +127,562 @@ func NewServerWrapper(_config config.InternalConfig, name string, serverConfig c
 	return server, nil
 }
 
-func (server *ServerWrapper) Start() error {
-	if server.started {
-		return nil
+// serverSpec contains the settings of a server, with the templates applied, that require a restart when they change
+type serverSpec struct {
+	command         []string
+	environment     map[string]string
+	pathEnvironment string
+	logger          config.LoggerConfig
+	liveness        *Probe
+	readiness       *Probe
+	restart         *config.RestartConfig
+	resources       *config.ResourcesConfig
+	stop            *config.StopConfig
+}
+
+func (server *ServerWrapper) spec() serverSpec {
+	return serverSpec{command: server.command, environment: server.environment, pathEnvironment: server.pathEnvironment, logger: server.logger, liveness: server.liveness, readiness: server.readiness, restart: server.restart, resources: server.resources, stop: server.stopConfig}
+}
+
+// sameServer returns true if both servers run the same command with the same settings
+func sameServer(current, replacement Server) bool {
+	currentWrapper, ok := current.(*ServerWrapper)
+	if !ok {
+		return false
 	}
 
-	server.stop = false
+	newWrapper, ok := replacement.(*ServerWrapper)
+	if !ok {
+		return false
+	}
 
-	if server.logger.Enabled {
-		logsDirectory := filepath.Dir(server.logger.Filename)
+	return reflect.DeepEqual(currentWrapper.spec(), newWrapper.spec())
+}
 
-		if error := utils.CreateDirectoryIfMissing(logsDirectory); error != nil {
-			return error
-		}
+func newServerProbe(_config config.InternalConfig, label string, probeConfig *config.ProbeConfig) (*Probe, error) {
+	target, error := _config.ApplyTemplate(label, probeConfig.Target)
+	if error != nil {
+		return nil, error
+	}
+
+	return NewProbe(probeConfig, target)
+}
+
+// Start launches the server unless it is already started. Starting and stopping are serialized, because both are
+// triggered by the API as well as by the supervisor.
+func (server *ServerWrapper) Start() error {
+	server.lifecycle.Lock()
+	defer server.lifecycle.Unlock()
+
+	if server.started && !server.hasExited() {
+		return nil
+	}
+
+	output, error := server.openOutput()
+	if error != nil {
+		return error
 	}
 
+	server.mutex.Lock()
+	server.stop = false
+	server.output = output
+	server.mutex.Unlock()
+
 	log.WithFields(log.Fields{"name": server.Name(), "_command": strings.Join(server.command, " ")}).Info("Starting server")
 
 	server.context, server.cancel = context.WithCancel(context.Background())
 	server.done = make(chan bool, 1)
+	server.restartTimes = []time.Time{}
+	server.crashLooping = false
+	server.stopTimeout = server.GracePeriod()
 
 	server.started = true
 
+	server.setState(utils.ServerStateStarting, 0)
+
 	go func() {
-		for !server.stop {
-			command := exec.CommandContext(server.context, server.command[0], server.command[1:]...)
-			command.SysProcAttr = &syscall.SysProcAttr{
-				Setpgid: true,
-				Pgid:    0,
+		defer close(server.done)
+
+		if server.output != nil {
+			defer server.output.Close()
+		}
+
+		for !server.isStopping() {
+			error := server.run()
+
+			if server.isStopping() {
+				break
 			}
 
-			command.Env = os.Environ()
-			command.Env = append(command.Env, server.pathEnvironment)
+			delay, restart := server.getRestartDelay(error)
+			if !restart {
+				break
+			}
 
-			for key, value := range server.environment {
-				command.Env = append(command.Env, fmt.Sprintf("%s=%s", key, value))
+			select {
+			case <-server.context.Done():
+			case <-time.After(delay):
 			}
+		}
 
-			log.WithFields(log.Fields{"name": server.Name(), "environment": strings.Join(command.Env, " ")}).Debug("Server environment")
+		if server.isStopping() {
+			server.setState(utils.ServerStateStopped, 0)
+		}
+	}()
 
-			var logFile *os.File
-			var error error
+	return nil
+}
 
-			if server.logger.Enabled {
-				logFile, error = os.OpenFile(server.logger.Filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+// hasExited returns true if the supervising goroutine gave up, because the restart policy did not restart the process
+func (server *ServerWrapper) hasExited() bool {
+	select {
+	case <-server.done:
+		return true
 
-				if error != nil {
-					log.WithFields(log.Fields{"filename": logFile, "error": error}).Error("Could not open file")
+	default:
+		return false
+	}
+}
+
+func (server *ServerWrapper) isStopping() bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.stop
+}
+
+// openOutput returns the writer the output of the process is forwarded to or nil if logging is disabled
+func (server *ServerWrapper) openOutput() (io.WriteCloser, error) {
+	if !server.logger.Enabled {
+		return nil, nil
+	}
+
+	if server.logger.Journald {
+		writer, error := newJournaldWriter(server.name)
+		if error == nil {
+			return writer, nil
+		}
+
+		log.WithFields(log.Fields{"name": server.name, "error": error}).Warn("Logging to file instead of journald")
+	}
+
+	if error := utils.CreateDirectoryIfMissing(filepath.Dir(server.logger.Filename)); error != nil {
+		return nil, error
+	}
+
+	return newRotatingWriter(server.logger)
+}
+
+// run executes the command once and waits for it to exit
+func (server *ServerWrapper) run() error {
+	server.setState(utils.ServerStateStarting, 0)
+
+	// The context of this process is canceled by a failing liveness probe or by stopping the server
+	runContext, runCancel := context.WithCancel(server.context)
+	defer runCancel()
+
+	limited := server.createCgroup()
+
+	command, limited, startError := server.startCommand(limited)
+	if startError != nil {
+		return startError
+	}
+
+	server.limit(command.Process.Pid, limited)
+
+	server.setState(utils.ServerStateRunning, command.Process.Pid)
 
-					continue
-				}
+	exited := make(chan struct{})
 
-				command.Stdout = logFile
-				command.Stderr = logFile
+	go func() {
+		select {
+		case <-exited:
+		case <-runContext.Done():
+			server.terminate(command.Process.Pid, exited)
+		}
+	}()
+
+	livenessFailure := make(chan error, 1)
+
+	if server.liveness != nil {
+		go server.liveness.Run(runContext, func(healthy bool, error error) {
+			if healthy {
+				log.WithFields(log.Fields{"name": server.name}).Debug("Liveness probe succeeded")
+
+				return
 			}
 
-			defer func() {
-				if logFile != nil {
-					logFile.Close()
-				}
-			}()
+			log.WithFields(log.Fields{"name": server.name, "error": error}).Error("Liveness probe failed")
 
-			error = command.Run()
+			livenessFailure <- error
 
-			if !server.stop {
-				time.Sleep(time.Second)
+			runCancel()
+		})
+	}
 
-				log.WithFields(log.Fields{"name": server.name, "error": error, "_command": strings.Join(server.command, " ")}).Error("Restarting server")
+	if server.readiness != nil {
+		go server.readiness.Run(runContext, func(healthy bool, error error) {
+			if healthy {
+				log.WithFields(log.Fields{"name": server.name}).Info("Server ready")
+
+			} else {
+				log.WithFields(log.Fields{"name": server.name, "error": error}).Error("Readiness probe failed")
 			}
+
+			server.setReady(healthy)
+		})
+	}
+
+	error := command.Wait()
+
+	close(exited)
+
+	runCancel()
+
+	if limited {
+		server.cgroup.remove()
+	}
+
+	server.setReady(false)
+
+	select {
+	case probeError := <-livenessFailure:
+		return fmt.Errorf("Liveness probe failed (%s)", probeError)
+
+	default:
+		return error
+	}
+}
+
+// createCgroup prepares the cgroup of the server, if it has resource limits. If that is not possible, the server runs
+// without limits.
+func (server *ServerWrapper) createCgroup() bool {
+	if server.cgroup == nil {
+		return false
+	}
+
+	if error := server.cgroup.create(); error != nil {
+		log.WithFields(log.Fields{"name": server.name, "error": error}).Warn("Running server without resource limits")
+
+		return false
+	}
+
+	return true
+}
+
+// newCommand prepares the process of the server
+func (server *ServerWrapper) newCommand() *exec.Cmd {
+	command := exec.Command(server.command[0], server.command[1:]...)
+	command.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+		Pgid:    0,
+	}
+
+	command.Env = os.Environ()
+	command.Env = append(command.Env, server.pathEnvironment)
+
+	for key, value := range server.environment {
+		command.Env = append(command.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	log.WithFields(log.Fields{"name": server.Name(), "environment": strings.Join(command.Env, " ")}).Debug("Server environment")
+
+	var output io.Writer = server.tail
+
+	if server.output != nil {
+		output = io.MultiWriter(server.output, server.tail)
+	}
+
+	command.Stdout = output
+	command.Stderr = output
+
+	return command
+}
+
+// startCommand starts the process of the server. With resource limits, the process is created inside the cgroup of
+// the server, so that neither it nor the processes it forks run without the limits. If the kernel can not do that, the
+// server runs without limits.
+func (server *ServerWrapper) startCommand(limited bool) (*exec.Cmd, bool, error) {
+	command := server.newCommand()
+
+	if !limited {
+		return command, false, command.Start()
+	}
+
+	file, error := server.cgroup.open()
+	if error == nil {
+		defer file.Close()
+
+		command.SysProcAttr.UseCgroupFD = true
+		command.SysProcAttr.CgroupFD = int(file.Fd())
+
+		if error = command.Start(); error == nil {
+			return command, true, nil
 		}
+	}
 
-		close(server.done)
-	}()
+	log.WithFields(log.Fields{"name": server.name, "error": error}).Warn("Running server without resource limits")
+
+	server.cgroup.remove()
+
+	command = server.newCommand()
+
+	return command, false, command.Start()
+}
+
+// limit adjusts the OOM score of the started process. Children forked afterwards inherit it.
+func (server *ServerWrapper) limit(pid int, limited bool) {
+	if error := setOOMScoreAdjust(pid, server.resources); error != nil {
+		log.WithFields(log.Fields{"name": server.name, "pid": pid, "error": error}).Warn("Could not limit resources of server")
+
+		return
+	}
+
+	if limited {
+		log.WithFields(log.Fields{"name": server.name, "pid": pid, "cgroup": server.cgroup.directory}).Debug("Limited resources of server")
+	}
+}
+
+// GracePeriod returns the time the server is given to exit after the stop signal
+func (server *ServerWrapper) GracePeriod() time.Duration {
+	return time.Duration(server.stopConfig.GetGracePeriod()) * time.Second
+}
+
+// terminate sends the stop signal to the process group of the server. If the process does not exit within the grace
+// period, the whole process group is killed.
+func (server *ServerWrapper) terminate(pid int, exited chan struct{}) {
+	server.mutex.Lock()
+	gracePeriod := server.stopTimeout
+	server.mutex.Unlock()
+
+	signal := server.stopConfig.GetSignalNumber()
+
+	log.WithFields(log.Fields{"name": server.name, "pid": pid, "signal": server.stopConfig.GetSignal(), "grace-period": gracePeriod}).Info("Terminating server")
+
+	if error := syscall.Kill(-pid, signal); error != nil {
+		log.WithFields(log.Fields{"name": server.name, "pid": pid, "error": error}).Debug("Could not signal server")
+	}
+
+	select {
+	case <-exited:
+		return
+
+	case <-time.After(gracePeriod):
+	}
+
+	log.WithFields(log.Fields{"name": server.name, "pid": pid, "grace-period": gracePeriod}).Warn("Killing server after grace period")
+
+	if error := syscall.Kill(-pid, syscall.SIGKILL); error != nil {
+		log.WithFields(log.Fields{"name": server.name, "pid": pid, "error": error}).Debug("Could not kill server")
+	}
+}
+
+func (server *ServerWrapper) setReady(ready bool) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.ready = ready
+}
+
+// isReady returns true if the readiness probe succeeded or, without a readiness probe, if the process is running
+func (server *ServerWrapper) isReady() bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.readiness == nil {
+		return server.state == utils.ServerStateRunning
+	}
+
+	return server.ready
+}
+
+// WaitReady waits until the server is ready, the server is stopped or the timeout expired
+func (server *ServerWrapper) WaitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for !server.isReady() {
+		if server.isStopping() {
+			return fmt.Errorf("Server '%s' stopped", server.name)
+		}
+
+		if status := server.Status(); status.State == utils.ServerStateExited || status.State == utils.ServerStateFailed || status.State == utils.ServerStateCrashLoop {
+			return fmt.Errorf("Server '%s' %s", server.name, status.State)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Server '%s' not ready after %s", server.name, timeout)
+		}
+
+		time.Sleep(250 * time.Millisecond)
+	}
 
 	return nil
 }
 
+// getRestartDelay applies the restart policy to the exited process. The delay doubles with every restart within the window
+// up to the maximum backoff. Too many restarts within the window are reported as crash loop.
+func (server *ServerWrapper) getRestartDelay(exitError error) (time.Duration, bool) {
+	policy := server.restart.GetPolicy()
+
+	server.mutex.Lock()
+	server.lastExit = "exit status 0"
+	server.exitCode = 0
+
+	if exitError != nil {
+		server.lastExit = exitError.Error()
+		server.exitCode = -1
+
+		if _exitError, ok := exitError.(*exec.ExitError); ok {
+			server.exitCode = _exitError.ExitCode()
+		}
+	}
+	server.mutex.Unlock()
+
+	if policy == utils.RestartPolicyNever || (policy == utils.RestartPolicyOnFailure && exitError == nil) {
+		if exitError != nil {
+			server.setState(utils.ServerStateFailed, 0)
+
+			log.WithFields(log.Fields{"name": server.name, "error": exitError, "policy": policy}).Error("Server failed")
+
+		} else {
+			server.setState(utils.ServerStateExited, 0)
+
+			log.WithFields(log.Fields{"name": server.name, "policy": policy}).Info("Server exited")
+		}
+
+		return 0, false
+	}
+
+	now := time.Now()
+	window := time.Duration(server.restart.GetWindow()) * time.Second
+	restartTimes := []time.Time{}
+
+	for _, restartTime := range server.restartTimes {
+		if now.Sub(restartTime) < window {
+			restartTimes = append(restartTimes, restartTime)
+		}
+	}
+
+	server.restartTimes = append(restartTimes, now)
+
+	maximumBackoff := time.Duration(server.restart.GetMaximumBackoff()) * time.Second
+	delay := time.Duration(server.restart.GetInitialBackoff()) * time.Second
+
+	for i := 1; i < len(server.restartTimes) && delay < maximumBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maximumBackoff {
+		delay = maximumBackoff
+	}
+
+	crashLooping := uint(len(server.restartTimes)) > server.restart.GetMaximumRestarts()
+
+	server.mutex.Lock()
+	server.restarts++
+	detected := crashLooping && !server.crashLooping
+	server.crashLooping = crashLooping
+	server.mutex.Unlock()
+
+	if crashLooping {
+		// Report the crash loop only once, when it is detected
+		if detected {
+			log.WithFields(log.Fields{"name": server.name, "error": exitError, "restarts": len(server.restartTimes), "window": window, "delay": maximumBackoff}).Error("Server is crash looping")
+
+			for _, line := range server.tail.Lines() {
+				log.WithFields(log.Fields{"name": server.name, "line": line}).Error("Server output")
+			}
+		}
+
+		server.setState(utils.ServerStateBackoff, 0)
+
+		return maximumBackoff, true
+	}
+
+	server.setState(utils.ServerStateBackoff, 0)
+
+	log.WithFields(log.Fields{"name": server.name, "error": exitError, "delay": delay, "_command": strings.Join(server.command, " ")}).Error("Restarting server")
+
+	return delay, true
+}
+
+func (server *ServerWrapper) setState(state string, pid int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	// Keep the crash loop visible until the process runs again
+	if server.crashLooping && (state == utils.ServerStateStarting || state == utils.ServerStateBackoff) {
+		state = utils.ServerStateCrashLoop
+	}
+
+	server.state = state
+	server.pid = pid
+	server.since = time.Now()
+}
+
+func (server *ServerWrapper) Status() ServerStatus {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	ready := server.ready
+
+	if server.readiness == nil {
+		ready = server.state == utils.ServerStateRunning
+	}
+
+	status := ServerStatus{Name: server.name, State: server.state, Ready: ready, PID: server.pid, Restarts: server.restarts, LastExit: server.lastExit, ExitCode: server.exitCode, Since: server.since}
+
+	if server.state == utils.ServerStateRunning {
+		status.Uptime = time.Since(server.since).Seconds()
+	}
+
+	if server.logger.Enabled {
+		status.LogFile = server.logger.Filename
+
+		if _, ok := server.output.(*journaldWriter); ok {
+			status.LogFile = utils.LogJournald
+		}
+	}
+
+	return status
+}
+
+// Stop terminates the server and waits at most its grace period for it to exit
 func (server *ServerWrapper) Stop() {
+	server.StopWithin(server.GracePeriod())
+}
+
+// StopWithin terminates the server like Stop, but shortens the grace period to the timeout
+func (server *ServerWrapper) StopWithin(timeout time.Duration) {
+	server.lifecycle.Lock()
+	defer server.lifecycle.Unlock()
+
 	if !server.started {
 		return
 	}
 
-	log.WithFields(log.Fields{"name": server.Name()}).Info("Stopping server")
+	gracePeriod := server.GracePeriod()
+	if timeout < gracePeriod {
+		gracePeriod = timeout
+	}
 
+	if gracePeriod < 0 {
+		gracePeriod = 0
+	}
+
+	log.WithFields(log.Fields{"name": server.Name(), "grace-period": gracePeriod}).Info("Stopping server")
+
+	server.mutex.Lock()
+	server.stopTimeout = gracePeriod
 	server.stop = true
+	server.mutex.Unlock()
 
 	server.cancel()
 
 	<-server.done
 
+	server.started = false
+
 	log.WithFields(log.Fields{"name": server.name, "_command": strings.Join(server.command, " ")}).Info("Stopped server")
 }
 
@@ -0,0 +1,147 @@
+package servers
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/darxkies/k8s-tew/pkg/config"
+	"github.com/darxkies/k8s-tew/pkg/utils"
+)
+
+func newTestServerWrapper() *ServerWrapper {
+	return &ServerWrapper{name: "sleep", command: []string{"sleep", "60"}, tail: newTailBuffer(utils.CrashLoopLogLines), state: utils.ServerStateStopped, since: time.Now()}
+}
+
+// TestServerWrapperConcurrentStartStop starts and stops the server from several goroutines at once, like the API and
+// the supervisor do, and checks that no process is left behind
+func TestServerWrapperConcurrentStartStop(t *testing.T) {
+	server := newTestServerWrapper()
+
+	var waitGroup sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		waitGroup.Add(1)
+
+		go func(i int) {
+			defer waitGroup.Done()
+
+			for j := 0; j < 10; j++ {
+				if (i+j)%2 == 0 {
+					if _error := server.Start(); _error != nil {
+						t.Error(_error)
+					}
+
+				} else {
+					server.StopWithin(time.Second)
+				}
+			}
+		}(i)
+	}
+
+	waitGroup.Wait()
+
+	server.StopWithin(time.Second)
+
+	if status := server.Status(); status.State != utils.ServerStateStopped {
+		t.Errorf("got state %s, expected %s", status.State, utils.ServerStateStopped)
+	}
+
+	if server.started {
+		t.Error("server still marked as started")
+	}
+}
+
+// TestServerWrapperStartAfterExit checks that a server, which was not restarted due to its restart policy, can be started again
+func TestServerWrapperStartAfterExit(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		command string
+		state   string
+	}{
+		{name: "never", policy: utils.RestartPolicyNever, command: "exit 1", state: utils.ServerStateFailed},
+		{name: "on-failure", policy: utils.RestartPolicyOnFailure, command: "exit 0", state: utils.ServerStateExited},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := path.Join(t.TempDir(), "runs")
+
+			server := newTestServerWrapper()
+			server.command = []string{"sh", "-c", fmt.Sprintf("echo run >> %s; %s", filename, test.command)}
+			server.restart = &config.RestartConfig{Policy: test.policy}
+
+			for i := 0; i < 2; i++ {
+				if _error := server.Start(); _error != nil {
+					t.Fatal(_error)
+				}
+
+				select {
+				case <-server.done:
+				case <-time.After(5 * time.Second):
+					t.Fatal("server did not exit")
+				}
+
+				if status := server.Status(); status.State != test.state {
+					t.Errorf("got state %s, expected %s", status.State, test.state)
+				}
+			}
+
+			// Every start runs the process exactly once
+			if content, _ := os.ReadFile(filename); strings.Count(string(content), "run") != 2 {
+				t.Errorf("got runs %q, expected two", content)
+			}
+
+			server.StopWithin(time.Second)
+		})
+	}
+}
+
+func TestSameServer(t *testing.T) {
+	probe := func(target string) *Probe {
+		return &Probe{config: &config.ProbeConfig{Type: utils.ProbeTypeHTTP, Target: "{{.Target}}"}, target: target}
+	}
+
+	tests := []struct {
+		name   string
+		change func(server *ServerWrapper)
+		same   bool
+	}{
+		{name: "unchanged", change: func(server *ServerWrapper) {}, same: true},
+		{name: "state", change: func(server *ServerWrapper) { server.restarts = 3 }, same: true},
+		{name: "command", change: func(server *ServerWrapper) { server.command = []string{"sleep", "30"} }},
+		{name: "environment", change: func(server *ServerWrapper) { server.environment = map[string]string{"KEY": "other"} }},
+		{name: "path", change: func(server *ServerWrapper) { server.pathEnvironment = "PATH=/usr/bin" }},
+		{name: "probe target", change: func(server *ServerWrapper) { server.liveness = probe("http://192.168.0.2/healthz") }},
+		{name: "probe removed", change: func(server *ServerWrapper) { server.readiness = nil }},
+		{name: "logger", change: func(server *ServerWrapper) { server.logger.Filename = "/var/log/other.log" }},
+		{name: "stop", change: func(server *ServerWrapper) { server.stopConfig = &config.StopConfig{Signal: "SIGINT"} }},
+	}
+
+	newServer := func() *ServerWrapper {
+		server := newTestServerWrapper()
+		server.environment = map[string]string{"KEY": "value"}
+		server.logger = config.LoggerConfig{Enabled: true, Filename: "/var/log/sleep.log"}
+		server.liveness = probe("http://192.168.0.1/healthz")
+		server.readiness = probe("http://192.168.0.1/readyz")
+
+		return server
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replacement := newServer()
+
+			test.change(replacement)
+
+			if same := sameServer(newServer(), replacement); same != test.same {
+				t.Errorf("got %t, expected %t", same, test.same)
+			}
+		})
+	}
+}
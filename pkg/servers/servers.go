@@ -1,10 +1,10 @@
 package servers
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -18,21 +18,142 @@ import (
 )
 
 type Servers struct {
-	config  *config.InternalConfig
-	servers []Server
-	stop    bool
+	config          *config.InternalConfig
+	servers         []Server
+	serverConfigs   map[string]config.ServerConfig
+	pathEnvironment string
+	stop            bool
+	terminating     bool
+	apiTLS          bool
+	mutex           sync.Mutex
+	lifecycle       sync.Mutex
+	commandsMutex   sync.Mutex
+	commands        CommandsStatus
+	metrics         *Metrics
 }
 
-func NewServers(_config *config.InternalConfig) *Servers {
-	return &Servers{config: _config, servers: []Server{}, stop: false}
+func NewServers(_config *config.InternalConfig, apiTLS bool) *Servers {
+	return &Servers{config: _config, servers: []Server{}, serverConfigs: map[string]config.ServerConfig{}, stop: false, apiTLS: apiTLS}
 }
 
-func (servers *Servers) add(server Server) {
-	servers.servers = append(servers.servers, server)
+// Status returns the status of all servers and the progress of the commands
+func (servers *Servers) Status() Status {
+	status := Status{Node: servers.getConfig().Name, Servers: []ServerStatus{}}
+
+	for _, server := range servers.getServers() {
+		status.Servers = append(status.Servers, server.Status())
+	}
+
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	status.Commands = servers.commands
+
+	return status
+}
+
+// getConfig returns the config, which is replaced on reload
+func (servers *Servers) getConfig() *config.InternalConfig {
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	return servers.config
+}
+
+// getServers returns a copy of the servers, which change on reload
+func (servers *Servers) getServers() []Server {
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	return append([]Server{}, servers.servers...)
+}
+
+// setStop aborts the retries of the running command
+func (servers *Servers) setStop() {
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	servers.stop = true
+}
+
+// terminate aborts the running command and prevents further commands from being executed
+func (servers *Servers) terminate() {
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	servers.stop = true
+	servers.terminating = true
+}
+
+// resume allows the commands to run again unless k8s-tew is terminating
+func (servers *Servers) resume() bool {
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	if servers.terminating {
+		return false
+	}
+
+	servers.stop = false
+
+	return true
+}
+
+// isStopping returns true if the retries of the running command are aborted
+func (servers *Servers) isStopping() bool {
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	return servers.stop
+}
+
+func (servers *Servers) findServer(name string) Server {
+	for _, server := range servers.getServers() {
+		if server.Name() == name {
+			return server
+		}
+	}
+
+	return nil
+}
+
+func (servers *Servers) updateCommands(update func(commands *CommandsStatus)) {
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	update(&servers.commands)
 }
 
-func (servers *Servers) runCommand(command *config.Command, commandRetries uint, step, count int) error {
-	newCommand, error := servers.config.ApplyTemplate(command.Name, command.Command)
+// getServerConfigs returns the enabled servers of the config that belong on this node, ordered by their dependencies
+func getServerConfigs(_config *config.InternalConfig) ([]config.ServerConfig, error) {
+	result := []config.ServerConfig{}
+
+	for _, serverConfig := range _config.Config.Servers {
+		if !serverConfig.Enabled {
+			continue
+		}
+
+		if !config.CompareLabels(_config.Node.Labels, serverConfig.Labels) {
+			continue
+		}
+
+		result = append(result, serverConfig)
+	}
+
+	return orderServerConfigs(_config, result)
+}
+
+func (servers *Servers) newServer(_config *config.InternalConfig, serverConfig config.ServerConfig) (Server, error) {
+	server, error := NewServerWrapper(*_config, serverConfig.Name, serverConfig, servers.pathEnvironment)
+	if error != nil {
+		return nil, errors.Wrapf(error, "server wrapper for '%s' failed", serverConfig.Name)
+	}
+
+	return server, nil
+}
+
+func (servers *Servers) runCommand(_config *config.InternalConfig, command *config.Command, commandRetries uint) error {
+	newCommand, error := _config.ApplyTemplate(command.Name, command.Command)
 	if error != nil {
 		return error
 	}
@@ -40,7 +161,7 @@ func (servers *Servers) runCommand(command *config.Command, commandRetries uint,
 	log.WithFields(log.Fields{"name": command.Name, "_command": newCommand}).Info("Executing command")
 
 	for retries := uint(0); retries < commandRetries; retries++ {
-		if servers.stop {
+		if servers.isStopping() {
 			break
 		}
 
@@ -61,75 +182,175 @@ func (servers *Servers) runCommand(command *config.Command, commandRetries uint,
 	return nil
 }
 
-func (servers *Servers) Steps() int {
-	return len(servers.config.Config.Servers) + len(servers.config.Config.Commands) + 1
+// waitReady delays starting the following servers until the server is ready. If it does not become ready in time,
+// the following servers are started anyway.
+func (servers *Servers) waitReady(server Server) {
+	if _error := server.WaitReady(utils.ReadinessTimeout * time.Second); _error != nil {
+		log.WithFields(log.Fields{"name": server.Name(), "error": _error}).Warn("Server not ready")
+	}
+}
+
+// restorePods restores the pods after containerd was (re)started
+func (servers *Servers) restorePods() {
+	_pods := container.NewPods(servers.getConfig())
+
+	servers.metrics.SetRestoreResult(_pods.Restore())
 }
 
-func (servers *Servers) Run(commandRetries uint, cleanup func()) error {
-	isContainerd := func(server Server) bool {
-		return server.Name() == utils.ContainerdServerName
+// shutdown cordons and drains the node and stops the servers in the reverse order of their dependencies. The containers
+// are cleaned up right before containerd is stopped. The drain is aborted in time to stop the
+// servers gracefully before the timeout. Servers that are still running at the timeout are killed.
+func (servers *Servers) shutdown(kubernetesClient *k8s.K8S, timeout time.Duration, cleanup func()) {
+	deadline := time.Now().Add(timeout)
+
+	// The servers are stopped one after the other, but they get at least half of the time
+	stopDuration := time.Duration(0)
+
+	for _, server := range servers.getServers() {
+		stopDuration += server.GracePeriod()
 	}
 
-	pathEnvironment := os.Getenv("PATH")
-	pathEnvironment = fmt.Sprintf("PATH=%s:%s", servers.config.GetFullLocalAssetDirectory(utils.DirectoryHostBinaries), pathEnvironment)
+	if stopDuration > timeout/2 {
+		stopDuration = timeout / 2
+	}
 
-	// Add servers
-	for _, serverConfig := range servers.config.Config.Servers {
-		if !serverConfig.Enabled {
-			continue
+	log.WithFields(log.Fields{"timeout": timeout}).Info("Shutting down")
+
+	nodeName := servers.getConfig().Name
+
+	log.Info("Cordoning")
+
+	if _error := kubernetesClient.Cordon(nodeName); _error != nil {
+		log.WithFields(log.Fields{"Error": _error}).Error("Cordoning failed")
+
+	} else {
+		log.Info("Cordoned")
+
+		log.Info("Draining")
+
+		drainContext, cancel := context.WithDeadline(context.Background(), deadline.Add(-stopDuration))
+
+		if _error := kubernetesClient.DrainContext(drainContext, nodeName); _error != nil {
+			log.WithFields(log.Fields{"error": _error}).Error("Drain failed")
+
+		} else {
+			log.Info("Drained")
 		}
 
-		if !config.CompareLabels(servers.config.Node.Labels, serverConfig.Labels) {
-			continue
+		cancel()
+	}
+
+	cleanedUp := false
+
+	_servers := servers.getServers()
+
+	for index := len(_servers) - 1; index >= 0; index-- {
+		server := _servers[index]
+
+		// The containers are killed through containerd
+		if server.Name() == utils.ContainerdServerName {
+			cleanup()
+
+			cleanedUp = true
 		}
 
-		server, error := NewServerWrapper(*servers.config, serverConfig.Name, serverConfig, pathEnvironment)
+		server.StopWithin(time.Until(deadline))
+	}
+
+	if !cleanedUp {
+		cleanup()
+	}
+
+	log.Info("Stopped all servers")
+}
+
+func (servers *Servers) Steps() int {
+	_config := servers.getConfig()
+
+	return len(_config.Config.Servers) + len(_config.Config.Commands) + 1
+}
+
+func (servers *Servers) Run(commandRetries uint, shutdownTimeout time.Duration, cleanup func()) error {
+	// The config is replaced on reload, while the goroutines started below still use the initial one
+	_config := servers.getConfig()
+
+	pathEnvironment := os.Getenv("PATH")
+	servers.pathEnvironment = fmt.Sprintf("PATH=%s:%s", _config.GetFullLocalAssetDirectory(utils.DirectoryHostBinaries), pathEnvironment)
+
+	serverConfigs, error := getServerConfigs(_config)
+	if error != nil {
+		return error
+	}
 
+	// Add servers
+	for _, serverConfig := range serverConfigs {
+		server, error := servers.newServer(_config, serverConfig)
 		if error != nil {
-			return errors.Wrapf(error, "server wrapper for '%s' failed", serverConfig.Name)
+			return error
 		}
 
-		servers.add(server)
+		servers.mutex.Lock()
+		servers.servers = append(servers.servers, server)
+		servers.serverConfigs[serverConfig.Name] = serverConfig
+		servers.mutex.Unlock()
 	}
 
-	// Start only containerd
-	for _, server := range servers.servers {
-		if !isContainerd(server) {
-			continue
+	// k8s-tew moves itself into a leaf cgroup before it starts any process, so that the servers can get their own cgroups
+	if isCgroupV2() {
+		if _, error := getCgroupParent(); error != nil {
+			log.WithFields(log.Fields{"error": error}).Warn("Could not set up cgroups")
 		}
+	}
 
-		if error := server.Start(); error != nil {
-			return error
-		}
+	api, error := NewAPI(servers, servers.apiTLS)
+	if error != nil {
+		return error
+	}
 
-		utils.IncreaseProgressStep()
+	if error := api.Start(); error != nil {
+		return error
 	}
 
-	// Restore Pods
-	_pods := container.NewPods(servers.config)
+	defer api.Stop()
 
-	_pods.Restore()
+	servers.metrics = NewMetrics(servers, _config.Node.IP, _config.GetMetricsPort())
 
-	// Start all other entries
-	for _, server := range servers.servers {
-		if isContainerd(server) {
-			continue
-		}
+	if error := servers.metrics.Start(); error != nil {
+		return error
+	}
+
+	defer servers.metrics.Stop()
+
+	// Restore Pods once containerd is ready or right away if it is not supervised
+	if servers.findServer(utils.ContainerdServerName) == nil {
+		servers.restorePods()
+	}
+
+	// Start the servers ordered by their dependencies
+	for _, server := range servers.getServers() {
+		servers.waitDependencies(server)
 
 		if error := server.Start(); error != nil {
 			return error
 		}
 
+		if server.Name() == utils.ContainerdServerName {
+			servers.waitReady(server)
+
+			servers.restorePods()
+		}
+
 		utils.IncreaseProgressStep()
 	}
 
-	kubernetesClient := k8s.NewK8S(servers.config)
+	kubernetesClient := k8s.NewK8S(_config)
 
 	go func() {
 		log.Info("Uncordoning")
 
 		for {
-			if _error := kubernetesClient.Uncordon(servers.config.Name); _error != nil {
+			holder, _error := kubernetesClient.UncordonUnlessHeld(_config.Name)
+			if _error != nil {
 				log.WithFields(log.Fields{"status": _error}).Debug("Uncordoning")
 
 				time.Sleep(time.Second)
@@ -137,63 +358,49 @@ func (servers *Servers) Run(commandRetries uint, cleanup func()) error {
 				continue
 			}
 
+			// A rolling update uncordons the node only after it became healthy again
+			if len(holder) > 0 {
+				log.WithFields(log.Fields{"cordoned-by": holder}).Info("Node stays cordoned")
+
+				return
+			}
+
 			break
 		}
 
 		log.Info("Uncordoned")
 	}()
 
-	// Register servers' stop
+	// Register servers' stop. The API is stopped first, waiting for the pending requests, so that it can not start
+	// servers again during the shutdown.
 	defer func() {
-		log.Info("Cordoning")
-
-		if _error := kubernetesClient.Cordon(servers.config.Name); _error != nil {
-			log.WithFields(log.Fields{"Error": _error}).Error("Cordoning failed")
-
-		} else {
-			log.Info("Cordoned")
-
-			log.Info("Draining")
-
-			if _error := kubernetesClient.Drain(servers.config.Name); _error != nil {
-				log.WithFields(log.Fields{"error": _error}).Error("Drain failed")
-
-			} else {
-				log.Info("Drained")
-			}
-		}
-
-		// Stop all servers but containerd
-		for _, server := range servers.servers {
-			if isContainerd(server) {
-				continue
-			}
+		api.Stop()
 
-			server.Stop()
-		}
+		servers.shutdown(kubernetesClient, shutdownTimeout, cleanup)
+	}()
 
-		cleanup()
+	// Import images if downloaded and if node is a Bootstrapper
+	if config.CompareLabels(_config.Node.Labels, config.Labels{utils.NodeBootstrapper}) {
+		images := _config.Config.Versions.GetImages()
 
-		// Stop containerd
-		for _, server := range servers.servers {
-			server.Stop()
+		for _, image := range images {
+			servers.metrics.AddImage(image.Name)
 		}
 
-		log.Info("Stopped all servers")
-	}()
-
-	// Import images if downloaded and if node is a Bootstrapper
-	if config.CompareLabels(servers.config.Node.Labels, config.Labels{utils.NodeBootstrapper}) {
 		go func() {
-			for _, image := range servers.config.Config.Versions.GetImages() {
-				command := deployment.GetImportImageCommand(servers.config, image.Name, servers.config.GetFullTargetAssetFilename(image.GetImageFilename()))
+			for _, image := range images {
+				command := deployment.GetImportImageCommand(_config, image.Name, _config.GetFullTargetAssetFilename(image.GetImageFilename()))
 
 				log.WithFields(log.Fields{"name": image.Name}).Info("Import image")
 
+				start := time.Now()
+
 				for {
 					if _error := utils.RunCommand(command); _error != nil {
 						log.WithFields(log.Fields{"error": _error}).Info("Image import failed")
 
+						servers.metrics.AddImageImportFailure(image.Name)
+
 						time.Sleep(time.Second)
 
 						continue
@@ -201,68 +408,99 @@ func (servers *Servers) Run(commandRetries uint, cleanup func()) error {
 
 					break
 				}
+
+				servers.metrics.SetImageImported(image.Name, start)
 			}
 		}()
 	}
 
 	go func() {
-		successful := true
-
-		// Register commands based on labels to be executed asynchronously
-		for index, command := range servers.config.Config.Commands {
-			if !config.CompareLabels(servers.config.Node.Labels, command.Labels) {
-				utils.IncreaseProgressStep()
-
-				continue
-			}
+		if servers.runCommands(_config, _config.Config.Commands, commandRetries) {
+			log.Info("Cluster setup finished - Supervising servers")
+		}
 
-			if !utils.HasOS(command.OS) {
-				utils.IncreaseProgressStep()
+		utils.HideProgress()
+	}()
 
-				continue
-			}
+	servers.supervise(commandRetries)
 
-			if len(command.Manifest) > 0 {
-				if error := k8s.ApplyManifest(servers.config, command.Name, command.Manifest, -1); error != nil {
-					log.WithFields(log.Fields{"error": error}).Error("Cluster setup failed")
+	return nil
+}
 
-					successful = false
+// runCommands executes the commands that belong on this node one after the other and stops at the first failure
+func (servers *Servers) runCommands(_config *config.InternalConfig, commands config.Commands, commandRetries uint) bool {
+	// Commands of a reload wait for the previous ones
+	servers.commandsMutex.Lock()
+	defer servers.commandsMutex.Unlock()
 
-					servers.stop = true
+	// Retry again after a previous batch failed
+	if !servers.resume() {
+		return false
+	}
 
-					break
-				}
+	successful := true
 
-			} else {
-				if error := servers.runCommand(command, commandRetries, index+1, len(servers.config.Config.Commands)); error != nil {
-					log.WithFields(log.Fields{"error": error}).Error("Cluster setup failed")
+	servers.updateCommands(func(status *CommandsStatus) {
+		*status = CommandsStatus{Total: len(commands)}
+	})
 
-					successful = false
+	// Register commands based on labels to be executed asynchronously
+	for index, command := range commands {
+		servers.updateCommands(func(status *CommandsStatus) {
+			status.Completed = index
+			status.Current = command.Name
+		})
 
-					servers.stop = true
+		if !config.CompareLabels(_config.Node.Labels, command.Labels) {
+			utils.IncreaseProgressStep()
 
-					break
-				}
-			}
+			continue
+		}
 
+		if !utils.HasOS(command.OS) {
 			utils.IncreaseProgressStep()
+
+			continue
 		}
 
-		if successful {
-			log.Info("Cluster setup finished - Supervising servers")
+		start := time.Now()
+
+		var error error
+
+		if len(command.Manifest) > 0 {
+			error = k8s.ApplyManifest(_config, command.Name, command.Manifest, -1)
+
+		} else {
+			error = servers.runCommand(_config, command, commandRetries)
 		}
 
-		utils.HideProgress()
-	}()
+		servers.metrics.SetCommandResult(command.Name, start, error)
 
-	// Wait for signals to stop
-	signals := make(chan os.Signal, 1)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Cluster setup failed")
 
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+			servers.updateCommands(func(status *CommandsStatus) {
+				status.Error = error.Error()
+			})
 
-	<-signals
+			successful = false
 
-	servers.stop = true
+			servers.setStop()
 
-	return nil
+			break
+		}
+
+		utils.IncreaseProgressStep()
+	}
+
+	servers.updateCommands(func(status *CommandsStatus) {
+		status.Finished = true
+
+		if successful {
+			status.Completed = status.Total
+			status.Current = ""
+		}
+	})
+
+	return successful
 }
@@ -0,0 +1,81 @@
+package servers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+type CommandsStatus struct {
+	Total     int    `json:"total"`
+	Completed int    `json:"completed"`
+	Current   string `json:"current,omitempty"`
+	Finished  bool   `json:"finished"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Status struct {
+	Node     string         `json:"node"`
+	Servers  []ServerStatus `json:"servers"`
+	Commands CommandsStatus `json:"commands"`
+}
+
+func (status Status) WriteJSON(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(status)
+}
+
+func (status Status) WriteTable(writer io.Writer) error {
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tabWriter, "NAME\tSTATE\tREADY\tPID\tUPTIME\tRESTARTS\tLAST EXIT\tLOG")
+
+	for _, server := range status.Servers {
+		pid := "-"
+
+		if server.PID > 0 {
+			pid = strconv.Itoa(server.PID)
+		}
+
+		uptime := "-"
+
+		if server.Uptime > 0 {
+			uptime = (time.Duration(server.Uptime) * time.Second).String()
+		}
+
+		lastExit := "-"
+
+		if len(server.LastExit) > 0 {
+			lastExit = fmt.Sprintf("%d (%s)", server.ExitCode, server.LastExit)
+		}
+
+		fmt.Fprintf(tabWriter, "%s\t%s\t%t\t%s\t%s\t%d\t%s\t%s\n", server.Name, server.State, server.Ready, pid, uptime, server.Restarts, lastExit, server.LogFile)
+	}
+
+	if _error := tabWriter.Flush(); _error != nil {
+		return _error
+	}
+
+	commands := status.Commands
+
+	fmt.Fprintf(writer, "\nCommands: %d/%d", commands.Completed, commands.Total)
+
+	if len(commands.Error) > 0 {
+		fmt.Fprintf(writer, " failed at '%s': %s", commands.Current, commands.Error)
+
+	} else if commands.Finished {
+		fmt.Fprint(writer, " finished")
+
+	} else if len(commands.Current) > 0 {
+		fmt.Fprintf(writer, " running '%s'", commands.Current)
+	}
+
+	_, _error := fmt.Fprintln(writer)
+
+	return _error
+}
@@ -0,0 +1,59 @@
+package servers
+
+import (
+	"strings"
+	"sync"
+)
+
+// Longer lines are truncated to their end
+const maximumLineLength = 4096
+
+// tailBuffer keeps the last lines written to it
+type tailBuffer struct {
+	mutex   sync.Mutex
+	size    int
+	lines   []string
+	partial string
+}
+
+func newTailBuffer(size int) *tailBuffer {
+	return &tailBuffer{size: size, lines: []string{}}
+}
+
+func (buffer *tailBuffer) Write(data []byte) (int, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	lines := strings.Split(buffer.partial+string(data), "\n")
+
+	buffer.partial = lines[len(lines)-1]
+
+	if len(buffer.partial) > maximumLineLength {
+		buffer.partial = buffer.partial[len(buffer.partial)-maximumLineLength:]
+	}
+	buffer.lines = append(buffer.lines, lines[:len(lines)-1]...)
+
+	if len(buffer.lines) > buffer.size {
+		buffer.lines = buffer.lines[len(buffer.lines)-buffer.size:]
+	}
+
+	return len(data), nil
+}
+
+// Lines returns the last lines including an unterminated one
+func (buffer *tailBuffer) Lines() []string {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	result := append([]string{}, buffer.lines...)
+
+	if len(buffer.partial) > 0 {
+		result = append(result, buffer.partial)
+	}
+
+	if len(result) > buffer.size {
+		result = result[len(result)-buffer.size:]
+	}
+
+	return result
+}
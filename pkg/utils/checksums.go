@@ -1,12 +1,14 @@
 package utils
 
 import (
-	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -21,32 +23,74 @@ type Checksums struct {
 	baseDirectory string
 	checksums     map[string]Checksum
 	loaded        bool
+	mutex         sync.Mutex
 }
 
 func NewChecksums(filename, baseDirectory string) *Checksums {
 	return &Checksums{filename: filename, baseDirectory: baseDirectory, checksums: map[string]Checksum{}}
 }
 
-func (checksums *Checksums) md5(targetFilename string) (result string, error error) {
-	file, error := os.Open(targetFilename)
+// SHA256 returns the hex encoded SHA-256 checksum of a file
+func SHA256(filename string) (result string, error error) {
+	file, error := os.Open(filename)
 	if error != nil {
 		return
 	}
 
 	defer file.Close()
 
-	hash := md5.New()
+	hash := sha256.New()
 
 	if _, error = io.Copy(hash, file); error != nil {
 		return
 	}
 
-	result = hex.EncodeToString(hash.Sum(nil)[:16])
+	result = hex.EncodeToString(hash.Sum(nil))
 
 	return
 }
 
+// ParseChecksums parses the content of a checksum file in the format of sha256sum. Entries using other hash algorithms are ignored.
+func ParseChecksums(content string) map[string]string {
+	result := map[string]string{}
+
+	for _, line := range strings.Split(content, "\n") {
+		tokens := strings.SplitN(line, " ", 2)
+
+		if len(tokens) != 2 || len(tokens[0]) != sha256.Size*2 {
+			continue
+		}
+
+		// sha256sum separates the checksum and the filename with two spaces
+		result[strings.TrimLeft(tokens[1], " ")] = tokens[0]
+	}
+
+	return result
+}
+
+// FormatChecksums returns the checksums in the format of sha256sum sorted by filename
+func FormatChecksums(checksums map[string]string) string {
+	filenames := []string{}
+
+	for filename := range checksums {
+		filenames = append(filenames, filename)
+	}
+
+	sort.Strings(filenames)
+
+	var builder strings.Builder
+
+	for _, filename := range filenames {
+		fmt.Fprintf(&builder, "%s  %s\n", checksums[filename], filename)
+	}
+
+	return builder.String()
+}
+
 func (checksums *Checksums) GetChecksum(targetFilename string) (result string, error error) {
+	checksums.mutex.Lock()
+	defer checksums.mutex.Unlock()
+
 	relativeFilename := targetFilename[len(checksums.baseDirectory):]
 
 	checksumsCache, _errorCache := os.Stat(checksums.filename)
@@ -62,7 +106,7 @@ func (checksums *Checksums) GetChecksum(targetFilename string) (result string, e
 		return checksum.value, nil
 	}
 
-	result, _error := checksums.md5(targetFilename)
+	result, _error := SHA256(targetFilename)
 	if _error != nil {
 		return "", _error
 	}
@@ -74,14 +118,25 @@ func (checksums *Checksums) GetChecksum(targetFilename string) (result string, e
 	return
 }
 
+// Forget drops the checksum of a file that was changed, so that it is computed again
+func (checksums *Checksums) Forget(targetFilename string) {
+	checksums.mutex.Lock()
+	defer checksums.mutex.Unlock()
+
+	delete(checksums.checksums, targetFilename[len(checksums.baseDirectory):])
+}
+
 func (checksums *Checksums) Save() error {
-	buffer := ""
+	checksums.mutex.Lock()
+	defer checksums.mutex.Unlock()
+
+	values := map[string]string{}
 
 	for filename, value := range checksums.checksums {
-		buffer += fmt.Sprintf("%s %s\n", value.value, filename)
+		values[filename] = value.value
 	}
 
-	if _error := os.WriteFile(checksums.filename, []byte(buffer), 0644); _error != nil {
+	if _error := os.WriteFile(checksums.filename, []byte(FormatChecksums(values)), 0644); _error != nil {
 		return errors.Wrapf(_error, "Could not write to %s", checksums.filename)
 	}
 
@@ -89,6 +144,9 @@ func (checksums *Checksums) Save() error {
 }
 
 func (checksums *Checksums) Load() error {
+	checksums.mutex.Lock()
+	defer checksums.mutex.Unlock()
+
 	if checksums.loaded {
 		return nil
 	}
@@ -100,16 +158,7 @@ func (checksums *Checksums) Load() error {
 		return _error
 	}
 
-	lines := strings.Split(string(content), "\n")
-
-	for _, line := range lines {
-		if len(line) < 35 {
-			continue
-		}
-
-		filename := line[33:]
-		checksum := line[:32]
-
+	for filename, checksum := range ParseChecksums(string(content)) {
 		checksums.checksums[filename] = Checksum{value: checksum, updated: false}
 	}
 
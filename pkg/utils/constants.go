@@ -105,15 +105,23 @@ const AdminUserName = "admin-user"
 const AdminUserNamespace = "kube-system"
 const KubernetesDashboardNamespace = "kube-system"
 const DrainGracePeriodSeconds = 0
+const GenerationRetention = 5
 const ClusterWeight = "cluster-weight"
 const ClusterCache = "cluster-cache"
+const OIDCUsernameClaim = "email"
+const OIDCGroupsClaim = "groups"
 
 // Ports
+const PortSSH uint16 = 22
 const PortVipRaftController uint16 = 16277
 const PortVipRaftWorker uint16 = 16728
 const PortLoadBalancer uint16 = 16443
 const PortKubernetesDashboard uint16 = 32443
 const PortApiServer uint16 = 6443
+const PortEtcdClient uint16 = 2379
+const PortEtcdPeer uint16 = 2380
+const PortEtcdMetrics uint16 = 2381
+const PortKubelet uint16 = 10250
 const PortCephManager uint16 = 30700
 const PortCephRadosGateway uint16 = 30750
 const PortMinio uint16 = 30800
@@ -121,6 +129,7 @@ const PortGrafana uint16 = 30900
 const PortKibana uint16 = 30980
 const PortCerebro uint16 = 30990
 const PortWordpress uint16 = 30100
+const PortMetrics uint16 = 16500
 
 // URLs
 const K8sBaseName = "kubernetes-node-linux-amd64"
@@ -160,6 +169,7 @@ const FeatureIngress = "ingress"
 
 // Namespaces
 const NamespaceKubeSystem = "kube-system"
+const NamespaceKubeNodeLease = "kube-node-lease"
 const NamespaceNetworking = "networking"
 const NamespaceStorage = "storage"
 const NamespaceMonitoring = "monitoring"
@@ -179,6 +189,7 @@ const SubdirectoryConfig = "etc"
 const SubdirectorySystemd = "systemd"
 const SubdirectorySystem = "system"
 const SubdirectoryK8sTew = "k8s-tew"
+const SubdirectoryGenerations = "generations"
 const SubdirectoryCertificates = "ssl"
 const SubdirectoryOptional = "opt"
 const SubdirectoryVariable = "var"
@@ -305,6 +316,9 @@ const PemPrometheus = "prometheus.pem"
 const PemPrometheusKey = "prometheus-key.pem"
 const PemKubernetesDashboard = "kubernetes-dashboard.pem"
 const PemKubernetesDashboardKey = "kubernetes-dashboard-key.pem"
+const PemOIDCCa = "oidc-ca.pem"
+const PemUser = "user-%s.pem"
+const PemUserKey = "user-%s-key.pem"
 
 // Kubeconfig
 const KubeconfigAdmin = "admin.kubeconfig"
@@ -312,6 +326,7 @@ const KubeconfigControllerManager = "controller-manager-{{.Name}}.kubeconfig"
 const KubeconfigScheduler = "scheduler-{{.Name}}.kubeconfig"
 const KubeconfigProxy = "proxy-{{.Name}}.kubeconfig"
 const KubeconfigKubelet = "kubelet-{{.Name}}.kubeconfig"
+const KubeconfigUser = "%s.kubeconfig"
 
 // Manifests
 const ManifestEtcd = "etcd-{{.Name}}.yaml"
@@ -332,6 +347,57 @@ const ContainerdSock = "containerd.sock"
 const ContainerdKubernetesNamespace = "k8s.io"
 const ContainerdServerName = "containerd"
 
+// k8s-tew
+const ControlSocket = "k8s-tew.sock"
+const AnnotationCordonedBy = "k8s-tew/cordoned-by"
+const CordonHolderRollingUpdate = "rolling-update"
+
+// Servers
+const RestartPolicyAlways = "always"
+const RestartPolicyOnFailure = "on-failure"
+const RestartPolicyNever = "never"
+const RestartInitialBackoff = 1
+const RestartMaximumBackoff = 60
+const RestartMaximumRestarts = 5
+const RestartWindow = 300
+const StopSignal = "SIGTERM"
+const StopGracePeriod = 30
+const ShutdownTimeout = 300
+const ServiceStopTimeoutMargin = 30
+const ConfigWatchInterval = 5
+const CrashLoopLogLines = 20
+const LogMaximumSize = 100
+const LogMaximumAge = 24
+const LogMaximumBackups = 5
+const LogRetention = 7
+const LogJournald = "journald"
+const CgroupRoot = "/sys/fs/cgroup"
+const CgroupSupervisor = "supervisor"
+const CgroupCPUPeriod = 100000
+const CgroupDefaultWeight = 100
+const ProbeTypeHTTP = "http"
+const ProbeTypeHTTPS = "https"
+const ProbeTypeGRPC = "grpc"
+const ProbeTypeUnix = "unix"
+const ProbeTypeExec = "exec"
+const ProbePeriod = 10
+const ProbeTimeout = 5
+const ProbeFailureThreshold = 3
+const ProbeSuccessThreshold = 1
+const ReadinessTimeout = 300
+const DependencyConditionStarted = "started"
+const DependencyConditionReady = "ready"
+const APITimeout = 120
+const KubeletHealthzURL = "http://127.0.0.1:10248/healthz"
+
+const ServerStateStarting = "starting"
+const ServerStateRunning = "running"
+const ServerStateBackoff = "backoff"
+const ServerStateCrashLoop = "crash-loop"
+const ServerStateExited = "exited"
+const ServerStateFailed = "failed"
+const ServerStateStopped = "stopped"
+
 // K8S Config
 const K8sKubeletSetup = "kubelet-setup.yaml"
 const K8sAdminUserSetup = "admin-user-setup.yaml"
@@ -381,6 +447,11 @@ const AuditLog = "audit.log"
 // Deployment
 const DeploymentUser = "root"
 
+// OIDC
+const OIDCLoginCommand = "kubectl"
+const OIDCLoginPlugin = "oidc-login"
+const OIDCDiscoveryTimeout = 10
+
 // Service
 const ServiceName = "k8s-tew"
 const ServiceConfig = ServiceName + ".service"
@@ -438,6 +509,7 @@ const TemplateKubeSchedulerConfiguration = "k8s/kube-scheduler-configuration.yam
 const TemplateKubeletConfiguration = "k8s/kubelet-configuration.yaml"
 const TemplateEncryptionConfig = "k8s/encryption-config.yaml"
 const TemplateKubeconfig = "k8s/kubeconfig.yaml"
+const TemplateKubeconfigOIDC = "k8s/kubeconfig-oidc.yaml"
 const TemplateCredentials = "k8s/credentials.yaml"
 const TemplateConfigMap = "k8s/config-map.yaml"
 const TemplateServiceAccount = "k8s/service-account.yaml"
@@ -483,6 +555,42 @@ const NodeRoleStorage = "node-role.kubernetes.io/storage"
 const NodeNotReady = "node.kubernetes.io/not-ready"
 
 const ConcurrentSshConnectionsLimit = 10
+const SSHKeepAliveInterval = 30
+const SSHSessionRetries = 5
+const SSHSessionRetryDelay = 1 // In seconds
+
+const EtcdClusterStateNew = "new"
+const EtcdClusterStateExisting = "existing"
+const EtcdLearnerTimeout = 300       // In seconds
+const KubeletFileCheckFrequency = 20 // In seconds
+
+const DeltaBlockSize = 64 * 1024
+const DeltaMinimumSize = 1024 * 1024
+const UploadProgressInterval = 5 // In seconds
+
+const TransportSSH = "ssh"
+const TransportLocal = "local"
+
+const UploadTemporarySuffix = ".k8s-tew-upload"
+const ChecksumsFilename = "checksums"
+const GenerationsHistoryFilename = "history"
+const GenerationIDFormat = "20060102150405"
+const GenerationRollbackPrefix = "rollback-to-"
+const DeploymentJournalFilename = "deployment-journal.yaml"
+const KnownHostsFilename = "known_hosts"
+const DeploymentReportFilename = "deployment-report.json"
+const DeploymentReportSummaryFilename = "deployment-report.txt"
+
+const OutputText = "text"
+const OutputJSON = "json"
+
+const ParallelNodes = 1
+
+const PreflightCephDiskSpace = 10 * 1024 * 1024 * 1024
+const PreflightMaximumClockSkew = 1.0
+
+const RollingBatchSize = 1
+const RollingTimeout = 600
 
 const GrafanaCredentials = "grafana-credentials"
 const MinioCredentials = "minio-credentials"
@@ -1,11 +1,25 @@
 package utils
 
-import "sync"
+import (
+	"strings"
+	"sync"
+)
 
 type Task func() error
 type Tasks []Task
 type Errors []error
 
+// Error joins the messages of all errors
+func (errors Errors) Error() string {
+	messages := []string{}
+
+	for _, error := range errors {
+		messages = append(messages, error.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
 func RunParallelTasks(tasks Tasks, parallel bool) (errors Errors) {
 	if !parallel {
 		for _, task := range tasks {
@@ -20,41 +34,25 @@ func RunParallelTasks(tasks Tasks, parallel bool) (errors Errors) {
 	}
 
 	waitGroup := sync.WaitGroup{}
+	mutex := sync.Mutex{}
 
 	waitGroup.Add(len(tasks))
 
-	errorChannel := make(chan error, 1)
-	finishedChannel := make(chan bool, 1)
-
-	// Schedule tasks to be executed
+	// Schedule tasks to be executed and collect their errors
 	for _, task := range tasks {
 		go func(_task Task) {
+			defer waitGroup.Done()
+
 			if error := _task(); error != nil {
-				errorChannel <- error
-			}
+				mutex.Lock()
+				defer mutex.Unlock()
 
-			waitGroup.Done()
+				errors = append(errors, error)
+			}
 		}(task)
 	}
 
-	// Wait for all tasks to be done and send notification
-	go func() {
-		waitGroup.Wait()
-
-		close(finishedChannel)
-	}()
-
-	done := false
-
-	// Collect errors and wait for all tasks to be done
-	for !done {
-		select {
-		case <-finishedChannel:
-			done = true
-		case error := <-errorChannel:
-			errors = append(errors, error)
-		}
-	}
+	waitGroup.Wait()
 
 	return
 }
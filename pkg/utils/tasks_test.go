@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRunParallelTasks(t *testing.T) {
+	tests := []struct {
+		name     string
+		tasks    int
+		failing  int
+		parallel bool
+		expected int
+	}{
+		{name: "no tasks", parallel: true},
+		{name: "all successful", tasks: 10, parallel: true},
+		{name: "all failing", tasks: 50, failing: 50, parallel: true, expected: 50},
+		{name: "some failing", tasks: 50, failing: 7, parallel: true, expected: 7},
+		{name: "sequential stops at first failure", tasks: 10, failing: 5, expected: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tasks := Tasks{}
+
+			for index := 0; index < test.tasks; index++ {
+				index := index
+
+				tasks = append(tasks, func() error {
+					if index < test.failing {
+						return fmt.Errorf("task %d failed", index)
+					}
+
+					return nil
+				})
+			}
+
+			// Errors must not get lost, no matter how the tasks are scheduled
+			for run := 0; run < 100; run++ {
+				if errors := RunParallelTasks(tasks, test.parallel); len(errors) != test.expected {
+					t.Fatalf("got %d errors, expected %d", len(errors), test.expected)
+				}
+			}
+		})
+	}
+}
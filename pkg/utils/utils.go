@@ -163,6 +163,23 @@ func ExtractImageTag(value string) string {
 	return value
 }
 
+// SplitList returns the trimmed, non-empty entries of a comma separated list
+func SplitList(value string) []string {
+	result := []string{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if len(entry) == 0 {
+			continue
+		}
+
+		result = append(result, entry)
+	}
+
+	return result
+}
+
 // ApplyTemplate generates a string using a template
 func ApplyTemplate(label, content string, data interface{}, alternativeDelimiters bool) (string, error) {
 	var result bytes.Buffer